@@ -0,0 +1,10 @@
+package audit
+
+// AuditRepository provides access to the audit log.
+type AuditRepository interface {
+	// GetAll returns all entries matching the filter, newest first.
+	GetAll(filter *Filter) ([]*Entry, error)
+
+	// Create appends an entry to the audit log.
+	Create(entry *Entry) error
+}
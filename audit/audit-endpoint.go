@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// AuditHandler handles requests to the audit endpoint.
+func AuditHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleAuditGet(w, r)
+	default:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET")
+	}
+}
+
+// handleAuditGet handles GET requests to the audit endpoint.
+func handleAuditGet(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterEntries(r)
+	if err != nil {
+		msg := fmt.Sprintf("Error parsing audit log filter: %s", err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	entries, err := getAllEntries(filter)
+	if err != nil {
+		msg := fmt.Sprintf("Error getting audit log: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	if entries == nil {
+		entries = make([]*Entry, 0)
+	}
+
+	b, err := json.Marshal(&Entries{Entries: entries})
+	if err != nil {
+		msg := fmt.Sprintf("Error converting audit log to JSON: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	log.Printf("Loaded %d audit log entries", len(entries))
+	utils.HttpOkResponse(w, b)
+}
+
+// filterEntries parses the query parameters of a request and returns a Filter.
+func filterEntries(r *http.Request) (*Filter, error) {
+	query := r.URL.Query()
+	filter := &Filter{
+		EntityType: query.Get("entityType"),
+		EntityId:   query.Get("entityId"),
+		Limit:      defaultLimit,
+	}
+
+	var err error
+
+	if user := query.Get("user"); user != "" {
+		filter.User, err = strconv.ParseInt(user, 10, 64)
+		if err != nil {
+			return nil, errors.New("user ID must be an integer")
+		}
+	}
+
+	if filter.EntityId != "" && filter.EntityType == "" {
+		return nil, errors.New("entityType must be set if entityId is set")
+	}
+
+	if from := query.Get("from"); from != "" {
+		filter.From, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, errors.New("from must be an RFC 3339 timestamp")
+		}
+	}
+
+	if to := query.Get("to"); to != "" {
+		filter.To, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, errors.New("to must be an RFC 3339 timestamp")
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxLimit {
+			return nil, fmt.Errorf("limit must be an integer between 1 and %d", maxLimit)
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Entry represents a single mutating API call in the audit log.
+type Entry struct {
+	Id         int64           `json:"id"`
+	User       int64           `json:"user,omitempty"` // ID of the user (0 if the call was not made by a user)
+	Actor      string          `json:"actor"`          // Name of the user or UUID of the controller
+	Timestamp  time.Time       `json:"timestamp"`
+	Method     string          `json:"method"`
+	Endpoint   string          `json:"endpoint"`
+	EntityType string          `json:"entityType"`
+	EntityId   string          `json:"entityId"`
+	Before     json.RawMessage `json:"before"` // Changed fields before the call (null if the entity has been created)
+	After      json.RawMessage `json:"after"`  // Changed fields after the call (null if the entity has been deleted)
+}
+
+// Entries represents a list of audit log entries.
+type Entries struct {
+	Entries []*Entry `json:"entries"`
+}
+
+// Actor identifies who made an API call.
+type Actor struct {
+	User int64  // ID of the user (0 if the call was not made by a user)
+	Name string // Name of the user or UUID of the controller
+}
+
+// Filter restricts the audit log entries returned by the repository.
+type Filter struct {
+	User       int64     // Only entries of this user (0 = all users)
+	EntityType string    // Only entries of this entity type ("" = all entity types)
+	EntityId   string    // Only entries of this entity ("" = all entities)
+	From       time.Time // Only entries at or after this time (zero = no lower bound)
+	To         time.Time // Only entries at or before this time (zero = no upper bound)
+	Limit      int       // Maximum number of entries, newest first
+}
@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// AuditSqliteRepository implements the AuditRepository interface.
+type AuditSqliteRepository struct {
+	db *sql.DB
+}
+
+// NewAuditRepository creates a new AuditRepository.
+func NewAuditRepository(session *db.Session) (AuditRepository, error) {
+	if !session.IsOpen() {
+		return nil, errors.New("session is not open")
+	}
+
+	return &AuditSqliteRepository{db: session.DB}, nil
+}
+
+func (r *AuditSqliteRepository) GetAll(filter *Filter) ([]*Entry, error) {
+	var from, to int64
+	if !filter.From.IsZero() {
+		from = filter.From.Unix()
+	}
+	if !filter.To.IsZero() {
+		to = filter.To.Unix()
+	}
+
+	rows, err := r.db.Query(`
+    SELECT
+        AL.ID,
+        AL.USER,
+        AL.ACTOR,
+        AL.TIMESTAMP,
+        AL.METHOD,
+        AL.ENDPOINT,
+        AL.ENTITY_TYPE,
+        AL.ENTITY_ID,
+        AL.BEFORE,
+        AL.AFTER
+    FROM AUDIT_LOG AL
+    WHERE (? = 0 OR AL.USER = ?)
+        AND (? = '' OR AL.ENTITY_TYPE = ?)
+        AND (? = '' OR AL.ENTITY_ID = ?)
+        AND (? = 0 OR AL.TIMESTAMP >= ?)
+        AND (? = 0 OR AL.TIMESTAMP <= ?)
+    ORDER BY AL.TIMESTAMP DESC, AL.ID DESC
+    LIMIT ?;`,
+		filter.User, filter.User,
+		filter.EntityType, filter.EntityType,
+		filter.EntityId, filter.EntityId,
+		from, from,
+		to, to,
+		filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*Entry
+	for rows.Next() {
+		var entry Entry
+		var user sql.NullInt64
+		var timestamp int64
+		var before, after sql.NullString
+
+		err = rows.Scan(&entry.Id, &user, &entry.Actor, &timestamp, &entry.Method, &entry.Endpoint,
+			&entry.EntityType, &entry.EntityId, &before, &after)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.User = user.Int64
+		entry.Timestamp = time.Unix(timestamp, 0).UTC()
+		if before.Valid {
+			entry.Before = []byte(before.String)
+		}
+		if after.Valid {
+			entry.After = []byte(after.String)
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
+
+func (r *AuditSqliteRepository) Create(entry *Entry) error {
+	_, err := r.db.Exec(`
+    INSERT INTO AUDIT_LOG (USER, ACTOR, TIMESTAMP, METHOD, ENDPOINT, ENTITY_TYPE, ENTITY_ID, BEFORE, AFTER)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		nullInt64(entry.User), entry.Actor, entry.Timestamp.Unix(), entry.Method, entry.Endpoint,
+		entry.EntityType, entry.EntityId, nullString(entry.Before), nullString(entry.After))
+
+	return err
+}
+
+// nullInt64 stores 0 as NULL.
+func nullInt64(i int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: i, Valid: i != 0}
+}
+
+// nullString stores missing JSON as NULL.
+func nullString(b []byte) sql.NullString {
+	return sql.NullString{String: string(b), Valid: b != nil}
+}
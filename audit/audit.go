@@ -0,0 +1,137 @@
+// Package audit records who changed what via the API and serves the audit log to admins.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// Record appends a mutating API call to the audit log. Before and after are the states of the entity
+// before and after the call (nil if it has been created or deleted). Only fields that changed are stored.
+// Errors are logged, but never fail the API call that has already been made.
+func Record(r *http.Request, actor Actor, entityType string, entityId any, before any, after any) {
+	beforeJson, afterJson, err := diff(before, after)
+	if err != nil {
+		log.Printf("Error recording audit log entry for %s %v: %s", entityType, entityId, err.Error())
+		return
+	}
+
+	entry := &Entry{
+		User:       actor.User,
+		Actor:      actor.Name,
+		Timestamp:  time.Now(),
+		Method:     r.Method,
+		Endpoint:   r.URL.Path,
+		EntityType: entityType,
+		EntityId:   fmt.Sprint(entityId),
+		Before:     beforeJson,
+		After:      afterJson,
+	}
+
+	err = createEntry(entry)
+	if err != nil {
+		log.Printf("Error recording audit log entry for %s %v: %s", entityType, entityId, err.Error())
+	}
+}
+
+// diff converts both states to JSON. If both are JSON objects, only the fields that changed are kept.
+func diff(before any, after any) (json.RawMessage, json.RawMessage, error) {
+	beforeJson, err := marshalState(before)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	afterJson, err := marshalState(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if beforeJson == nil || afterJson == nil {
+		return beforeJson, afterJson, nil
+	}
+
+	var beforeFields, afterFields map[string]json.RawMessage
+	if json.Unmarshal(beforeJson, &beforeFields) != nil || json.Unmarshal(afterJson, &afterFields) != nil {
+		// At least one of them is not an object, so store them as they are
+		return beforeJson, afterJson, nil
+	}
+
+	for field, value := range beforeFields {
+		if other, ok := afterFields[field]; ok && bytes.Equal(value, other) {
+			delete(beforeFields, field)
+			delete(afterFields, field)
+		}
+	}
+
+	beforeJson, err = json.Marshal(beforeFields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	afterJson, err = json.Marshal(afterFields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return beforeJson, afterJson, nil
+}
+
+// marshalState converts the state of an entity to JSON. A nil state is returned as nil.
+func marshalState(state any) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(b, []byte("null")) {
+		return nil, nil
+	}
+
+	return b, nil
+}
+
+// createEntry stores an entry in the audit log.
+func createEntry(entry *Entry) error {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	repository, err := NewAuditRepository(session)
+	if err != nil {
+		return err
+	}
+
+	return repository.Create(entry)
+}
+
+// getAllEntries returns all entries matching the filter.
+func getAllEntries(filter *Filter) ([]*Entry, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := NewAuditRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.GetAll(filter)
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// noUser is used as user ID to restrict listings if no user has been authenticated at all.
+// No access has been granted to it, so nothing is visible.
+const noUser int64 = -1
+
+// HasUnrestrictedAccess returns true if the user may access all plant groups without being granted access.
+func HasUnrestrictedAccess(user *SafeUser) bool {
+	return user.HasPermission(AllPlantGroups)
+}
+
+// RestrictingUserId returns the ID of the authenticated user if the plant groups they may see are restricted.
+// It returns 0 if all plant groups are visible. Listings pass it to their filters to return only
+// plant groups (and everything belonging to them) the user has been granted access to.
+func RestrictingUserId(ctx context.Context) int64 {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return noUser
+	}
+
+	if HasUnrestrictedAccess(user) {
+		return 0
+	}
+
+	return user.Id
+}
+
+// CanAccessPlantGroup returns true if the authenticated user has at least the given access to the plant group.
+func CanAccessPlantGroup(ctx context.Context, plantGroupId int64, access Access) (bool, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return false, nil
+	}
+
+	if HasUnrestrictedAccess(user) {
+		return true, nil
+	}
+
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return false, err
+	}
+
+	repo, err := NewAccessRepository(session)
+	if err != nil {
+		return false, err
+	}
+
+	granted, err := repo.GetByUserAndPlantGroup(user.Id, plantGroupId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return granted.Access.Includes(access), nil
+}
+
+// GrantPlantGroupAccess grants the authenticated user the given access to a plant group,
+// e.g. because they have just created it. Nothing is granted to users with unrestricted access.
+func GrantPlantGroupAccess(ctx context.Context, plantGroupId int64, access Access) error {
+	user, ok := UserFromContext(ctx)
+	if !ok || HasUnrestrictedAccess(user) {
+		return nil
+	}
+
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	repo, err := NewAccessRepository(session)
+	if err != nil {
+		return err
+	}
+
+	return repo.Save(user.Id, &PlantGroupAccess{PlantGroup: plantGroupId, Access: access})
+}
+
+// RevokePlantGroupAccess revokes the access of all users to a plant group, e.g. because it has been deleted.
+func RevokePlantGroupAccess(plantGroupId int64) error {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	repo, err := NewAccessRepository(session)
+	if err != nil {
+		return err
+	}
+
+	return repo.DeleteAllByPlantGroupId(plantGroupId)
+}
@@ -0,0 +1,25 @@
+package auth
+
+// AccessRepository provides access to the plant groups users are allowed to access.
+type AccessRepository interface {
+	// GetAllByUserId returns the access a user has to all plant groups.
+	GetAllByUserId(userId int64) ([]*PlantGroupAccess, error)
+
+	// GetByUserAndPlantGroup returns the access a user has to a single plant group.
+	GetByUserAndPlantGroup(userId int64, plantGroupId int64) (*PlantGroupAccess, error)
+
+	// Save grants a user access to a plant group. An existing access is replaced.
+	// It returns ErrUnknownPlantGroup if the plant group does not exist.
+	// Caution: This method does not use a transaction.
+	Save(userId int64, access *PlantGroupAccess) error
+
+	// SaveAllByUserId replaces the access of a user to all plant groups.
+	// Note: This method uses a transaction.
+	SaveAllByUserId(userId int64, accesses []*PlantGroupAccess) error
+
+	// DeleteAllByUserId revokes the access of a user to all plant groups.
+	DeleteAllByUserId(userId int64) error
+
+	// DeleteAllByPlantGroupId revokes the access of all users to a plant group.
+	DeleteAllByPlantGroupId(plantGroupId int64) error
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// userAccessHandler handles all requests to `/v1/user/{id}/plant-groups`.
+func userAccessHandler(w http.ResponseWriter, r *http.Request, userId int64) {
+	switch r.Method {
+	case http.MethodGet:
+		handleUserAccessGet(w, r, userId)
+	case http.MethodPut:
+		handleUserAccessPut(w, r, userId)
+	default:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET, PUT")
+	}
+}
+
+// handleUserAccessGet handles GET requests to the user access endpoint.
+func handleUserAccessGet(w http.ResponseWriter, r *http.Request, userId int64) {
+	accesses, err := getAccessByUserId(userId)
+	switch err {
+	case nil:
+		if accesses == nil {
+			accesses = make([]*PlantGroupAccess, 0)
+		}
+
+		b, err := json.Marshal(&PlantGroupAccessList{PlantGroups: accesses})
+		if err != nil {
+			msg := fmt.Sprintf("Error converting plant group access of user %d to JSON: %s", userId, err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		log.Printf("Loaded plant group access of user %d", userId)
+		utils.HttpOkResponse(w, b)
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("User with id %d not found", userId)
+		utils.HttpNotFoundResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error while loading plant group access of user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleUserAccessPut handles PUT requests to the user access endpoint.
+// It replaces the access of the user to all plant groups.
+func handleUserAccessPut(w http.ResponseWriter, r *http.Request, userId int64) {
+	var accessList PlantGroupAccessList
+	err := json.NewDecoder(r.Body).Decode(&accessList)
+	if err != nil {
+		msg := fmt.Sprintf("Error decoding plant group access of user %d: %s", userId, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	for _, access := range accessList.PlantGroups {
+		if !access.Access.IsValid() {
+			msg := fmt.Sprintf("Invalid access %q to plant group %d (allowed: read, write)", access.Access, access.PlantGroup)
+			utils.HttpBadRequestResponse(w, msg)
+			return
+		}
+	}
+
+	previous, err := getAccessByUserId(userId)
+	if err != nil && err != sql.ErrNoRows {
+		msg := fmt.Sprintf("Error while loading plant group access of user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	err = updateAccessByUserId(userId, accessList.PlantGroups)
+	switch err {
+	case nil:
+		RecordAudit(r, auditEntityAccess, userId, &PlantGroupAccessList{PlantGroups: previous}, &accessList)
+		handleUserAccessGet(w, r, userId)
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("User with id %d not found", userId)
+		utils.HttpNotFoundResponse(w, msg)
+	case ErrUnknownPlantGroup:
+		msg := fmt.Sprintf("Error while updating plant group access of user %d: %s", userId, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error while updating plant group access of user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// getAccessByUserId returns the access of a user to all plant groups.
+// It returns sql.ErrNoRows if the user does not exist.
+func getAccessByUserId(userId int64) ([]*PlantGroupAccess, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	userRepo, err := NewUserRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = userRepo.GetById(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	accessRepo, err := NewAccessRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return accessRepo.GetAllByUserId(userId)
+}
+
+// updateAccessByUserId replaces the access of a user to all plant groups.
+// It returns sql.ErrNoRows if the user does not exist.
+func updateAccessByUserId(userId int64, accesses []*PlantGroupAccess) error {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	userRepo, err := NewUserRepository(session)
+	if err != nil {
+		return err
+	}
+
+	_, err = userRepo.GetById(userId)
+	if err != nil {
+		return err
+	}
+
+	accessRepo, err := NewAccessRepository(session)
+	if err != nil {
+		return err
+	}
+
+	return accessRepo.SaveAllByUserId(userId, accesses)
+}
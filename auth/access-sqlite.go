@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// AccessSqliteRepository implements the AccessRepository interface.
+type AccessSqliteRepository struct {
+	db db.Querier
+}
+
+// NewAccessRepository creates a new AccessRepository.
+func NewAccessRepository(session *db.Session) (AccessRepository, error) {
+	if !session.IsOpen() {
+		return nil, errors.New("session is not open")
+	}
+
+	return &AccessSqliteRepository{
+		db: session.Querier(),
+	}, nil
+}
+
+// GetAllByUserId returns the access a user has to all plant groups.
+func (r *AccessSqliteRepository) GetAllByUserId(userId int64) ([]*PlantGroupAccess, error) {
+	rows, err := r.db.Query(`
+    SELECT
+        PGA.PLANT_GROUP,
+        PGA.ACCESS
+    FROM PLANT_GROUP_ACCESS PGA
+    WHERE PGA.USER = ?
+    ORDER BY PGA.PLANT_GROUP;`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accesses []*PlantGroupAccess
+	for rows.Next() {
+		var access PlantGroupAccess
+
+		err := rows.Scan(&access.PlantGroup, &access.Access)
+		if err != nil {
+			return nil, err
+		}
+
+		accesses = append(accesses, &access)
+	}
+
+	return accesses, nil
+}
+
+// GetByUserAndPlantGroup returns the access a user has to a single plant group.
+func (r *AccessSqliteRepository) GetByUserAndPlantGroup(userId int64, plantGroupId int64) (*PlantGroupAccess, error) {
+	var access PlantGroupAccess
+
+	err := r.db.QueryRow(`
+    SELECT
+        PGA.PLANT_GROUP,
+        PGA.ACCESS
+    FROM PLANT_GROUP_ACCESS PGA
+    WHERE PGA.USER = ?
+        AND PGA.PLANT_GROUP = ?;`, userId, plantGroupId).Scan(&access.PlantGroup, &access.Access)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &access, nil
+}
+
+// Save grants a user access to a plant group. An existing access is replaced.
+func (r *AccessSqliteRepository) Save(userId int64, access *PlantGroupAccess) error {
+	return saveAccess(r.db, userId, access)
+}
+
+// SaveAllByUserId replaces the access of a user to all plant groups.
+func (r *AccessSqliteRepository) SaveAllByUserId(userId int64, accesses []*PlantGroupAccess) error {
+	return db.Transaction(r.db, func(tx db.Querier) error {
+		_, err := tx.Exec(`DELETE FROM PLANT_GROUP_ACCESS WHERE USER = ?;`, userId)
+		if err != nil {
+			return err
+		}
+
+		for _, access := range accesses {
+			err = saveAccess(tx, userId, access)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteAllByUserId revokes the access of a user to all plant groups.
+func (r *AccessSqliteRepository) DeleteAllByUserId(userId int64) error {
+	_, err := r.db.Exec(`DELETE FROM PLANT_GROUP_ACCESS WHERE USER = ?;`, userId)
+	return err
+}
+
+// DeleteAllByPlantGroupId revokes the access of all users to a plant group.
+func (r *AccessSqliteRepository) DeleteAllByPlantGroupId(plantGroupId int64) error {
+	_, err := r.db.Exec(`DELETE FROM PLANT_GROUP_ACCESS WHERE PLANT_GROUP = ?;`, plantGroupId)
+	return err
+}
+
+// saveAccess stores the access of a user to a plant group, if the plant group exists.
+func saveAccess(q db.Querier, userId int64, access *PlantGroupAccess) error {
+	result, err := q.Exec(`
+    INSERT OR REPLACE INTO PLANT_GROUP_ACCESS (USER, PLANT_GROUP, ACCESS)
+        SELECT ?, PG.ID, ?
+        FROM PLANT_GROUP PG
+        WHERE PG.ID = ?;`, userId, access.Access, access.PlantGroup)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrUnknownPlantGroup
+	}
+
+	return nil
+}
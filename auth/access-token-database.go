@@ -0,0 +1,24 @@
+package auth
+
+import "time"
+
+// AccessTokenRepository provides access to the personal access tokens of users.
+type AccessTokenRepository interface {
+	// GetByToken returns the access token identified by the given token hash.
+	GetByToken(tokenHash string) (*AccessToken, error)
+
+	// GetAllByUserId returns all access tokens of the given user.
+	GetAllByUserId(userId int64) ([]*AccessToken, error)
+
+	// Create stores a new access token identified by the given token hash and returns it.
+	Create(token *AccessToken, tokenHash string) (*AccessToken, error)
+
+	// UpdateLastUsed records when an access token has been used.
+	UpdateLastUsed(id int64, lastUsed time.Time) error
+
+	// DeleteById deletes a single access token.
+	DeleteById(id int64) error
+
+	// DeleteAllByUserId deletes all access tokens of the given user.
+	DeleteAllByUserId(userId int64) error
+}
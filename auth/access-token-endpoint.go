@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// auditEntityAccessToken is the entity type of personal access tokens in the audit log.
+const auditEntityAccessToken = "access-token"
+
+// accessTokenPrefix distinguishes personal access tokens from session tokens.
+const accessTokenPrefix = "pbat_"
+
+// accessTokenLastUsedPrecision is how often the time a personal access token has been used is updated.
+const accessTokenLastUsedPrecision = time.Minute
+
+// meAccessTokensHandler handles all requests to `/v1/me/tokens` and `/v1/me/tokens/{id}`,
+// the personal access tokens of the authenticated user.
+func meAccessTokensHandler(w http.ResponseWriter, r *http.Request, user *SafeUser, segments []string) {
+	switch len(segments) {
+	case 0:
+		switch r.Method {
+		case http.MethodGet:
+			handleUserAccessTokensGet(w, r, user.Id)
+		case http.MethodPost:
+			handleMeAccessTokensPost(w, r, user)
+		default:
+			utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET, POST")
+		}
+	case 1:
+		accessTokenHandler(w, r, user.Id, segments[0])
+	default:
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("Unknown resource %s", r.URL.Path))
+	}
+}
+
+// userAccessTokensHandler handles all requests to `/v1/user/{id}/tokens` and `/v1/user/{id}/tokens/{tokenId}`.
+// Admins can list and revoke the personal access tokens of a user, but never create them.
+func userAccessTokensHandler(w http.ResponseWriter, r *http.Request, userId int64, segments []string) {
+	switch len(segments) {
+	case 0:
+		if r.Method != http.MethodGet {
+			utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET")
+			return
+		}
+		handleUserAccessTokensGet(w, r, userId)
+	case 1:
+		accessTokenHandler(w, r, userId, segments[0])
+	default:
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("Unknown resource %s", r.URL.Path))
+	}
+}
+
+// accessTokenHandler handles all requests to a single personal access token of a user.
+func accessTokenHandler(w http.ResponseWriter, r *http.Request, userId int64, segment string) {
+	tokenId, err := strconv.ParseInt(segment, 10, 64)
+	if err != nil {
+		utils.HttpBadRequestResponse(w, "No token id supplied")
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: DELETE")
+		return
+	}
+	handleUserAccessTokenDelete(w, r, userId, tokenId)
+}
+
+// handleUserAccessTokensGet handles GET requests to the personal access tokens of a user.
+func handleUserAccessTokensGet(w http.ResponseWriter, r *http.Request, userId int64) {
+	tokens, err := getAccessTokensByUserId(userId)
+	switch err {
+	case nil:
+		if tokens == nil {
+			tokens = make([]*AccessToken, 0)
+		}
+
+		b, err := json.Marshal(&AccessTokens{Tokens: tokens})
+		if err != nil {
+			msg := fmt.Sprintf("Error converting access tokens of user %d to JSON: %s", userId, err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		log.Printf("Loaded %d access tokens of user %d", len(tokens), userId)
+		utils.HttpOkResponse(w, b)
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("User with id %d not found", userId)
+		utils.HttpNotFoundResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error while loading access tokens of user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleMeAccessTokensPost handles POST requests to the personal access tokens of the authenticated user.
+// The token is only returned once. Tokens cannot be used to create further tokens.
+func handleMeAccessTokensPost(w http.ResponseWriter, r *http.Request, user *SafeUser) {
+	if user.scopes != nil {
+		utils.HttpForbiddenResponse(w, "Access tokens cannot be created with an access token")
+		return
+	}
+
+	var request AccessTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		msg := fmt.Sprintf("Error decoding access token of user %s: %s", user.Name, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	err = validateAccessTokenRequest(&request, user)
+	if err != nil {
+		msg := fmt.Sprintf("Error validating access token of user %s: %s", user.Name, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	issued, err := issueAccessToken(user.Id, &request)
+	if err != nil {
+		msg := fmt.Sprintf("Error creating access token of user %s: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	// Never record the token itself
+	RecordAudit(r, auditEntityAccessToken, issued.Id, nil, &issued.AccessToken)
+
+	b, err := json.Marshal(issued)
+	if err != nil {
+		msg := fmt.Sprintf("Error converting access token of user %s to JSON: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	msg := fmt.Sprintf("Created access token %d for user %s", issued.Id, user.Name)
+	location := fmt.Sprintf("/v1/me/tokens/%d", issued.Id)
+	utils.HttpCreatedResponse(w, b, location, msg)
+}
+
+// handleUserAccessTokenDelete handles DELETE requests to a single personal access token of a user.
+func handleUserAccessTokenDelete(w http.ResponseWriter, r *http.Request, userId int64, tokenId int64) {
+	tokens, err := getAccessTokensByUserId(userId)
+	if err != nil && err != sql.ErrNoRows {
+		msg := fmt.Sprintf("Error while loading access tokens of user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	for _, token := range tokens {
+		if token.Id == tokenId {
+			err = deleteAccessTokenById(tokenId)
+			if err != nil {
+				msg := fmt.Sprintf("Error while revoking access token %d: %s", tokenId, err.Error())
+				utils.HttpInternalServerErrorResponse(w, msg)
+				return
+			}
+
+			RecordAudit(r, auditEntityAccessToken, tokenId, token, nil)
+
+			log.Printf("Revoked access token %d of user %d", tokenId, userId)
+			utils.HttpOkResponse(w, nil)
+			return
+		}
+	}
+
+	msg := fmt.Sprintf("Access token with id %d of user %d not found", tokenId, userId)
+	utils.HttpNotFoundResponse(w, msg)
+}
+
+// getAccessTokensByUserId returns all personal access tokens of the given user.
+// It returns sql.ErrNoRows if the user does not exist.
+func getAccessTokensByUserId(userId int64) ([]*AccessToken, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	userRepo, err := NewUserRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = userRepo.GetById(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenRepo, err := NewAccessTokenRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenRepo.GetAllByUserId(userId)
+}
+
+// issueAccessToken creates a new personal access token for a user.
+// It returns the token in plain text, as only its hash is stored.
+func issueAccessToken(userId int64, request *AccessTokenRequest) (*IssuedAccessToken, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := NewAccessTokenRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	token = accessTokenPrefix + token
+
+	created, err := repo.Create(&AccessToken{
+		User:    userId,
+		Name:    request.Name,
+		Scopes:  request.Scopes,
+		Created: time.Now().UTC(),
+		Expires: request.Expires.UTC(),
+	}, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	return &IssuedAccessToken{AccessToken: *created, Token: token}, nil
+}
+
+// deleteAccessTokenById deletes a single personal access token.
+func deleteAccessTokenById(id int64) error {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	repo, err := NewAccessTokenRepository(session)
+	if err != nil {
+		return err
+	}
+
+	return repo.DeleteById(id)
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+)
+
+func TestSafeUserPermissionsScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       Role
+		scopes     []Permission
+		permission Permission
+		want       bool
+	}{
+		{"session", Gardener, nil, PlantsWrite, true},
+		{"in scope and role", Gardener, []Permission{SensorDataRead}, SensorDataRead, true},
+		{"in role, not in scope", Gardener, []Permission{SensorDataRead}, PlantsWrite, false},
+		{"in scope, not in role", Viewer, []Permission{PlantsRead, PlantsWrite}, PlantsWrite, false},
+		{"in scope, role demoted", Viewer, []Permission{UsersAdmin}, UsersAdmin, false},
+		{"admin in scope", Admin, []Permission{UsersAdmin}, UsersAdmin, true},
+		{"empty scopes", Admin, []Permission{}, OwnAccount, false},
+	}
+
+	for _, test := range tests {
+		user := &SafeUser{Name: "user", Role: test.role, scopes: test.scopes}
+		if got := user.HasPermission(test.permission); got != test.want {
+			t.Errorf("%s: got permission %s %t, want %t", test.name, test.permission, got, test.want)
+		}
+	}
+}
+
+func TestAccessTokenPermissions(t *testing.T) {
+	dbtest.Setup(t)
+
+	user, err := createUser(&User{Name: "script", Password: "", Role: Gardener, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issued, err := issueAccessToken(user.Id, &AccessTokenRequest{
+		Name:    "script",
+		Scopes:  []Permission{SensorDataRead, PlantsWrite},
+		Expires: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		role        Role
+		permissions []Permission
+	}{
+		{"gardener", Gardener, []Permission{PlantsWrite, SensorDataRead}},
+		{"demoted to viewer", Viewer, []Permission{SensorDataRead}},
+	}
+
+	for _, test := range tests {
+		dbtest.Exec(t, `UPDATE USERS SET ROLE = ? WHERE ID = ?;`, test.role, user.Id)
+
+		safeUser, err := authAccessToken(issued.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		permissions := safeUser.Permissions()
+		if len(permissions) != len(test.permissions) {
+			t.Errorf("%s: got permissions %v, want %v", test.name, permissions, test.permissions)
+			continue
+		}
+
+		for i := range permissions {
+			if permissions[i] != test.permissions[i] {
+				t.Errorf("%s: got permissions %v, want %v", test.name, permissions, test.permissions)
+				break
+			}
+		}
+	}
+}
+
+func TestAccessTokenCannotCreateAccessToken(t *testing.T) {
+	dbtest.Setup(t)
+	config.PlantBuddyConfig.Auth.AccessTokenMaxLifetime = config.Duration{Duration: 24 * time.Hour}
+
+	user, err := createUser(&User{Name: "script", Password: "", Role: Gardener, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := AccessTokenRequest{Name: "script", Scopes: []Permission{OwnAccount}, Expires: time.Now().Add(time.Hour)}
+	body, err := json.Marshal(&request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issued, err := issueAccessToken(user.Id, &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenUser, err := authAccessToken(issued.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		user   *SafeUser
+		status int
+	}{
+		{"access token", tokenUser, http.StatusForbidden},
+		{"session", user.safe(), http.StatusCreated},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/v1/me/tokens", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handleMeAccessTokensPost(w, r, test.user)
+
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d (%s), want %d", test.name, w.Code, w.Body.String(), test.status)
+		}
+	}
+}
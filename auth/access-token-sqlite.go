@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// AccessTokenSqliteRepository implements the AccessTokenRepository interface.
+// Timestamps are stored as unix seconds, scopes as comma-separated list.
+type AccessTokenSqliteRepository struct {
+	db db.Querier
+}
+
+// NewAccessTokenRepository creates a new AccessTokenRepository.
+func NewAccessTokenRepository(session *db.Session) (AccessTokenRepository, error) {
+	if !session.IsOpen() {
+		return nil, errors.New("session is not open")
+	}
+
+	return &AccessTokenSqliteRepository{
+		db: session.Querier(),
+	}, nil
+}
+
+// GetByToken returns the access token identified by the given token hash.
+func (r *AccessTokenSqliteRepository) GetByToken(tokenHash string) (*AccessToken, error) {
+	row := r.db.QueryRow(`
+    SELECT
+        T.ID,
+        T.USER,
+        T.NAME,
+        T.SCOPES,
+        T.CREATED,
+        T.EXPIRES,
+        T.LAST_USED
+    FROM ACCESS_TOKEN T
+    WHERE T.TOKEN = ?;`, tokenHash)
+
+	return scanAccessToken(row)
+}
+
+// GetAllByUserId returns all access tokens of the given user.
+func (r *AccessTokenSqliteRepository) GetAllByUserId(userId int64) ([]*AccessToken, error) {
+	rows, err := r.db.Query(`
+    SELECT
+        T.ID,
+        T.USER,
+        T.NAME,
+        T.SCOPES,
+        T.CREATED,
+        T.EXPIRES,
+        T.LAST_USED
+    FROM ACCESS_TOKEN T
+    WHERE T.USER = ?
+    ORDER BY T.ID;`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*AccessToken
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// Create stores a new access token identified by the given token hash and returns it.
+func (r *AccessTokenSqliteRepository) Create(token *AccessToken, tokenHash string) (*AccessToken, error) {
+	scopes := make([]string, len(token.Scopes))
+	for i, scope := range token.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	_, err := r.db.Exec(`
+    INSERT INTO ACCESS_TOKEN (USER, NAME, TOKEN, SCOPES, CREATED, EXPIRES)
+    VALUES (?, ?, ?, ?, ?, ?);`,
+		token.User,
+		token.Name,
+		tokenHash,
+		strings.Join(scopes, ","),
+		token.Created.Unix(),
+		token.Expires.Unix())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetByToken(tokenHash)
+}
+
+// UpdateLastUsed records when an access token has been used.
+func (r *AccessTokenSqliteRepository) UpdateLastUsed(id int64, lastUsed time.Time) error {
+	_, err := r.db.Exec(`
+    UPDATE ACCESS_TOKEN
+    SET LAST_USED = ?
+    WHERE ID = ?;`, lastUsed.Unix(), id)
+
+	return err
+}
+
+// DeleteById deletes a single access token.
+func (r *AccessTokenSqliteRepository) DeleteById(id int64) error {
+	_, err := r.db.Exec(`
+    DELETE FROM ACCESS_TOKEN
+    WHERE ID = ?;`, id)
+
+	return err
+}
+
+// DeleteAllByUserId deletes all access tokens of the given user.
+func (r *AccessTokenSqliteRepository) DeleteAllByUserId(userId int64) error {
+	_, err := r.db.Exec(`
+    DELETE FROM ACCESS_TOKEN
+    WHERE USER = ?;`, userId)
+
+	return err
+}
+
+// scanAccessToken reads an access token from a single row.
+func scanAccessToken(row interface{ Scan(dest ...any) error }) (*AccessToken, error) {
+	var id int64
+	var user int64
+	var name string
+	var scopes string
+	var created int64
+	var expires int64
+	var lastUsed sql.NullInt64
+
+	err := row.Scan(&id, &user, &name, &scopes, &created, &expires, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &AccessToken{
+		Id:      id,
+		User:    user,
+		Name:    name,
+		Scopes:  make([]Permission, 0),
+		Created: time.Unix(created, 0).UTC(),
+		Expires: time.Unix(expires, 0).UTC(),
+	}
+
+	for _, scope := range strings.Split(scopes, ",") {
+		if scope != "" {
+			token.Scopes = append(token.Scopes, Permission(scope))
+		}
+	}
+
+	if lastUsed.Valid {
+		used := time.Unix(lastUsed.Int64, 0).UTC()
+		token.LastUsed = &used
+	}
+
+	return token, nil
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/plantineers/plantbuddy-server/audit"
+)
+
+// Entity types of the audit log entries recorded by this package.
+const (
+	auditEntityUser     = "user"
+	auditEntitySession  = "session"
+	auditEntityAccess   = "plant-group-access"
+	auditEntityLockout  = "lockout"
+	auditEntityPassword = "password"
+)
+
+// RecordAudit appends a mutating API call made by the authenticated user or controller to the audit log.
+// See audit.Record for the meaning of before and after.
+func RecordAudit(r *http.Request, entityType string, entityId any, before any, after any) {
+	audit.Record(r, actorFromRequest(r), entityType, entityId, before, after)
+}
+
+// actorFromRequest returns who made the request, as authenticated by the middleware.
+func actorFromRequest(r *http.Request) audit.Actor {
+	if user, ok := UserFromContext(r.Context()); ok {
+		return audit.Actor{User: user.Id, Name: user.Name}
+	}
+
+	if uuid, ok := ControllerFromContext(r.Context()); ok {
+		return audit.Actor{Name: uuid}
+	}
+
+	return audit.Actor{Name: "anonymous"}
+}
@@ -0,0 +1,33 @@
+package auth
+
+import "context"
+
+// contextKey is the type of all keys this package stores in a request context.
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	controllerContextKey
+)
+
+// UserFromContext returns the user that has been authenticated by the middleware.
+func UserFromContext(ctx context.Context) (*SafeUser, bool) {
+	user, ok := ctx.Value(userContextKey).(*SafeUser)
+	return user, ok
+}
+
+// ControllerFromContext returns the UUID of the controller that has been authenticated by the middleware.
+func ControllerFromContext(ctx context.Context) (string, bool) {
+	uuid, ok := ctx.Value(controllerContextKey).(string)
+	return uuid, ok
+}
+
+// withUser returns a copy of the context holding the given user.
+func withUser(ctx context.Context, user *SafeUser) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// withController returns a copy of the context holding the given controller UUID.
+func withController(ctx context.Context, uuid string) context.Context {
+	return context.WithValue(ctx, controllerContextKey, uuid)
+}
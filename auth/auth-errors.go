@@ -6,5 +6,20 @@ import "errors"
 var ErrWrongCredentials = errors.New("wrong credentials")
 var ErrNoCredentials = errors.New("no credentials supplied")
 var ErrInvalidAuthHeader = errors.New("invalid authorization header")
-var ErrCannotDeleteRoot = errors.New("cannot delete root user")
+var ErrProtectedUser = errors.New("user is protected")
 var ErrUserAlreadyExists = errors.New("user already exists")
+var ErrInvalidToken = errors.New("invalid or expired token")
+var ErrInvalidControllerKey = errors.New("invalid controller key")
+var ErrReplayedControllerMessage = errors.New("message counter of controller has not increased")
+var ErrNoMessageSecret = errors.New("no secret to derive message keys from configured")
+var ErrUnknownPlantGroup = errors.New("plant group does not exist")
+var ErrTooManyAttempts = errors.New("too many failed attempts")
+var ErrLastAdmin = errors.New("cannot remove the last admin")
+var ErrUnknownIdentity = errors.New("identity is not linked to any user")
+var ErrTotpRequired = errors.New("TOTP code required")
+var ErrInvalidTotpCode = errors.New("invalid TOTP code")
+var ErrTotpAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTotpNotEnabled = errors.New("two-factor authentication is not enabled")
+var ErrTotpEnforced = errors.New("two-factor authentication is required for this user")
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+var ErrUserDisabled = errors.New("user is disabled")
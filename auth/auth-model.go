@@ -1,20 +1,65 @@
 // Author: Maximilian Floto
 package auth
 
+import "time"
+
 // User represents a user in the database and is used internally only.
 type User struct {
-	Id       int64  `json:"id"`
-	Name     string `json:"name"`
-	Password string `json:"password"`
-	Role     Role   `json:"role"`
+	Id        int64  `json:"id"`
+	Name      string `json:"name"`
+	Password  string `json:"password"`
+	Role      Role   `json:"role"`
+	Enabled   bool   `json:"enabled"`   // Disabled users cannot authenticate
+	Protected bool   `json:"protected"` // Protected users can neither be deleted nor disabled
 }
 
 // SafeUser represents a user in the database and is used for the API.
 // It does not contain the password hash.
 type SafeUser struct {
-	Id   int64  `json:"id"`
-	Name string `json:"name"`
-	Role Role   `json:"role"`
+	Id        int64  `json:"id"`
+	Name      string `json:"name"`
+	Role      Role   `json:"role"`
+	Enabled   bool   `json:"enabled"`
+	Protected bool   `json:"protected"`
+
+	// totpPending is set if the user has to enable two-factor authentication before
+	// they may use any other permission than OwnAccount.
+	totpPending bool
+
+	// scopes limit the permissions of a user authenticated by a personal access token (nil = not limited).
+	scopes []Permission
+}
+
+// safe returns the user without the password hash.
+func (u *User) safe() *SafeUser {
+	return &SafeUser{
+		Id:        u.Id,
+		Name:      u.Name,
+		Role:      u.Role,
+		Enabled:   u.Enabled,
+		Protected: u.Protected,
+	}
+}
+
+// UserPatch represents a partial update of a user. Omitted (nil) fields are left untouched.
+type UserPatch struct {
+	Name      *string `json:"name"`
+	Password  *string `json:"password"`
+	Role      *Role   `json:"role"`
+	Enabled   *bool   `json:"enabled"`
+	Protected *bool   `json:"protected"`
+}
+
+// Profile represents the authenticated user along with their permissions.
+type Profile struct {
+	SafeUser
+	Permissions []Permission `json:"permissions"`
+}
+
+// PasswordChange represents a request of the authenticated user to change their password.
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
 }
 
 // Users represents a list of users.
@@ -22,9 +67,177 @@ type Users struct {
 	Users []string `json:"users"`
 }
 
+// UsersOverview represents a page of users along with the number of all users matching the filter.
+type UsersOverview struct {
+	Users  []*SafeUser `json:"users"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+type usersFilter struct {
+	Role       Role   // Only users with this role (see HasRole)
+	HasRole    bool   // False if users of all roles are returned
+	NamePrefix string // Only users whose name starts with this prefix (case-insensitive)
+	Sort       string // Field to sort by (see userSortColumns), prefixed with "-" for descending order
+	Limit      int
+	Offset     int
+}
+
+// Session represents a login session of a user.
+// The token itself is only handed out once on login and never stored in plain text.
+type Session struct {
+	Id      int64     `json:"id"`
+	User    int64     `json:"user"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// Sessions represents a list of sessions.
+type Sessions struct {
+	Sessions []*Session `json:"sessions"`
+}
+
+// Login represents a successful login.
+// It contains the bearer token to use for all further requests.
+type Login struct {
+	SafeUser
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// ControllerKey represents the API key a micro-controller uses to authenticate.
+// Like session tokens, the key itself is only handed out once and never stored in plain text.
+type ControllerKey struct {
+	Controller string    `json:"controller"`
+	Created    time.Time `json:"created"`
+}
+
+// IssuedControllerKey represents a newly issued API key including the key itself.
+// If UDP packets can be authenticated, the key to authenticate them with is included as hex string.
+type IssuedControllerKey struct {
+	ControllerKey
+	Key        string `json:"key"`
+	MessageKey string `json:"messageKey,omitempty"`
+}
+
+// Lockout represents the failed login attempts of a user.
+type Lockout struct {
+	User           int64      `json:"user"`
+	FailedAttempts int        `json:"failedAttempts"`
+	BlockedUntil   *time.Time `json:"blockedUntil,omitempty"` // Missing if the user may log in
+}
+
+// AccessToken represents a personal access token of a user for scripts and the like.
+// Like session tokens, the token itself is only handed out once and never stored in plain text.
+type AccessToken struct {
+	Id       int64        `json:"id"`
+	User     int64        `json:"user"`
+	Name     string       `json:"name"`
+	Scopes   []Permission `json:"scopes"`
+	Created  time.Time    `json:"created"`
+	Expires  time.Time    `json:"expires"`
+	LastUsed *time.Time   `json:"lastUsed,omitempty"` // Missing if the token has never been used
+}
+
+// AccessTokens represents a list of personal access tokens.
+type AccessTokens struct {
+	Tokens []*AccessToken `json:"tokens"`
+}
+
+// IssuedAccessToken represents a newly created personal access token including the token itself.
+type IssuedAccessToken struct {
+	AccessToken
+	Token string `json:"token"`
+}
+
+// AccessTokenRequest represents a request of the authenticated user to create a personal access token.
+type AccessTokenRequest struct {
+	Name    string       `json:"name"`
+	Scopes  []Permission `json:"scopes"`
+	Expires time.Time    `json:"expires"`
+}
+
+// IssuedPasswordReset represents a newly issued password reset token. Like session tokens, the token itself
+// is only handed out once and never stored in plain text.
+type IssuedPasswordReset struct {
+	User    int64     `json:"user"`
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// PasswordReset represents a request to set a new password with a reset token.
+type PasswordReset struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// Totp represents the TOTP secret of a user and is used internally only.
+type Totp struct {
+	User     int64
+	Secret   string
+	Enabled  bool // False until the first code has been verified
+	LastStep int64
+	Created  time.Time
+}
+
+// TotpStatus represents whether a user has enabled two-factor authentication.
+type TotpStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+// TotpEnrollment represents a new TOTP secret. The URI can be scanned as QR code by authenticator apps.
+type TotpEnrollment struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+}
+
+// TotpConfirmation represents a TOTP or recovery code confirming a change of two-factor authentication.
+type TotpConfirmation struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodes represents the recovery codes of a user. They are only handed out once.
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// PlantGroupAccess represents the access a user has to a plant group.
+type PlantGroupAccess struct {
+	PlantGroup int64  `json:"plantGroup"`
+	Access     Access `json:"access"`
+}
+
+// PlantGroupAccessList represents a list of plant group accesses.
+type PlantGroupAccessList struct {
+	PlantGroups []*PlantGroupAccess `json:"plantGroups"`
+}
+
+// Access is the level of access a user has to a plant group.
+type Access string
+
+const (
+	ReadAccess  Access = "read"
+	WriteAccess Access = "write"
+)
+
+// Includes returns true if the access level includes the other one.
+// Write access always includes read access.
+func (a Access) Includes(other Access) bool {
+	return a == WriteAccess || a == other
+}
+
+// IsValid returns true if the access level is known.
+func (a Access) IsValid() bool {
+	return a == ReadAccess || a == WriteAccess
+}
+
 type Role int8
 
 const (
 	Admin Role = iota
 	Gardener
+	Viewer
 )
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+)
+
+// failedAttempts holds the failed authentication attempts of a user name or client IP.
+type failedAttempts struct {
+	count        int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	pending      int // Attempts reserved but not decided yet
+}
+
+// attemptLimit is a key of the attempt tracker with the number of its free attempts.
+type attemptLimit struct {
+	key          string
+	freeAttempts int
+}
+
+// attemptTracker counts failed authentication attempts in memory.
+// Keys are prefixed with "user:" or "ip:" (see userAttemptKey and ipAttemptKey).
+type attemptTracker struct {
+	mu        sync.Mutex
+	attempts  map[string]*failedAttempts
+	lastPrune time.Time
+}
+
+// loginAttempts tracks all failed attempts to authenticate with a password or a token.
+var loginAttempts = &attemptTracker{attempts: make(map[string]*failedAttempts)}
+
+// pruneInterval is the minimum time between two runs removing outdated entries.
+const pruneInterval = time.Minute
+
+// pendingRetryAfter is the time clients are asked to wait if they are only refused because of an attempt in flight.
+const pendingRetryAfter = time.Second
+
+// userAttemptKey returns the key of a user name in the attempt tracker.
+func userAttemptKey(name string) string {
+	return "user:" + name
+}
+
+// ipAttemptKey returns the key of the client IP of a request in the attempt tracker.
+func ipAttemptKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// blockedFor returns how long authentication attempts of the given keys are blocked (0 = not blocked).
+func (t *attemptTracker) blockedFor(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var blocked time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		attempts, ok := t.attempts[key]
+		if ok && attempts.blockedUntil.After(now) && attempts.blockedUntil.Sub(now) > blocked {
+			blocked = attempts.blockedUntil.Sub(now)
+		}
+	}
+
+	return blocked
+}
+
+// reserve checks that attempts of all keys are allowed and reserves one for each of them under the same lock, so
+// concurrent requests cannot all pass the check before the first failure has been recorded. Once a key has failed,
+// reserved attempts count against its free attempts until they are released, and once they are used up, only a
+// single attempt may be in flight after each delay. Keys without failures are never refused, so concurrent valid
+// requests do not lock each other out. The returned function releases the reservation and has to be called once the
+// attempt has been decided, after recording it as failure if it failed.
+func (t *attemptTracker) reserve(limits ...attemptLimit) (func(), bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.prune(now)
+
+	reserved := make([]*failedAttempts, len(limits))
+	for i, limit := range limits {
+		attempts := t.current(limit.key, now)
+		if attempts.blockedUntil.After(now) {
+			return nil, false
+		}
+
+		if attempts.count > 0 && attempts.pending > 0 && attempts.count+attempts.pending >= limit.freeAttempts {
+			return nil, false
+		}
+
+		reserved[i] = attempts
+	}
+
+	for _, attempts := range reserved {
+		attempts.pending++
+	}
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		for _, attempts := range reserved {
+			attempts.pending--
+		}
+	}, true
+}
+
+// current returns the entry of the key, creating it if necessary. Failures older than the configured reset time
+// are forgotten. The caller must hold the lock.
+func (t *attemptTracker) current(key string, now time.Time) *failedAttempts {
+	attempts, ok := t.attempts[key]
+	if !ok {
+		attempts = &failedAttempts{}
+		t.attempts[key] = attempts
+	} else if now.Sub(attempts.lastFailure) > config.PlantBuddyConfig.Auth.BruteForce.ResetAfter.Duration {
+		attempts.count = 0
+	}
+
+	return attempts
+}
+
+// recordFailure counts a failed attempt for the key. After the given number of free attempts, further attempts
+// are blocked with an exponential delay. Once the key reaches the given lockout attempts (0 = never), it is
+// blocked for the configured lockout duration.
+func (t *attemptTracker) recordFailure(key string, freeAttempts int, lockoutAttempts int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cfg := config.PlantBuddyConfig.Auth.BruteForce
+	now := time.Now()
+	t.prune(now)
+
+	attempts := t.current(key, now)
+	attempts.count++
+	attempts.lastFailure = now
+
+	if lockoutAttempts > 0 && attempts.count >= lockoutAttempts {
+		attempts.blockedUntil = now.Add(cfg.LockoutDuration.Duration)
+		log.Printf("Locked %s until %s after %d failed attempts", key, attempts.blockedUntil.Format(time.RFC3339), attempts.count)
+		return
+	}
+
+	if attempts.count > freeAttempts {
+		attempts.blockedUntil = now.Add(backOff(attempts.count-freeAttempts, cfg))
+	}
+}
+
+// backOff returns the delay after the given number of delayed attempts: baseDelay * 2^(n-1), capped at maxDelay.
+func backOff(n int, cfg config.BruteForce) time.Duration {
+	delay := cfg.BaseDelay.Duration
+	for i := 1; i < n && delay < cfg.MaxDelay.Duration; i++ {
+		delay *= 2
+	}
+
+	if delay > cfg.MaxDelay.Duration {
+		return cfg.MaxDelay.Duration
+	}
+
+	return delay
+}
+
+// reset forgets all failed attempts of the given keys, e.g. after a successful login.
+func (t *attemptTracker) reset(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		delete(t.attempts, key)
+	}
+}
+
+// status returns the number of failed attempts of the key and until when it is blocked.
+func (t *attemptTracker) status(key string) (int, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	attempts, ok := t.attempts[key]
+	if !ok || time.Since(attempts.lastFailure) > config.PlantBuddyConfig.Auth.BruteForce.ResetAfter.Duration {
+		return 0, time.Time{}
+	}
+
+	return attempts.count, attempts.blockedUntil
+}
+
+// prune removes entries that are neither blocked nor counted anymore, so the map does not grow forever.
+// The caller must hold the lock.
+func (t *attemptTracker) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < pruneInterval {
+		return
+	}
+
+	resetAfter := config.PlantBuddyConfig.Auth.BruteForce.ResetAfter.Duration
+	for key, attempts := range t.attempts {
+		if attempts.pending == 0 && attempts.blockedUntil.Before(now) && now.Sub(attempts.lastFailure) > resetAfter {
+			delete(t.attempts, key)
+		}
+	}
+
+	t.lastPrune = now
+}
+
+// reserveLogin reserves a password attempt for both the user name and the client IP (see attemptTracker.reserve).
+func reserveLogin(r *http.Request, name string) (func(), bool) {
+	cfg := config.PlantBuddyConfig.Auth.BruteForce
+	return loginAttempts.reserve(
+		attemptLimit{key: userAttemptKey(name), freeAttempts: cfg.FreeAttempts},
+		attemptLimit{key: ipAttemptKey(r), freeAttempts: cfg.FreeAttemptsPerIp},
+	)
+}
+
+// tokenAttemptAllowed returns true unless the client IP is blocked from authenticating with a token.
+// Nothing is reserved, as tokens are too long to be guessed by racing the failures being recorded.
+func tokenAttemptAllowed(r *http.Request) bool {
+	return loginAttempts.blockedFor(ipAttemptKey(r)) == 0
+}
+
+// recordFailedLogin counts a wrong password for both the user name and the client IP.
+// Only the user name can be locked.
+func recordFailedLogin(r *http.Request, name string) {
+	cfg := config.PlantBuddyConfig.Auth.BruteForce
+	loginAttempts.recordFailure(userAttemptKey(name), cfg.FreeAttempts, cfg.LockoutAttempts)
+	loginAttempts.recordFailure(ipAttemptKey(r), cfg.FreeAttemptsPerIp, 0)
+}
+
+// recordFailedToken counts an invalid bearer token for the client IP.
+func recordFailedToken(r *http.Request) {
+	cfg := config.PlantBuddyConfig.Auth.BruteForce
+	loginAttempts.recordFailure(ipAttemptKey(r), cfg.FreeAttemptsPerIp, 0)
+}
+
+// retryAfter returns how long the client of the request has to wait before trying to authenticate again.
+func retryAfter(r *http.Request) time.Duration {
+	keys := []string{ipAttemptKey(r)}
+	if name, _, ok := r.BasicAuth(); ok {
+		keys = append(keys, userAttemptKey(name))
+	}
+
+	blocked := loginAttempts.blockedFor(keys...)
+	if blocked == 0 { // Refused because of an attempt in flight
+		return pendingRetryAfter
+	}
+
+	return blocked
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+)
+
+// setupTestBruteForce configures the brute-force protection with delays long enough not to expire during a test.
+func setupTestBruteForce(t *testing.T) config.BruteForce {
+	t.Helper()
+
+	cfg := config.BruteForce{
+		FreeAttempts:      3,
+		FreeAttemptsPerIp: 20,
+		BaseDelay:         config.Duration{Duration: time.Minute},
+		MaxDelay:          config.Duration{Duration: time.Hour},
+		LockoutAttempts:   10,
+		LockoutDuration:   config.Duration{Duration: 24 * time.Hour},
+		ResetAfter:        config.Duration{Duration: 48 * time.Hour},
+	}
+	config.PlantBuddyConfig.Auth.BruteForce = cfg
+	return cfg
+}
+
+func newTestAttemptTracker() *attemptTracker {
+	return &attemptTracker{attempts: make(map[string]*failedAttempts)}
+}
+
+func TestBackOff(t *testing.T) {
+	cfg := config.BruteForce{
+		BaseDelay: config.Duration{Duration: time.Second},
+		MaxDelay:  config.Duration{Duration: 5 * time.Minute},
+	}
+
+	tests := []struct {
+		n     int
+		delay time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{8, 128 * time.Second},
+		{9, 256 * time.Second},
+		{10, 5 * time.Minute},
+		{1000, 5 * time.Minute},
+	}
+
+	for _, test := range tests {
+		if delay := backOff(test.n, cfg); delay != test.delay {
+			t.Errorf("n = %d: got delay %s, want %s", test.n, delay, test.delay)
+		}
+	}
+}
+
+func TestRecordFailure(t *testing.T) {
+	cfg := setupTestBruteForce(t)
+
+	tests := []struct {
+		failures int
+		blocked  time.Duration // Expected block, rounded to minutes
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Minute},
+		{5, 2 * time.Minute},
+		{6, 4 * time.Minute},
+		{9, 32 * time.Minute},
+		{10, 24 * time.Hour}, // Locked out
+	}
+
+	for _, test := range tests {
+		tracker := newTestAttemptTracker()
+		for i := 0; i < test.failures; i++ {
+			tracker.recordFailure("user:alice", cfg.FreeAttempts, cfg.LockoutAttempts)
+		}
+
+		blocked := tracker.blockedFor("user:alice").Round(time.Minute)
+		if blocked != test.blocked {
+			t.Errorf("%d failures: got blocked for %s, want %s", test.failures, blocked, test.blocked)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	cfg := setupTestBruteForce(t)
+
+	tests := []struct {
+		name     string
+		failures int // Failures recorded before the concurrent attempts
+		blocked  bool
+		allowed  int // Number of concurrent attempts that may be in flight
+	}{
+		{"no failures", 0, false, 50},
+		{"some failures", 2, false, 1},
+		{"free attempts used up", 3, false, 1},
+		{"blocked", 4, true, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := newTestAttemptTracker()
+			for i := 0; i < test.failures; i++ {
+				tracker.recordFailure("user:alice", cfg.FreeAttempts, 0)
+			}
+
+			// The delay has expired, but failures are still counted
+			if !test.blocked && test.failures > 0 {
+				tracker.attempts["user:alice"].blockedUntil = time.Time{}
+			}
+
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			var releases []func()
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					release, ok := tracker.reserve(attemptLimit{key: "user:alice", freeAttempts: cfg.FreeAttempts})
+					if ok {
+						mu.Lock()
+						releases = append(releases, release)
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			if len(releases) != test.allowed {
+				t.Fatalf("got %d attempts in flight, want %d", len(releases), test.allowed)
+			}
+
+			// Each failed attempt in flight is counted before the next one is allowed
+			for _, release := range releases {
+				tracker.recordFailure("user:alice", cfg.FreeAttempts, 0)
+				release()
+			}
+
+			if count, _ := tracker.status("user:alice"); count != test.failures+test.allowed {
+				t.Errorf("got %d failures, want %d", count, test.failures+test.allowed)
+			}
+		})
+	}
+}
+
+func TestReserveAllKeys(t *testing.T) {
+	cfg := setupTestBruteForce(t)
+	tracker := newTestAttemptTracker()
+
+	for i := 0; i <= cfg.FreeAttemptsPerIp; i++ {
+		tracker.recordFailure("ip:192.0.2.1", cfg.FreeAttemptsPerIp, 0)
+	}
+
+	// A blocked client IP refuses attempts on any user name without reserving the user name
+	_, ok := tracker.reserve(
+		attemptLimit{key: "user:alice", freeAttempts: cfg.FreeAttempts},
+		attemptLimit{key: "ip:192.0.2.1", freeAttempts: cfg.FreeAttemptsPerIp},
+	)
+	if ok {
+		t.Fatal("attempt from blocked client IP has been allowed")
+	}
+
+	if attempts := tracker.attempts["user:alice"]; attempts != nil && attempts.pending != 0 {
+		t.Errorf("got %d pending attempts of user name, want 0", attempts.pending)
+	}
+
+	release, ok := tracker.reserve(
+		attemptLimit{key: "user:alice", freeAttempts: cfg.FreeAttempts},
+		attemptLimit{key: "ip:192.0.2.2", freeAttempts: cfg.FreeAttemptsPerIp},
+	)
+	if !ok {
+		t.Fatal("attempt from other client IP has been refused")
+	}
+	release()
+
+	if pending := tracker.attempts["user:alice"].pending; pending != 0 {
+		t.Errorf("got %d pending attempts after release, want 0", pending)
+	}
+}
+
+// newTestTokenRequest returns a request from the given client IP.
+func newTestTokenRequest(ip string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/v1/me", nil)
+	r.RemoteAddr = ip + ":1234"
+	return r
+}
+
+func TestTokenAttemptAllowed(t *testing.T) {
+	cfg := setupTestBruteForce(t)
+	previous := loginAttempts
+	loginAttempts = newTestAttemptTracker()
+	t.Cleanup(func() { loginAttempts = previous })
+
+	blocked := newTestTokenRequest("192.0.2.1")
+	for i := 0; i < cfg.FreeAttemptsPerIp; i++ {
+		recordFailedToken(blocked)
+		if !tokenAttemptAllowed(blocked) {
+			t.Fatalf("refused after %d failures, want %d free attempts", i+1, cfg.FreeAttemptsPerIp)
+		}
+	}
+
+	recordFailedToken(blocked)
+	if tokenAttemptAllowed(blocked) {
+		t.Error("allowed after the free attempts have been used up")
+	}
+
+	if !tokenAttemptAllowed(newTestTokenRequest("192.0.2.2")) {
+		t.Error("refused another client IP")
+	}
+}
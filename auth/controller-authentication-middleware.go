@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// ControllerAuthMiddleware authenticates micro-controllers by their API key (`Authorization: ApiKey <key>`).
+// Controllers only have the permissions in controllerPermissions. All other requests are passed to
+// UserAuthMiddleware.
+func ControllerAuthMiddleware(f func(http.ResponseWriter, *http.Request), permissions RoutePermissions) http.Handler {
+	userHandler := UserAuthMiddleware(f, permissions)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler := http.HandlerFunc(f)
+
+		scheme, key := splitAuthHeader(r)
+		if scheme != "ApiKey" {
+			userHandler.ServeHTTP(w, r)
+			return
+		}
+
+		permission, ok := requiredPermission(w, r, permissions)
+		if !ok {
+			return
+		}
+
+		uuid, err := authController(key)
+		switch err {
+		case ErrInvalidControllerKey:
+			utils.HttpForbiddenResponse(w, "Invalid controller key")
+		case nil:
+			if !containsPermission(controllerPermissions, permission) {
+				msg := fmt.Sprintf("Insufficient permissions (%s required)", permission)
+				utils.HttpForbiddenResponse(w, msg)
+				return
+			}
+
+			// Pass the controller down to the handler
+			handler.ServeHTTP(w, r.WithContext(withController(r.Context(), uuid)))
+		default:
+			msg := fmt.Sprintf("Error authenticating controller: %s", err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+		}
+	})
+}
+
+// authController authorizes a micro-controller by its API key and returns its UUID.
+func authController(key string) (string, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return "", err
+	}
+
+	repo, err := NewControllerKeyRepository(session)
+	if err != nil {
+		return "", err
+	}
+
+	controllerKey, err := repo.GetByKey(utils.HashToken(key))
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidControllerKey
+	} else if err != nil {
+		return "", err
+	}
+
+	return controllerKey.Controller, nil
+}
+
+// AuthControllerMessage authenticates a message of a micro-controller sent without HTTP, e.g. via UDP, and records its
+// counter, which must increase with every message. Instead of the API key itself, the controller sends an HMAC-SHA256
+// of the message keyed with its message key (see ControllerMessageKey). The MAC may be truncated, but must be at least
+// 16 bytes long. It returns ErrReplayedControllerMessage if the message is authentic, but its counter has not increased.
+func AuthControllerMessage(uuid string, counter uint32, message []byte, mac []byte) error {
+	if len(mac) < 16 {
+		return ErrInvalidControllerKey
+	}
+
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	repo, err := NewControllerKeyRepository(session)
+	if err != nil {
+		return err
+	}
+
+	keyHash, err := repo.GetHashByController(uuid)
+	if err == sql.ErrNoRows {
+		return ErrInvalidControllerKey
+	} else if err != nil {
+		return err
+	}
+
+	key, err := ControllerMessageKey(keyHash)
+	if err != nil {
+		return err
+	}
+
+	expected := hmac.New(sha256.New, key)
+	expected.Write(message)
+	if len(mac) > expected.Size() || !hmac.Equal(expected.Sum(nil)[:len(mac)], mac) {
+		return ErrInvalidControllerKey
+	}
+
+	advanced, err := repo.AdvanceMessageCounter(uuid, counter)
+	if err != nil {
+		return err
+	}
+
+	if !advanced {
+		return ErrReplayedControllerMessage
+	}
+
+	return nil
+}
+
+// ControllerMessageKey derives the key a controller authenticates messages sent without HTTP with from the hash of
+// its API key and the configured `udp.secret`. As the secret is not stored in the database, a leaked database is not
+// enough to forge messages. Issuing a new API key derives a new message key.
+func ControllerMessageKey(keyHash string) ([]byte, error) {
+	secret := config.PlantBuddyConfig.Udp.Secret
+	if secret == "" {
+		return nil, ErrNoMessageSecret
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(keyHash))
+	return mac.Sum(nil), nil
+}
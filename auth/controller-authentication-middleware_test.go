@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// testController is a controller added to the test database by setupTestControllerKey.
+const testController = "11111111-1111-1111-1111-111111111111"
+
+// setupTestControllerKey adds the test controller with the given API key and returns its message key.
+func setupTestControllerKey(t *testing.T, key string) []byte {
+	t.Helper()
+
+	dbtest.Exec(t, `INSERT INTO CONTROLLER (UUID, PLANT_GROUP) VALUES (?, 1);`, testController)
+	return saveTestControllerKey(t, key)
+}
+
+// saveTestControllerKey issues the given API key to the test controller and returns its message key.
+func saveTestControllerKey(t *testing.T, key string) []byte {
+	t.Helper()
+
+	session := db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewControllerKeyRepository(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyHash := utils.HashToken(key)
+	err = repo.Save(&ControllerKey{Controller: testController, Created: time.Now()}, keyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messageKey, err := ControllerMessageKey(keyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return messageKey
+}
+
+// signTestMessage returns the HMAC-SHA256 of the message keyed with the given message key.
+func signTestMessage(messageKey []byte, message string) []byte {
+	mac := hmac.New(sha256.New, messageKey)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+func TestAuthController(t *testing.T) {
+	dbtest.Setup(t)
+	config.PlantBuddyConfig.Udp.Secret = "secret"
+	setupTestControllerKey(t, "key")
+
+	tests := []struct {
+		key string
+		err error
+	}{
+		{"key", nil},
+		{"other", ErrInvalidControllerKey},
+		{"", ErrInvalidControllerKey},
+	}
+
+	for _, test := range tests {
+		uuid, err := authController(test.key)
+		if err != test.err || (err == nil && uuid != testController) {
+			t.Errorf("%q: got controller %q and error %v, want error %v", test.key, uuid, err, test.err)
+		}
+	}
+}
+
+func TestAuthControllerMessage(t *testing.T) {
+	dbtest.Setup(t)
+	config.PlantBuddyConfig.Udp.Secret = "secret"
+	messageKey := setupTestControllerKey(t, "key")
+
+	const message = "humidity=40"
+	mac := signTestMessage(messageKey, message)
+	otherKey := hmac.New(sha256.New, []byte("other")).Sum(nil)
+
+	// Each step depends on the counter recorded by the previous ones
+	steps := []struct {
+		name       string
+		controller string
+		counter    uint32
+		message    string
+		mac        []byte
+		err        error
+	}{
+		{"first message", testController, 1, message, mac, nil},
+		{"replayed", testController, 1, message, mac, ErrReplayedControllerMessage},
+		{"older counter", testController, 0, message, mac, ErrReplayedControllerMessage},
+		{"truncated MAC", testController, 2, message, mac[:16], nil},
+		{"MAC too short", testController, 3, message, mac[:15], ErrInvalidControllerKey},
+		{"MAC too long", testController, 3, message, append(mac[:len(mac):len(mac)], 0), ErrInvalidControllerKey},
+		{"tampered message", testController, 3, "humidity=41", mac, ErrInvalidControllerKey},
+		{"other key", testController, 3, message, signTestMessage(otherKey, message), ErrInvalidControllerKey},
+		{"unknown controller", "22222222-2222-2222-2222-222222222222", 3, message, mac, ErrInvalidControllerKey},
+		{"counter skipped", testController, 10, message, mac, nil},
+	}
+
+	for _, step := range steps {
+		err := AuthControllerMessage(step.controller, step.counter, []byte(step.message), step.mac)
+		if err != step.err {
+			t.Errorf("%s: got error %v, want %v", step.name, err, step.err)
+		}
+	}
+
+	// A new API key derives a new message key and resets the counter
+	newMessageKey := saveTestControllerKey(t, "new")
+	if err := AuthControllerMessage(testController, 1, []byte(message), mac); err != ErrInvalidControllerKey {
+		t.Errorf("old message key: got error %v, want %v", err, ErrInvalidControllerKey)
+	}
+
+	if err := AuthControllerMessage(testController, 1, []byte(message), signTestMessage(newMessageKey, message)); err != nil {
+		t.Errorf("new message key: got error %v, want none", err)
+	}
+
+	// Without a secret, no message can be authenticated
+	config.PlantBuddyConfig.Udp.Secret = ""
+	if err := AuthControllerMessage(testController, 2, []byte(message), mac); err != ErrNoMessageSecret {
+		t.Errorf("no secret: got error %v, want %v", err, ErrNoMessageSecret)
+	}
+}
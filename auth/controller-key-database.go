@@ -0,0 +1,24 @@
+package auth
+
+// ControllerKeyRepository provides access to the API keys of micro-controllers.
+// Every controller has at most one key.
+type ControllerKeyRepository interface {
+	// GetByKey returns the controller key identified by the given key hash.
+	GetByKey(keyHash string) (*ControllerKey, error)
+
+	// GetByController returns the key of the given controller.
+	GetByController(uuid string) (*ControllerKey, error)
+
+	// GetHashByController returns the hash of the key of the given controller.
+	GetHashByController(uuid string) (string, error)
+
+	// AdvanceMessageCounter records the counter of a message sent by a controller without HTTP and returns false
+	// if it is not greater than the last one. Replacing the key of a controller resets its counter.
+	AdvanceMessageCounter(uuid string, counter uint32) (bool, error)
+
+	// Save stores the key of a controller. An existing key is replaced.
+	Save(key *ControllerKey, keyHash string) error
+
+	// DeleteByController deletes the key of the given controller.
+	DeleteByController(uuid string) error
+}
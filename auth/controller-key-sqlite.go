@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// ControllerKeySqliteRepository implements the ControllerKeyRepository interface.
+// Timestamps are stored as unix seconds.
+type ControllerKeySqliteRepository struct {
+	db *sql.DB
+}
+
+// NewControllerKeyRepository creates a new ControllerKeyRepository.
+func NewControllerKeyRepository(session *db.Session) (ControllerKeyRepository, error) {
+	if !session.IsOpen() {
+		return nil, errors.New("session is not open")
+	}
+
+	return &ControllerKeySqliteRepository{
+		db: session.DB,
+	}, nil
+}
+
+// GetByKey returns the controller key identified by the given key hash.
+func (r *ControllerKeySqliteRepository) GetByKey(keyHash string) (*ControllerKey, error) {
+	var controller string
+	var created int64
+
+	err := r.db.QueryRow(`
+    SELECT
+        CK.CONTROLLER,
+        CK.CREATED
+    FROM CONTROLLER_KEY CK
+    WHERE CK.KEY = ?;`, keyHash).Scan(&controller, &created)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ControllerKey{
+		Controller: controller,
+		Created:    time.Unix(created, 0).UTC(),
+	}, nil
+}
+
+// GetByController returns the key of the given controller.
+func (r *ControllerKeySqliteRepository) GetByController(uuid string) (*ControllerKey, error) {
+	var controller string
+	var created int64
+
+	err := r.db.QueryRow(`
+    SELECT
+        CK.CONTROLLER,
+        CK.CREATED
+    FROM CONTROLLER_KEY CK
+    WHERE CK.CONTROLLER = ?;`, uuid).Scan(&controller, &created)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ControllerKey{
+		Controller: controller,
+		Created:    time.Unix(created, 0).UTC(),
+	}, nil
+}
+
+// GetHashByController returns the hash of the key of the given controller.
+func (r *ControllerKeySqliteRepository) GetHashByController(uuid string) (string, error) {
+	var keyHash string
+
+	err := r.db.QueryRow(`
+    SELECT
+        CK.KEY
+    FROM CONTROLLER_KEY CK
+    WHERE CK.CONTROLLER = ?;`, uuid).Scan(&keyHash)
+
+	return keyHash, err
+}
+
+// AdvanceMessageCounter records the counter of a message sent by a controller without HTTP and returns false
+// if it is not greater than the last one. Replacing the key of a controller resets its counter.
+func (r *ControllerKeySqliteRepository) AdvanceMessageCounter(uuid string, counter uint32) (bool, error) {
+	result, err := r.db.Exec(`
+    UPDATE CONTROLLER_KEY
+    SET MESSAGE_COUNTER = ?
+    WHERE CONTROLLER = ?
+        AND (MESSAGE_COUNTER IS NULL OR MESSAGE_COUNTER < ?);`, counter, uuid, counter)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// Save stores the key of a controller. An existing key is replaced.
+func (r *ControllerKeySqliteRepository) Save(key *ControllerKey, keyHash string) error {
+	_, err := r.db.Exec(`
+    INSERT OR REPLACE INTO CONTROLLER_KEY (CONTROLLER, KEY, CREATED)
+    VALUES (?, ?, ?);`,
+		key.Controller,
+		keyHash,
+		key.Created.Unix())
+
+	return err
+}
+
+// DeleteByController deletes the key of the given controller.
+func (r *ControllerKeySqliteRepository) DeleteByController(uuid string) error {
+	_, err := r.db.Exec(`
+    DELETE FROM CONTROLLER_KEY
+    WHERE CONTROLLER = ?;`, uuid)
+
+	return err
+}
@@ -0,0 +1,13 @@
+package auth
+
+// IdentityRepository links identities of an OpenID Connect provider to users.
+type IdentityRepository interface {
+	// GetUserId returns the ID of the user the identity is linked to.
+	GetUserId(issuer string, subject string) (int64, error)
+
+	// Create links an identity to a user.
+	Create(issuer string, subject string, userId int64) error
+
+	// DeleteAllByUserId removes all identities linked to a user.
+	DeleteAllByUserId(userId int64) error
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// IdentitySqliteRepository implements the IdentityRepository interface.
+type IdentitySqliteRepository struct {
+	db db.Querier
+}
+
+// NewIdentityRepository creates a new IdentityRepository.
+func NewIdentityRepository(session *db.Session) (IdentityRepository, error) {
+	if !session.IsOpen() {
+		return nil, errors.New("session is not open")
+	}
+
+	return &IdentitySqliteRepository{db: session.Querier()}, nil
+}
+
+// GetUserId returns the ID of the user the identity is linked to.
+func (r *IdentitySqliteRepository) GetUserId(issuer string, subject string) (int64, error) {
+	var userId int64
+	err := r.db.QueryRow(`
+    SELECT UI.USER
+    FROM USER_IDENTITY UI
+    WHERE UI.ISSUER = ?
+        AND UI.SUBJECT = ?;`, issuer, subject).Scan(&userId)
+
+	return userId, err
+}
+
+// Create links an identity to a user.
+func (r *IdentitySqliteRepository) Create(issuer string, subject string, userId int64) error {
+	_, err := r.db.Exec(`
+    INSERT INTO USER_IDENTITY (ISSUER, SUBJECT, USER, CREATED)
+    VALUES (?, ?, ?, ?);`, issuer, subject, userId, time.Now().Unix())
+
+	return err
+}
+
+// DeleteAllByUserId removes all identities linked to a user.
+func (r *IdentitySqliteRepository) DeleteAllByUserId(userId int64) error {
+	_, err := r.db.Exec(`DELETE FROM USER_IDENTITY WHERE USER = ?;`, userId)
+	return err
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// userLockoutHandler handles all requests to `/v1/user/{id}/lockout`.
+func userLockoutHandler(w http.ResponseWriter, r *http.Request, userId int64) {
+	switch r.Method {
+	case http.MethodGet:
+		handleUserLockoutGet(w, r, userId)
+	case http.MethodDelete:
+		handleUserLockoutDelete(w, r, userId)
+	default:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET, DELETE")
+	}
+}
+
+// handleUserLockoutGet handles GET requests to the user lockout endpoint.
+// It returns the failed login attempts of the user.
+func handleUserLockoutGet(w http.ResponseWriter, r *http.Request, userId int64) {
+	user, ok := loadUserForLockout(w, userId)
+	if !ok {
+		return
+	}
+
+	b, err := json.Marshal(getLockout(user))
+	if err != nil {
+		msg := fmt.Sprintf("Error converting lockout of user %d to JSON: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	utils.HttpOkResponse(w, b)
+}
+
+// handleUserLockoutDelete handles DELETE requests to the user lockout endpoint.
+// It unlocks the user by forgetting all failed login attempts.
+func handleUserLockoutDelete(w http.ResponseWriter, r *http.Request, userId int64) {
+	user, ok := loadUserForLockout(w, userId)
+	if !ok {
+		return
+	}
+
+	previous := getLockout(user)
+	loginAttempts.reset(userAttemptKey(user.Name))
+
+	RecordAudit(r, auditEntityLockout, userId, previous, getLockout(user))
+
+	log.Printf("Unlocked user %s", user.Name)
+	utils.HttpOkResponse(w, nil)
+}
+
+// loadUserForLockout returns the user and true if it exists.
+// Otherwise, it writes an error response and returns false.
+func loadUserForLockout(w http.ResponseWriter, userId int64) (*User, bool) {
+	user, err := getUserById(userId)
+	switch err {
+	case nil:
+		return user, true
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("User with id %d not found", userId)
+		utils.HttpNotFoundResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error while getting user with id %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+
+	return nil, false
+}
+
+// getLockout returns the failed login attempts of a user.
+func getLockout(user *User) *Lockout {
+	count, blockedUntil := loginAttempts.status(userAttemptKey(user.Name))
+
+	lockout := &Lockout{
+		User:           user.Id,
+		FailedAttempts: count,
+	}
+
+	if blockedUntil.After(time.Now()) {
+		blockedUntil = blockedUntil.UTC().Truncate(time.Second)
+		lockout.BlockedUntil = &blockedUntil
+	}
+
+	return lockout
+}
@@ -9,7 +9,10 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/plantineers/plantbuddy-server/audit"
+	"github.com/plantineers/plantbuddy-server/config"
 	"github.com/plantineers/plantbuddy-server/db"
 	"github.com/plantineers/plantbuddy-server/utils"
 )
@@ -24,25 +27,96 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	handleLoginGet(w, r)
 }
 
+// LogoutHandler handles logout requests.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	// LogoutHandler only accepts POST requests.
+	if r.Method != http.MethodPost {
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: POST")
+		return
+	}
+	handleLogoutPost(w, r)
+}
+
 // handleLoginGet handles GET requests to the login endpoint.
+// The user has to authenticate with username and password and receives a bearer token.
 func handleLoginGet(w http.ResponseWriter, r *http.Request) {
-	safeUser, err := authUser(r)
+	safeUser, err := authBasic(r, true)
 	switch err {
 	case ErrWrongCredentials:
 		utils.HttpForbiddenResponse(w, "Wrong credentials")
+	case ErrTotpRequired:
+		utils.HttpUnauthorizedResponse(w, "TOTP code required (send it in the X-TOTP-Code header)", "TOTP")
+	case ErrInvalidTotpCode:
+		utils.HttpForbiddenResponse(w, "Invalid TOTP code")
+	case ErrUserDisabled:
+		utils.HttpForbiddenResponse(w, "User is disabled")
+	case ErrTooManyAttempts:
+		utils.HttpTooManyRequestsResponse(w, "Too many failed login attempts", retryAfter(r))
 	case ErrNoCredentials:
 		utils.HttpBadRequestResponse(w, "No credentials supplied")
+	case ErrInvalidAuthHeader:
+		utils.HttpBadRequestResponse(w, "Invalid authorization header (expected Basic)")
+	case nil:
+		respondWithSession(w, safeUser)
+	default:
+		msg := fmt.Sprintf("Error while authenticating user: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// respondWithSession creates a session for an authenticated user and returns the user along with the token.
+func respondWithSession(w http.ResponseWriter, safeUser *SafeUser) {
+	token, session, err := createSession(safeUser.Id)
+	if err != nil {
+		msg := fmt.Sprintf("Error creating session for user %s: %s", safeUser.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	b, err := json.Marshal(&Login{
+		SafeUser: *safeUser,
+		Token:    token,
+		Expires:  session.Expires,
+	})
+	if err != nil {
+		msg := fmt.Sprintf("Error converting user %s to JSON: %s", safeUser.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	log.Printf("User %s logged in", safeUser.Name)
+	utils.HttpOkResponse(w, b)
+}
+
+// handleLogoutPost handles POST requests to the logout endpoint.
+// The session belonging to the supplied bearer token is revoked.
+func handleLogoutPost(w http.ResponseWriter, r *http.Request) {
+	scheme, token := splitAuthHeader(r)
+	if scheme != "Bearer" {
+		utils.HttpBadRequestResponse(w, "Logout requires a bearer token")
+		return
+	}
+
+	safeUser, session, err := authBearerThrottled(r, token)
+	switch err {
+	case ErrInvalidToken:
+		utils.HttpForbiddenResponse(w, "Invalid or expired token")
+	case ErrTooManyAttempts:
+		utils.HttpTooManyRequestsResponse(w, "Too many failed login attempts", retryAfter(r))
 	case nil:
-		// User is authenticated, return SafeUser object
-		b, err := json.Marshal(safeUser)
+		err = deleteSessionById(session.Id)
 		if err != nil {
-			msg := fmt.Sprintf("Error converting user %s to JSON: %s", safeUser.Name, err.Error())
+			msg := fmt.Sprintf("Error revoking session %d: %s", session.Id, err.Error())
 			utils.HttpInternalServerErrorResponse(w, msg)
 			return
 		}
 
-		log.Printf("User %s logged in", safeUser.Name)
-		utils.HttpOkResponse(w, b)
+		// The logout endpoint is not behind the middleware, so the user is not part of the context
+		actor := audit.Actor{User: safeUser.Id, Name: safeUser.Name}
+		audit.Record(r, actor, auditEntitySession, session.Id, session, nil)
+
+		log.Printf("User %s logged out", safeUser.Name)
+		utils.HttpOkResponse(w, nil)
 	default:
 		msg := fmt.Sprintf("Error while authenticating user: %s", err.Error())
 		utils.HttpInternalServerErrorResponse(w, msg)
@@ -67,45 +141,323 @@ func getUserByName(name string) (*User, error) {
 	return repo.GetByName(name)
 }
 
+// upgradePasswordHash hashes the password of the given user with the current algorithm and stores it.
+func upgradePasswordHash(user *User, password string) error {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	var session = db.NewSession()
+	defer session.Close()
+
+	err = session.Open()
+	if err != nil {
+		return err
+	}
+
+	repo, err := NewUserRepository(session)
+	if err != nil {
+		return err
+	}
+
+	err = repo.UpdatePassword(user.Id, hash)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Upgraded password hash of user %s", user.Name)
+	return nil
+}
+
+// createSession creates a new session for the given user.
+// It returns the token in plain text, as only its hash is stored.
+func createSession(userId int64) (string, *Session, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return "", nil, err
+	}
+
+	repo, err := NewSessionRepository(session)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Clean up old sessions from time to time
+	err = repo.DeleteExpired()
+	if err != nil {
+		return "", nil, err
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC()
+	createdSession, err := repo.Create(&Session{
+		User:    userId,
+		Created: now,
+		Expires: now.Add(config.PlantBuddyConfig.Auth.SessionLifetime.Duration),
+	}, utils.HashToken(token))
+
+	return token, createdSession, err
+}
+
+// splitAuthHeader splits the Authorization header into its scheme and its value.
+func splitAuthHeader(r *http.Request) (string, string) {
+	authHeader := r.Header.Get("Authorization")
+	disassembledAuthHeader := strings.SplitN(authHeader, " ", 2)
+	if len(disassembledAuthHeader) != 2 {
+		return "", ""
+	}
+
+	return disassembledAuthHeader[0], disassembledAuthHeader[1]
+}
+
 // authUser authorizes a user by checking the Authorization header.
-// It follows the HTTP Basic Auth scheme.
+// It accepts both the HTTP Basic Auth and the Bearer scheme, the latter with a session or a personal access token.
 func authUser(r *http.Request) (*SafeUser, error) {
-	// Get Authorization header value
-	authHeader := r.Header.Get("Authorization")
-	disassembledAuthHeader := strings.Split(authHeader, " ")
-	if len(disassembledAuthHeader) != 2 || disassembledAuthHeader[0] != "Basic" {
+	if r.Header.Get("Authorization") == "" {
+		return nil, ErrNoCredentials
+	}
+
+	var safeUser *SafeUser
+	var err error
+
+	scheme, token := splitAuthHeader(r)
+	switch scheme {
+	case "Basic":
+		safeUser, err = authBasic(r, false)
+	case "Bearer":
+		if strings.HasPrefix(token, accessTokenPrefix) {
+			safeUser, err = authAccessTokenThrottled(r, token)
+		} else {
+			safeUser, _, err = authBearerThrottled(r, token)
+		}
+	default:
+		return nil, ErrInvalidAuthHeader
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return safeUser, markTotpPending(safeUser)
+}
+
+// authBasic authorizes a user by checking the Authorization header.
+// It follows the HTTP Basic Auth scheme. login is set if a session is issued to the user.
+func authBasic(r *http.Request, login bool) (*SafeUser, error) {
+	if r.Header.Get("Authorization") == "" {
+		return nil, ErrNoCredentials
+	}
+
+	scheme, value := splitAuthHeader(r)
+	if scheme != "Basic" {
 		return nil, ErrInvalidAuthHeader
 	}
 
 	// Decode header value
-	decodedAuthHeaderDigest := make([]byte, base64.StdEncoding.DecodedLen(len(disassembledAuthHeader[1])))
-	n, err := base64.StdEncoding.Decode(decodedAuthHeaderDigest, []byte(disassembledAuthHeader[1]))
+	decodedAuthHeaderDigest := make([]byte, base64.StdEncoding.DecodedLen(len(value)))
+	n, err := base64.StdEncoding.Decode(decodedAuthHeaderDigest, []byte(value))
 	if err != nil {
 		return nil, ErrInvalidAuthHeader
 	}
 
 	// Extract username and password from decoded header value
-	decodedAuthHeader := strings.Split(string(decodedAuthHeaderDigest[:n]), ":")
+	decodedAuthHeader := strings.SplitN(string(decodedAuthHeaderDigest[:n]), ":", 2)
+	if len(decodedAuthHeader) != 2 {
+		return nil, ErrInvalidAuthHeader
+	}
+
 	userName := decodedAuthHeader[0]
 	password := decodedAuthHeader[1]
 
+	// Refuse to check any password while the user name or the client is blocked
+	release, ok := reserveLogin(r, userName)
+	if !ok {
+		return nil, ErrTooManyAttempts
+	}
+	defer release()
+
 	// Get user from db
 	user, err := getUserByName(userName)
 	if err == sql.ErrNoRows { // User not found
+		recordFailedLogin(r, userName)
 		return nil, ErrWrongCredentials
 	} else if err != nil { // Database error
 		return nil, err
 	}
 
 	// Check password
-	password = utils.HashPassword(password)
-	if password != user.Password {
+	matches, outdated := utils.CheckPassword(password, user.Password)
+	if !matches {
+		recordFailedLogin(r, userName)
 		return nil, ErrWrongCredentials
 	}
 
-	return &SafeUser{
-		Id:   user.Id,
-		Name: user.Name,
-		Role: user.Role,
-	}, nil
+	if !user.Enabled {
+		return nil, ErrUserDisabled
+	}
+
+	err = checkSecondFactor(r, user, login)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep counting for the client IP, so a valid account does not reset it between guesses
+	loginAttempts.reset(userAttemptKey(userName))
+
+	// Replace hashes created with an outdated algorithm now that we know the password
+	if outdated {
+		err = upgradePasswordHash(user, password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return user.safe(), nil
+}
+
+// authBearerThrottled authorizes a user by a session token like authBearer,
+// but throttles clients guessing tokens.
+func authBearerThrottled(r *http.Request, token string) (*SafeUser, *Session, error) {
+	if !tokenAttemptAllowed(r) {
+		return nil, nil, ErrTooManyAttempts
+	}
+
+	safeUser, session, err := authBearer(token)
+	if err == ErrInvalidToken {
+		recordFailedToken(r)
+	}
+
+	return safeUser, session, err
+}
+
+// authBearer authorizes a user by a session token.
+// Expired sessions are deleted on access.
+func authBearer(token string) (*SafeUser, *Session, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sessionRepo, err := NewSessionRepository(session)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userSession, err := sessionRepo.GetByToken(utils.HashToken(token))
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if time.Now().After(userSession.Expires) {
+		err = sessionRepo.DeleteById(userSession.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return nil, nil, ErrInvalidToken
+	}
+
+	userRepo, err := NewUserRepository(session)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := userRepo.GetById(userSession.User)
+	if err == sql.ErrNoRows { // User has been deleted in the meantime
+		return nil, nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if !user.Enabled {
+		return nil, nil, ErrUserDisabled
+	}
+
+	return user.safe(), userSession, nil
+}
+
+// authAccessTokenThrottled authorizes a user by a personal access token like authAccessToken,
+// but throttles clients guessing tokens.
+func authAccessTokenThrottled(r *http.Request, token string) (*SafeUser, error) {
+	if !tokenAttemptAllowed(r) {
+		return nil, ErrTooManyAttempts
+	}
+
+	safeUser, err := authAccessToken(token)
+	if err == ErrInvalidToken {
+		recordFailedToken(r)
+	}
+
+	return safeUser, err
+}
+
+// authAccessToken authorizes a user by a personal access token.
+// The user only gets the permissions in the scopes of the token, and the time the token has been used is recorded.
+func authAccessToken(token string) (*SafeUser, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	tokenRepo, err := NewAccessTokenRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := tokenRepo.GetByToken(utils.HashToken(token))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if now.After(accessToken.Expires) {
+		return nil, ErrInvalidToken
+	}
+
+	userRepo, err := NewUserRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := userRepo.GetById(accessToken.User)
+	if err == sql.ErrNoRows { // User has been deleted in the meantime
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !user.Enabled {
+		return nil, ErrUserDisabled
+	}
+
+	// Scripts may send lots of requests, so only write once in a while
+	if accessToken.LastUsed == nil || now.Sub(*accessToken.LastUsed) >= accessTokenLastUsedPrecision {
+		err = tokenRepo.UpdateLastUsed(accessToken.Id, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	safeUser := user.safe()
+	safeUser.scopes = accessToken.Scopes
+
+	return safeUser, nil
 }
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+)
+
+// setupTestLoginAttempts replaces the tracked authentication attempts by an empty tracker for the test.
+func setupTestLoginAttempts(t *testing.T) {
+	t.Helper()
+
+	setupTestBruteForce(t)
+	previous := loginAttempts
+	loginAttempts = newTestAttemptTracker()
+	t.Cleanup(func() { loginAttempts = previous })
+}
+
+// newTestBasicRequest returns a request authenticated with the given credentials via HTTP Basic Auth.
+func newTestBasicRequest(name string, password string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/v1/user/login", nil)
+	r.SetBasicAuth(name, password)
+	return r
+}
+
+func TestAuthBasicUpgradesLegacyHash(t *testing.T) {
+	dbtest.Setup(t)
+	setupTestLoginAttempts(t)
+
+	// Hashed like passwords were before bcrypt
+	legacyHash := fmt.Sprintf("%x", sha256.Sum256([]byte("secret"+"plantbuddy_salt")))
+	user, err := createUser(&User{Name: "legacy", Password: legacyHash, Role: Gardener, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each step depends on the hash stored by the previous ones
+	steps := []struct {
+		name     string
+		password string
+		err      error
+		bcrypt   bool // Whether the stored hash is a bcrypt hash afterwards
+	}{
+		{"wrong password", "Secret", ErrWrongCredentials, false},
+		{"legacy hash", "secret", nil, true},
+		{"upgraded hash", "secret", nil, true},
+		{"wrong password after upgrade", "Secret", ErrWrongCredentials, true},
+	}
+
+	for _, step := range steps {
+		safeUser, err := authBasic(newTestBasicRequest("legacy", step.password), false)
+		if err != step.err {
+			t.Errorf("%s: got error %v, want %v", step.name, err, step.err)
+		}
+
+		if err == nil && safeUser.Id != user.Id {
+			t.Errorf("%s: got user %d, want %d", step.name, safeUser.Id, user.Id)
+		}
+
+		stored, err := getUserByName("legacy")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.HasPrefix(stored.Password, "$2") != step.bcrypt {
+			t.Errorf("%s: got hash %s, want bcrypt %t", step.name, stored.Password, step.bcrypt)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// MeHandler handles all requests to `/v1/me`, the account of the authenticated user.
+// Unlike `/v1/user/{id}`, it operates on the user resolved by the middleware, so it is available to all roles.
+func MeHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		utils.HttpForbiddenResponse(w, "Only users have an account")
+		return
+	}
+
+	segments := utils.PathSegments(r.URL.Path, "/v1/me")
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodGet:
+		handleMeGet(w, r, user)
+	case len(segments) == 0:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET")
+	case len(segments) == 1 && segments[0] == "password" && r.Method == http.MethodPut:
+		handleMePasswordPut(w, r, user)
+	case len(segments) == 1 && segments[0] == "password":
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: PUT")
+	case len(segments) == 1 && segments[0] == "sessions" && r.Method == http.MethodGet:
+		handleUserSessionsGet(w, r, user.Id)
+	case len(segments) == 1 && segments[0] == "sessions":
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET")
+	case segments[0] == "totp":
+		meTotpHandler(w, r, user, segments[1:])
+	case segments[0] == "tokens":
+		meAccessTokensHandler(w, r, user, segments[1:])
+	default:
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("Unknown resource %s", r.URL.Path))
+	}
+}
+
+// handleMeGet handles GET requests to the me endpoint.
+// It returns the authenticated user along with their permissions.
+func handleMeGet(w http.ResponseWriter, r *http.Request, user *SafeUser) {
+	b, err := json.Marshal(&Profile{
+		SafeUser:    *user,
+		Permissions: user.Permissions(),
+	})
+	if err != nil {
+		msg := fmt.Sprintf("Error converting user %s to JSON: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	utils.HttpOkResponse(w, b)
+}
+
+// handleMePasswordPut handles PUT requests to the password of the authenticated user.
+// The current password has to be confirmed. All other sessions of the user are revoked.
+func handleMePasswordPut(w http.ResponseWriter, r *http.Request, user *SafeUser) {
+	var change PasswordChange
+	err := json.NewDecoder(r.Body).Decode(&change)
+	if err != nil {
+		msg := fmt.Sprintf("Error decoding password change of user %s: %s", user.Name, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	err = validatePassword(change.NewPassword)
+	if err != nil {
+		msg := fmt.Sprintf("Error validating new password of user %s: %s", user.Name, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	storedUser, err := getUserById(user.Id)
+	if err != nil {
+		msg := fmt.Sprintf("Error while getting user %s: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	// Treat a wrong current password like a failed login, so a stolen token cannot be used to guess it
+	matches, _ := utils.CheckPassword(change.CurrentPassword, storedUser.Password)
+	if !matches {
+		recordFailedLogin(r, user.Name)
+		utils.HttpForbiddenResponse(w, "Current password is wrong")
+		return
+	}
+
+	hash, err := utils.HashPassword(change.NewPassword)
+	if err != nil {
+		msg := fmt.Sprintf("Error hashing password of user %s: %s", user.Name, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	err = changePassword(r, user.Id, hash)
+	if err != nil {
+		msg := fmt.Sprintf("Error changing password of user %s: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	RecordAudit(r, auditEntityPassword, user.Id, nil, nil)
+
+	log.Printf("User %s changed their password", user.Name)
+	utils.HttpOkResponse(w, nil)
+}
+
+// changePassword stores the new password hash of a user and revokes all of their sessions,
+// except the one the request has been authenticated with (if any).
+func changePassword(r *http.Request, userId int64, hash string) error {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	userRepo, err := NewUserRepository(session)
+	if err != nil {
+		return err
+	}
+
+	sessionRepo, err := NewSessionRepository(session)
+	if err != nil {
+		return err
+	}
+
+	err = userRepo.UpdatePassword(userId, hash)
+	if err != nil {
+		return err
+	}
+
+	var keepId int64
+	if scheme, token := splitAuthHeader(r); scheme == "Bearer" {
+		current, err := sessionRepo.GetByToken(utils.HashToken(token))
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		if current != nil {
+			keepId = current.Id
+		}
+	}
+
+	return sessionRepo.DeleteOthersByUserId(userId, keepId)
+}
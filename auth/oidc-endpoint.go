@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// oidcStateCookie binds the state of a login to the browser that started it.
+const oidcStateCookie = "plantbuddy_oidc_state"
+
+// OidcLoginHandler handles requests to the OpenID Connect login endpoint.
+func OidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if !config.PlantBuddyConfig.Auth.Oidc.Enabled {
+		utils.HttpNotFoundResponse(w, "OpenID Connect login is not enabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		handleOidcLoginGet(w, r)
+	default:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET")
+	}
+}
+
+// OidcCallbackHandler handles requests to the OpenID Connect callback endpoint.
+func OidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !config.PlantBuddyConfig.Auth.Oidc.Enabled {
+		utils.HttpNotFoundResponse(w, "OpenID Connect login is not enabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		handleOidcCallbackGet(w, r)
+	default:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET")
+	}
+}
+
+// handleOidcLoginGet handles GET requests to the OpenID Connect login endpoint.
+// The user is redirected to the identity provider.
+func handleOidcLoginGet(w http.ResponseWriter, r *http.Request) {
+	client, err := getOidcClient(r.Context())
+	if err != nil {
+		msg := fmt.Sprintf("Error connecting to identity provider: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	state, err := utils.GenerateToken()
+	if err != nil {
+		msg := fmt.Sprintf("Error generating state: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	nonce, err := utils.GenerateToken()
+	if err != nil {
+		msg := fmt.Sprintf("Error generating nonce: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	oidcStates.add(state, nonce)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/v1/user/oidc",
+		MaxAge:   int(oidcStateLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, client.oauth2.AuthCodeURL(state, oidc.Nonce(nonce)), http.StatusFound)
+}
+
+// handleOidcCallbackGet handles GET requests to the OpenID Connect callback endpoint.
+// The identity provider redirects the user here after the login. The user receives a bearer token
+// just like after logging in with username and password.
+func handleOidcCallbackGet(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if idpError := query.Get("error"); idpError != "" {
+		msg := fmt.Sprintf("Login at identity provider failed: %s %s", idpError, query.Get("error_description"))
+		utils.HttpForbiddenResponse(w, msg)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		utils.HttpBadRequestResponse(w, "State does not match the login started by this client")
+		return
+	}
+
+	// Each login can only be completed once
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/v1/user/oidc", MaxAge: -1})
+
+	nonce, ok := oidcStates.take(state)
+	if !ok {
+		utils.HttpBadRequestResponse(w, "Login has expired, please start again")
+		return
+	}
+
+	client, err := getOidcClient(r.Context())
+	if err != nil {
+		msg := fmt.Sprintf("Error connecting to identity provider: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	oauth2Token, err := client.oauth2.Exchange(r.Context(), query.Get("code"))
+	if err != nil {
+		msg := fmt.Sprintf("Error exchanging authorization code: %s", err.Error())
+		utils.HttpForbiddenResponse(w, msg)
+		return
+	}
+
+	rawIdToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		utils.HttpForbiddenResponse(w, "Identity provider did not return an ID token")
+		return
+	}
+
+	idToken, err := client.verifier.Verify(r.Context(), rawIdToken)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid ID token: %s", err.Error())
+		utils.HttpForbiddenResponse(w, msg)
+		return
+	}
+
+	if idToken.Nonce != nonce {
+		utils.HttpForbiddenResponse(w, "Invalid ID token: nonce does not match")
+		return
+	}
+
+	claims, err := parseOidcClaims(idToken)
+	if err != nil {
+		msg := fmt.Sprintf("Error parsing ID token claims: %s", err.Error())
+		utils.HttpForbiddenResponse(w, msg)
+		return
+	}
+
+	// Two-factor authentication is left to the identity provider, so users with a TOTP secret are not asked for a
+	// code here. The browser cannot send one along with the redirect anyway.
+	user, err := resolveOidcUser(r, client.issuer, claims)
+	switch err {
+	case nil:
+		log.Printf("User %s authenticated via identity provider", user.Name)
+		respondWithSession(w, user.safe())
+	case ErrUserDisabled:
+		utils.HttpForbiddenResponse(w, "User is disabled")
+	case ErrUnknownIdentity:
+		utils.HttpForbiddenResponse(w, "Identity is not linked to any user")
+	case ErrUserAlreadyExists:
+		msg := fmt.Sprintf("User %s already exists and is not linked to this identity", claims.Username)
+		utils.HttpConflictResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error resolving user from identity provider: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
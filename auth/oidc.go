@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/plantineers/plantbuddy-server/audit"
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db"
+	"golang.org/x/oauth2"
+)
+
+// oidcStateLifetime is the time a user has to log in at the identity provider.
+const oidcStateLifetime = 10 * time.Minute
+
+// oidcClient talks to the configured OpenID Connect provider.
+type oidcClient struct {
+	issuer   string
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+var (
+	oidcClientMu     sync.Mutex
+	oidcClientCached *oidcClient
+)
+
+// getOidcClient returns the client of the configured provider. Its endpoints are discovered on first use,
+// so the server starts even if the provider is not reachable yet.
+func getOidcClient(ctx context.Context) (*oidcClient, error) {
+	oidcClientMu.Lock()
+	defer oidcClientMu.Unlock()
+
+	if oidcClientCached != nil {
+		return oidcClientCached, nil
+	}
+
+	cfg := config.PlantBuddyConfig.Auth.Oidc
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcClientCached = &oidcClient{
+		issuer: cfg.Issuer,
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientId,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectUrl,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, cfg.Scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientId}),
+	}
+
+	return oidcClientCached, nil
+}
+
+// oidcStateStore remembers the logins that have been started, so callbacks can be matched to them.
+type oidcStateStore struct {
+	mu     sync.Mutex
+	states map[string]*oidcState
+}
+
+// oidcState is a login that has been started and is identified by a random state.
+type oidcState struct {
+	nonce   string
+	expires time.Time
+}
+
+var oidcStates = &oidcStateStore{states: make(map[string]*oidcState)}
+
+// add remembers a started login.
+func (s *oidcStateStore) add(state string, nonce string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, started := range s.states {
+		if started.expires.Before(now) {
+			delete(s.states, key)
+		}
+	}
+
+	s.states[state] = &oidcState{nonce: nonce, expires: now.Add(oidcStateLifetime)}
+}
+
+// take returns the nonce of a started login and forgets it, so each state can only be used once.
+func (s *oidcStateStore) take(state string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	started, ok := s.states[state]
+	if !ok {
+		return "", false
+	}
+
+	delete(s.states, state)
+	if started.expires.Before(time.Now()) {
+		return "", false
+	}
+
+	return started.nonce, true
+}
+
+// oidcClaims are the claims of an ID token relevant for mapping it to a user.
+type oidcClaims struct {
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+// parseOidcClaims extracts the configured claims from an ID token.
+func parseOidcClaims(idToken *oidc.IDToken) (*oidcClaims, error) {
+	var raw map[string]any
+	err := idToken.Claims(&raw)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := config.PlantBuddyConfig.Auth.Oidc
+	claims := &oidcClaims{
+		Subject:  idToken.Subject,
+		Username: idToken.Subject,
+	}
+
+	if username, ok := raw[cfg.UsernameClaim].(string); ok && username != "" {
+		claims.Username = username
+	}
+
+	// Providers send either a list of groups or a single group
+	switch groups := raw[cfg.GroupsClaim].(type) {
+	case []any:
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				claims.Groups = append(claims.Groups, name)
+			}
+		}
+	case string:
+		claims.Groups = []string{groups}
+	}
+
+	return claims, nil
+}
+
+// roleFromGroups returns the most privileged role mapped to any of the groups.
+// It returns false if none of the groups is mapped.
+func roleFromGroups(groups []string) (Role, bool) {
+	var role Role
+	mapped := false
+	for _, group := range groups {
+		groupRole, ok := config.PlantBuddyConfig.Auth.Oidc.GroupRoles[group]
+		if !ok || !Role(groupRole).IsValid() {
+			continue
+		}
+
+		// Lower values are more privileged (Admin = 0)
+		if !mapped || Role(groupRole) < role {
+			role = Role(groupRole)
+			mapped = true
+		}
+	}
+
+	return role, mapped
+}
+
+// resolveOidcUser returns the user linked to the identity. Unknown identities are provisioned as new users
+// if enabled. If groups are mapped to roles, the role of the user is synchronized.
+func resolveOidcUser(r *http.Request, issuer string, claims *oidcClaims) (*User, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	userRepo, err := NewUserRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	identityRepo, err := NewIdentityRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := identityRepo.GetUserId(issuer, claims.Subject)
+	if err == sql.ErrNoRows {
+		return provisionOidcUser(r, userRepo, identityRepo, issuer, claims)
+	} else if err != nil {
+		return nil, err
+	}
+
+	user, err := userRepo.GetById(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Enabled {
+		return nil, ErrUserDisabled
+	}
+
+	role, mapped := roleFromGroups(claims.Groups)
+	if len(config.PlantBuddyConfig.Auth.Oidc.GroupRoles) == 0 || role == user.Role {
+		return user, nil
+	}
+
+	if !mapped {
+		role = Role(config.PlantBuddyConfig.Auth.Oidc.DefaultRole)
+	}
+
+	// Check and demote in one transaction, so concurrent demotions cannot remove the last admin
+	err = session.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	userRepo, err = NewUserRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err = userRepo.GetById(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Role == Admin && role != Admin && ensureNotLastAdmin(userRepo) == ErrLastAdmin {
+		log.Printf("Keeping role of user %s from identity provider, as they are the last admin", user.Name)
+		return user, nil
+	}
+
+	previous := user.safe()
+	user.Role = role
+	err = userRepo.Update(user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = session.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(r, oidcActor(issuer), auditEntityUser, user.Id, previous, user.safe())
+	log.Printf("Synchronized role of user %s from identity provider", user.Name)
+	return user, nil
+}
+
+// provisionOidcUser creates a user for an unknown identity and links them.
+func provisionOidcUser(r *http.Request, userRepo UserRepository, identityRepo IdentityRepository, issuer string, claims *oidcClaims) (*User, error) {
+	if !config.PlantBuddyConfig.Auth.Oidc.AutoProvision {
+		return nil, ErrUnknownIdentity
+	}
+
+	err := validateUserName(claims.Username)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user name %q from identity provider: %s", claims.Username, err.Error())
+	}
+
+	// Never link an identity to an existing local account just because the name matches
+	_, err = userRepo.GetByName(claims.Username)
+	if err == nil {
+		return nil, ErrUserAlreadyExists
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	role, mapped := roleFromGroups(claims.Groups)
+	if !mapped {
+		role = Role(config.PlantBuddyConfig.Auth.Oidc.DefaultRole)
+	}
+
+	// Provisioned users have no password, so they cannot log in with basic auth
+	err = userRepo.Create(&User{Name: claims.Username, Password: "", Role: role, Enabled: true})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := userRepo.GetByName(claims.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	err = identityRepo.Create(issuer, claims.Subject, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(r, oidcActor(issuer), auditEntityUser, user.Id, nil, user.safe())
+	log.Printf("Provisioned user %s from identity provider", user.Name)
+	return user, nil
+}
+
+// oidcActor is recorded in the audit log for changes made on behalf of the identity provider.
+func oidcActor(issuer string) audit.Actor {
+	return audit.Actor{Name: "oidc:" + issuer}
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+)
+
+// testIdp is a stand-in identity provider serving discovery, JWKS and token endpoints.
+// The token endpoint returns an ID token with the claims set by the test, signed with signingKey.
+type testIdp struct {
+	server     *httptest.Server
+	key        *rsa.PrivateKey // Published via JWKS
+	signingKey *rsa.PrivateKey // Used to sign ID tokens, differs from key to test invalid signatures
+	claims     map[string]any
+}
+
+func newTestIdp(t *testing.T) *testIdp {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &testIdp{key: key, signingKey: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJson(w, map[string]any{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/auth",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJson(w, map[string]any{"keys": []map[string]any{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJson(w, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idp.signIdToken(t),
+		})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// signIdToken returns the claims as JWT signed with RS256.
+func (idp *testIdp) signIdToken(t *testing.T) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	claims, _ := json.Marshal(idp.claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.signingKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeTestJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// setupTestOidc configures the OpenID Connect login against the given identity provider.
+func setupTestOidc(t *testing.T, idp *testIdp) {
+	t.Helper()
+
+	config.PlantBuddyConfig.Auth.SessionLifetime = config.Duration{Duration: time.Hour}
+	config.PlantBuddyConfig.Auth.Oidc = config.Oidc{
+		Enabled:       true,
+		Issuer:        idp.server.URL,
+		ClientId:      "plantbuddy",
+		ClientSecret:  "secret",
+		RedirectUrl:   "http://localhost:3333/v1/user/oidc/callback",
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		AutoProvision: true,
+		DefaultRole:   int8(Viewer),
+		GroupRoles: map[string]int8{
+			"plantbuddy-admins":    int8(Admin),
+			"plantbuddy-gardeners": int8(Gardener),
+		},
+	}
+
+	// The client is cached per process and has to discover the new provider
+	oidcClientMu.Lock()
+	oidcClientCached = nil
+	oidcClientMu.Unlock()
+}
+
+// startTestOidcLogin calls the login endpoint and returns the state cookie and the nonce sent to the provider.
+func startTestOidcLogin(t *testing.T) (*http.Cookie, string) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	OidcLoginHandler(w, httptest.NewRequest(http.MethodGet, "/v1/user/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: got status %d, want %d: %s", w.Code, http.StatusFound, w.Body.String())
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != location.Query().Get("state") {
+		t.Fatalf("login: state cookie %v does not match redirect %s", cookies, location)
+	}
+
+	return cookies[0], location.Query().Get("nonce")
+}
+
+// completeTestOidcLogin calls the callback endpoint like the browser redirected by the provider.
+func completeTestOidcLogin(cookie *http.Cookie, state string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/v1/user/oidc/callback?code=code&state="+url.QueryEscape(state), nil)
+	r.AddCookie(cookie)
+
+	w := httptest.NewRecorder()
+	OidcCallbackHandler(w, r)
+	return w
+}
+
+func (idp *testIdp) setClaims(subject string, nonce string, groups []string) {
+	now := time.Now()
+	idp.claims = map[string]any{
+		"iss":                idp.server.URL,
+		"aud":                "plantbuddy",
+		"sub":                subject,
+		"preferred_username": subject,
+		"groups":             groups,
+		"nonce":              nonce,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestOidcCallbackStateMismatch(t *testing.T) {
+	dbtest.Setup(t)
+	idp := newTestIdp(t)
+	setupTestOidc(t, idp)
+
+	cookie, nonce := startTestOidcLogin(t)
+	idp.setClaims("mallory", nonce, nil)
+
+	w := completeTestOidcLogin(cookie, "forged-state")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+}
+
+func TestOidcCallbackInvalidSignature(t *testing.T) {
+	dbtest.Setup(t)
+	idp := newTestIdp(t)
+	setupTestOidc(t, idp)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.signingKey = otherKey
+
+	cookie, nonce := startTestOidcLogin(t)
+	idp.setClaims("mallory", nonce, []string{"plantbuddy-admins"})
+
+	w := completeTestOidcLogin(cookie, cookie.Value)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d, want %d: %s", w.Code, http.StatusForbidden, w.Body.String())
+	}
+}
+
+func TestOidcCallbackGroupRoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		role   Role
+	}{
+		{"admin group", []string{"plantbuddy-admins"}, Admin},
+		{"gardener group", []string{"plantbuddy-gardeners"}, Gardener},
+		{"most privileged group wins", []string{"plantbuddy-gardeners", "plantbuddy-admins"}, Admin},
+		{"unmapped group", []string{"other"}, Viewer},
+		{"no groups", nil, Viewer},
+	}
+
+	dbtest.Setup(t)
+	idp := newTestIdp(t)
+	setupTestOidc(t, idp)
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cookie, nonce := startTestOidcLogin(t)
+			idp.setClaims("user"+string(rune('a'+i)), nonce, test.groups)
+
+			w := completeTestOidcLogin(cookie, cookie.Value)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+
+			var login Login
+			err := json.Unmarshal(w.Body.Bytes(), &login)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if login.Token == "" {
+				t.Error("got no bearer token")
+			}
+
+			if login.Role != test.role {
+				t.Errorf("got role %d, want %d", login.Role, test.role)
+			}
+		})
+	}
+}
+
+func TestOidcCallbackSynchronizesRole(t *testing.T) {
+	dbtest.Setup(t)
+	idp := newTestIdp(t)
+	setupTestOidc(t, idp)
+
+	for _, test := range []struct {
+		groups []string
+		role   Role
+	}{
+		{[]string{"plantbuddy-gardeners"}, Gardener},
+		{[]string{"other"}, Viewer},
+	} {
+		cookie, nonce := startTestOidcLogin(t)
+		idp.setClaims("alice", nonce, test.groups)
+
+		w := completeTestOidcLogin(cookie, cookie.Value)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+
+		var login Login
+		json.Unmarshal(w.Body.Bytes(), &login)
+		if login.Role != test.role {
+			t.Errorf("groups %v: got role %d, want %d", test.groups, login.Role, test.role)
+		}
+	}
+}
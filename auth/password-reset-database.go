@@ -0,0 +1,16 @@
+package auth
+
+import "time"
+
+// PasswordResetRepository provides access to the password reset tokens issued by admins.
+type PasswordResetRepository interface {
+	// Create stores the hash of a new reset token for a user, replacing the previous one.
+	Create(userId int64, tokenHash string, expires time.Time) error
+
+	// Consume removes a reset token and returns the user it has been issued for and when it expires.
+	// Each token can only be consumed once.
+	Consume(tokenHash string) (int64, time.Time, error)
+
+	// DeleteByUserId removes the reset token of a user.
+	DeleteByUserId(userId int64) error
+}
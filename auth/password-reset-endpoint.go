@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/audit"
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// auditEntityPasswordReset is the entity type of issued password reset tokens in the audit log.
+const auditEntityPasswordReset = "password-reset"
+
+// PasswordResetHandler handles requests to `/v1/user/password-reset`.
+// It is public, as the reset token authenticates the request.
+func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		handlePasswordResetPost(w, r)
+	default:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: POST")
+	}
+}
+
+// userPasswordResetHandler handles all requests to `/v1/user/{id}/password-reset`.
+func userPasswordResetHandler(w http.ResponseWriter, r *http.Request, userId int64) {
+	switch r.Method {
+	case http.MethodPost:
+		handleUserPasswordResetPost(w, r, userId)
+	case http.MethodDelete:
+		handleUserPasswordResetDelete(w, r, userId)
+	default:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: POST, DELETE")
+	}
+}
+
+// handleUserPasswordResetPost handles POST requests to the password reset endpoint of a user.
+// It issues a single-use token to set a new password, revoking any token issued before.
+func handleUserPasswordResetPost(w http.ResponseWriter, r *http.Request, userId int64) {
+	reset, err := issuePasswordReset(userId)
+	switch err {
+	case nil:
+		// Never record the token itself
+		RecordAudit(r, auditEntityPasswordReset, userId, nil, map[string]any{"expires": reset.Expires})
+
+		b, err := json.Marshal(reset)
+		if err != nil {
+			msg := fmt.Sprintf("Error converting password reset of user %d to JSON: %s", userId, err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		msg := fmt.Sprintf("Issued password reset token for user %d", userId)
+		location := fmt.Sprintf("/v1/user/%d/password-reset", userId)
+		utils.HttpCreatedResponse(w, b, location, msg)
+	case sql.ErrNoRows:
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("User with id %d not found", userId))
+	default:
+		msg := fmt.Sprintf("Error issuing password reset token for user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleUserPasswordResetDelete handles DELETE requests to the password reset endpoint of a user.
+// It revokes the token issued for the user (if any).
+func handleUserPasswordResetDelete(w http.ResponseWriter, r *http.Request, userId int64) {
+	_, err := getUserById(userId)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("User with id %d not found", userId))
+		return
+	default:
+		msg := fmt.Sprintf("Error getting user with id %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	err = revokePasswordReset(userId)
+	if err != nil {
+		msg := fmt.Sprintf("Error revoking password reset token of user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	RecordAudit(r, auditEntityPasswordReset, userId, nil, nil)
+
+	log.Printf("Revoked password reset token of user %d", userId)
+	utils.HttpOkResponse(w, nil)
+}
+
+// handlePasswordResetPost handles POST requests to the public password reset endpoint.
+// It sets the new password of the user the token has been issued for and revokes all of their sessions
+// and personal access tokens.
+func handlePasswordResetPost(w http.ResponseWriter, r *http.Request) {
+	if !tokenAttemptAllowed(r) {
+		utils.HttpTooManyRequestsResponse(w, "Too many failed attempts", retryAfter(r))
+		return
+	}
+
+	var reset PasswordReset
+	err := json.NewDecoder(r.Body).Decode(&reset)
+	if err != nil {
+		msg := fmt.Sprintf("Error decoding password reset: %s", err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	// Validate before consuming the token, so a too short password does not waste it
+	err = validatePassword(reset.NewPassword)
+	if err != nil {
+		msg := fmt.Sprintf("Error validating new password: %s", err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	user, err := resetPassword(reset.Token, reset.NewPassword)
+	switch err {
+	case nil:
+		// The user has proven to be in charge of the account, so let them log in right away
+		loginAttempts.reset(userAttemptKey(user.Name))
+
+		audit.Record(r, audit.Actor{User: user.Id, Name: user.Name}, auditEntityPassword, user.Id, nil, nil)
+
+		log.Printf("User %s reset their password", user.Name)
+		utils.HttpOkResponse(w, nil)
+	case ErrInvalidResetToken:
+		recordFailedToken(r)
+		utils.HttpForbiddenResponse(w, "Invalid or expired password reset token")
+	default:
+		msg := fmt.Sprintf("Error resetting password: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// issuePasswordReset creates a new password reset token for a user.
+// It returns the token in plain text, as only its hash is stored.
+func issuePasswordReset(userId int64) (*IssuedPasswordReset, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	userRepo, err := NewUserRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	resetRepo, err := NewPasswordResetRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = userRepo.GetById(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expires := time.Now().Add(config.PlantBuddyConfig.Auth.PasswordResetLifetime.Duration).UTC().Truncate(time.Second)
+	err = resetRepo.Create(userId, utils.HashToken(token), expires)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IssuedPasswordReset{User: userId, Token: token, Expires: expires}, nil
+}
+
+// revokePasswordReset removes the password reset token of a user.
+func revokePasswordReset(userId int64) error {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	repo, err := NewPasswordResetRepository(session)
+	if err != nil {
+		return err
+	}
+
+	return repo.DeleteByUserId(userId)
+}
+
+// resetPassword consumes a password reset token, stores the new password of its user
+// and revokes all of their sessions and personal access tokens.
+// The password is only hashed once the token has been validated, so invalid tokens are rejected cheaply.
+func resetPassword(token string, password string) (*User, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	userRepo, err := NewUserRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionRepo, err := NewSessionRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokenRepo, err := NewAccessTokenRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	resetRepo, err := NewPasswordResetRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, expires, err := resetRepo.Consume(utils.HashToken(token))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidResetToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(expires) {
+		return nil, ErrInvalidResetToken
+	}
+
+	user, err := userRepo.GetById(userId)
+	if err == sql.ErrNoRows { // User has been deleted in the meantime
+		return nil, ErrInvalidResetToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	err = userRepo.UpdatePassword(userId, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sessionRepo.DeleteAllByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, accessTokenRepo.DeleteAllByUserId(userId)
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// PasswordResetSqliteRepository implements the PasswordResetRepository interface.
+type PasswordResetSqliteRepository struct {
+	db db.Querier
+}
+
+// NewPasswordResetRepository creates a new PasswordResetRepository.
+func NewPasswordResetRepository(session *db.Session) (PasswordResetRepository, error) {
+	if !session.IsOpen() {
+		return nil, errors.New("session is not open")
+	}
+
+	return &PasswordResetSqliteRepository{db: session.Querier()}, nil
+}
+
+// Create stores the hash of a new reset token for a user, replacing the previous one.
+func (r *PasswordResetSqliteRepository) Create(userId int64, tokenHash string, expires time.Time) error {
+	_, err := r.db.Exec(`
+    INSERT OR REPLACE INTO PASSWORD_RESET (USER, TOKEN, CREATED, EXPIRES)
+    VALUES (?, ?, ?, ?);`, userId, tokenHash, time.Now().Unix(), expires.Unix())
+
+	return err
+}
+
+// Consume removes a reset token and returns the user it has been issued for and when it expires.
+// Each token can only be consumed once.
+func (r *PasswordResetSqliteRepository) Consume(tokenHash string) (int64, time.Time, error) {
+	var userId, expires int64
+	err := r.db.QueryRow(`
+    SELECT PR.USER, PR.EXPIRES
+    FROM PASSWORD_RESET PR
+    WHERE PR.TOKEN = ?;`, tokenHash).Scan(&userId, &expires)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	result, err := r.db.Exec(`DELETE FROM PASSWORD_RESET WHERE TOKEN = ?;`, tokenHash)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	// Another request has consumed the token in the meantime
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, time.Time{}, err
+	} else if affected == 0 {
+		return 0, time.Time{}, sql.ErrNoRows
+	}
+
+	return userId, time.Unix(expires, 0).UTC(), nil
+}
+
+// DeleteByUserId removes the reset token of a user.
+func (r *PasswordResetSqliteRepository) DeleteByUserId(userId int64) error {
+	_, err := r.db.Exec(`DELETE FROM PASSWORD_RESET WHERE USER = ?;`, userId)
+	return err
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// Permission allows a user or controller to perform a certain kind of request.
+type Permission string
+
+const (
+	PlantsRead       Permission = "plants:read"       // Read plants and plant groups
+	PlantsWrite      Permission = "plants:write"      // Create, update and delete plants and plant groups
+	AllPlantGroups   Permission = "plant-groups:all"  // Access all plant groups without being granted access
+	SensorDataRead   Permission = "sensor-data:read"  // Read sensor data and sensor types
+	SensorDataWrite  Permission = "sensor-data:write" // Post sensor data
+	SensorDataAdmin  Permission = "sensor-data:admin" // Review quarantined sensor data
+	ControllersRead  Permission = "controllers:read"  // Read controllers
+	ControllersAdmin Permission = "controllers:admin" // Manage the API keys of controllers
+	UsersAdmin       Permission = "users:admin"       // Manage users, their sessions and their access
+	AuditRead        Permission = "audit:read"        // Read the audit log
+	OwnAccount       Permission = "account:self"      // Read the own profile and change the own password
+)
+
+// rolePermissions maps each role to the permissions its users have.
+var rolePermissions = map[Role][]Permission{
+	Admin: {
+		PlantsRead, PlantsWrite, AllPlantGroups,
+		SensorDataRead, SensorDataWrite, SensorDataAdmin,
+		ControllersRead, ControllersAdmin,
+		UsersAdmin, AuditRead,
+		OwnAccount,
+	},
+	Gardener: {
+		PlantsRead, PlantsWrite,
+		SensorDataRead, SensorDataWrite,
+		ControllersRead,
+		OwnAccount,
+	},
+	Viewer: {
+		PlantsRead,
+		SensorDataRead,
+		ControllersRead,
+		OwnAccount,
+	},
+}
+
+// controllerPermissions are the permissions of micro-controllers authenticated by their API key.
+var controllerPermissions = []Permission{SensorDataWrite}
+
+// RoutePermissions declares the permission needed for each HTTP method of a route.
+// Methods that are not declared are not allowed at all.
+type RoutePermissions map[string]Permission
+
+// methods returns the declared HTTP methods in a stable order, e.g. for the Allow header.
+func (p RoutePermissions) methods() string {
+	methods := make([]string, 0, len(p))
+	for method := range p {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// IsValid returns true if the role is known.
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Permissions returns all permissions of users with this role.
+func (r Role) Permissions() []Permission {
+	return append([]Permission{}, rolePermissions[r]...)
+}
+
+// HasPermission returns true if users with this role have the given permission.
+func (r Role) HasPermission(permission Permission) bool {
+	return containsPermission(rolePermissions[r], permission)
+}
+
+// IsValid returns true if the permission is known. Admins have all permissions.
+func (p Permission) IsValid() bool {
+	return containsPermission(rolePermissions[Admin], p)
+}
+
+// Permissions returns all permissions of the user. Users who have to enable two-factor authentication
+// first may only manage their own account. Users authenticated by a personal access token only have the
+// permissions of their role that are part of the token's scopes.
+func (u *SafeUser) Permissions() []Permission {
+	permissions := u.Role.Permissions()
+	if u.totpPending {
+		permissions = []Permission{OwnAccount}
+	}
+
+	if u.scopes == nil {
+		return permissions
+	}
+
+	scoped := make([]Permission, 0, len(u.scopes))
+	for _, permission := range permissions {
+		if containsPermission(u.scopes, permission) {
+			scoped = append(scoped, permission)
+		}
+	}
+
+	return scoped
+}
+
+// HasPermission returns true if the user has the given permission.
+func (u *SafeUser) HasPermission(permission Permission) bool {
+	return containsPermission(u.Permissions(), permission)
+}
+
+// HasPermission returns true if the user or controller authenticated by the middleware has the given permission.
+func HasPermission(ctx context.Context, permission Permission) bool {
+	if user, ok := UserFromContext(ctx); ok {
+		return user.HasPermission(permission)
+	}
+
+	if _, ok := ControllerFromContext(ctx); ok {
+		return containsPermission(controllerPermissions, permission)
+	}
+
+	return false
+}
+
+// containsPermission returns true if the given permission is part of the slice.
+func containsPermission(permissions []Permission, permission Permission) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requiredPermission returns the permission needed for the request.
+// If the method is not declared, it writes an error response and returns false.
+func requiredPermission(w http.ResponseWriter, r *http.Request, permissions RoutePermissions) (Permission, bool) {
+	permission, ok := permissions[r.Method]
+	if !ok {
+		w.Header().Set("Allow", permissions.methods())
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: "+permissions.methods())
+	}
+
+	return permission, ok
+}
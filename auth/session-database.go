@@ -0,0 +1,25 @@
+package auth
+
+// SessionRepository provides access to the login sessions of users.
+type SessionRepository interface {
+	// GetByToken returns the session identified by the given token hash.
+	GetByToken(tokenHash string) (*Session, error)
+
+	// GetAllByUserId returns all sessions of the given user.
+	GetAllByUserId(userId int64) ([]*Session, error)
+
+	// Create stores a new session identified by the given token hash and returns it.
+	Create(session *Session, tokenHash string) (*Session, error)
+
+	// DeleteById deletes a single session.
+	DeleteById(id int64) error
+
+	// DeleteAllByUserId deletes all sessions of the given user.
+	DeleteAllByUserId(userId int64) error
+
+	// DeleteOthersByUserId deletes all sessions of the given user except the given one.
+	DeleteOthersByUserId(userId int64, keepId int64) error
+
+	// DeleteExpired deletes all sessions that have expired.
+	DeleteExpired() error
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// userSessionsHandler handles all requests to `/v1/user/{id}/sessions` and `/v1/user/{id}/sessions/{sessionId}`.
+func userSessionsHandler(w http.ResponseWriter, r *http.Request, userId int64, segments []string) {
+	switch len(segments) {
+	case 0:
+		switch r.Method {
+		case http.MethodGet:
+			handleUserSessionsGet(w, r, userId)
+		case http.MethodDelete:
+			handleUserSessionsDelete(w, r, userId)
+		default:
+			utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET, DELETE")
+		}
+	case 1:
+		sessionId, err := strconv.ParseInt(segments[0], 10, 64)
+		if err != nil {
+			utils.HttpBadRequestResponse(w, "No session id supplied")
+			return
+		}
+
+		if r.Method != http.MethodDelete {
+			utils.HttpMethodNotAllowedResponse(w, "Allowed methods: DELETE")
+			return
+		}
+		handleUserSessionDelete(w, r, userId, sessionId)
+	default:
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("Unknown resource %s", r.URL.Path))
+	}
+}
+
+// handleUserSessionsGet handles GET requests to the user sessions endpoint.
+func handleUserSessionsGet(w http.ResponseWriter, r *http.Request, userId int64) {
+	sessions, err := getSessionsByUserId(userId)
+	switch err {
+	case nil:
+		if sessions == nil {
+			sessions = make([]*Session, 0)
+		}
+
+		b, err := json.Marshal(&Sessions{Sessions: sessions})
+		if err != nil {
+			msg := fmt.Sprintf("Error converting sessions of user %d to JSON: %s", userId, err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		log.Printf("Loaded %d sessions of user %d", len(sessions), userId)
+		utils.HttpOkResponse(w, b)
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("User with id %d not found", userId)
+		utils.HttpNotFoundResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error while loading sessions of user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleUserSessionsDelete handles DELETE requests to the user sessions endpoint.
+// It revokes all sessions of the user.
+func handleUserSessionsDelete(w http.ResponseWriter, r *http.Request, userId int64) {
+	sessions, err := getSessionsByUserId(userId)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("User with id %d not found", userId))
+		return
+	default:
+		msg := fmt.Sprintf("Error while loading sessions of user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	err = deleteSessionsByUserId(userId)
+	if err != nil {
+		msg := fmt.Sprintf("Error while revoking sessions of user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	for _, session := range sessions {
+		RecordAudit(r, auditEntitySession, session.Id, session, nil)
+	}
+
+	log.Printf("Revoked all sessions of user %d", userId)
+	utils.HttpOkResponse(w, nil)
+}
+
+// handleUserSessionDelete handles DELETE requests to a single session of a user.
+func handleUserSessionDelete(w http.ResponseWriter, r *http.Request, userId int64, sessionId int64) {
+	sessions, err := getSessionsByUserId(userId)
+	if err != nil && err != sql.ErrNoRows {
+		msg := fmt.Sprintf("Error while loading sessions of user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	for _, session := range sessions {
+		if session.Id == sessionId {
+			err = deleteSessionById(sessionId)
+			if err != nil {
+				msg := fmt.Sprintf("Error while revoking session %d: %s", sessionId, err.Error())
+				utils.HttpInternalServerErrorResponse(w, msg)
+				return
+			}
+
+			RecordAudit(r, auditEntitySession, sessionId, session, nil)
+
+			log.Printf("Revoked session %d of user %d", sessionId, userId)
+			utils.HttpOkResponse(w, nil)
+			return
+		}
+	}
+
+	msg := fmt.Sprintf("Session with id %d of user %d not found", sessionId, userId)
+	utils.HttpNotFoundResponse(w, msg)
+}
+
+// getSessionsByUserId returns all sessions of the given user.
+// It returns sql.ErrNoRows if the user does not exist.
+func getSessionsByUserId(userId int64) ([]*Session, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	userRepo, err := NewUserRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = userRepo.GetById(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionRepo, err := NewSessionRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return sessionRepo.GetAllByUserId(userId)
+}
+
+// deleteSessionsByUserId deletes all sessions of the given user.
+func deleteSessionsByUserId(userId int64) error {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	repo, err := NewSessionRepository(session)
+	if err != nil {
+		return err
+	}
+
+	return repo.DeleteAllByUserId(userId)
+}
+
+// deleteSessionById deletes a single session.
+func deleteSessionById(id int64) error {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	repo, err := NewSessionRepository(session)
+	if err != nil {
+		return err
+	}
+
+	return repo.DeleteById(id)
+}
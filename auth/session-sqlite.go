@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// SessionSqliteRepository implements the SessionRepository interface.
+// Timestamps are stored as unix seconds.
+type SessionSqliteRepository struct {
+	db db.Querier
+}
+
+// NewSessionRepository creates a new SessionRepository.
+func NewSessionRepository(session *db.Session) (SessionRepository, error) {
+	if !session.IsOpen() {
+		return nil, errors.New("session is not open")
+	}
+
+	return &SessionSqliteRepository{
+		db: session.Querier(),
+	}, nil
+}
+
+// GetByToken returns the session identified by the given token hash.
+func (r *SessionSqliteRepository) GetByToken(tokenHash string) (*Session, error) {
+	var id int64
+	var user int64
+	var created int64
+	var expires int64
+
+	err := r.db.QueryRow(`
+    SELECT
+        S.ID,
+        S.USER,
+        S.CREATED,
+        S.EXPIRES
+    FROM SESSION S
+    WHERE S.TOKEN = ?;`, tokenHash).Scan(&id, &user, &created, &expires)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		Id:      id,
+		User:    user,
+		Created: time.Unix(created, 0).UTC(),
+		Expires: time.Unix(expires, 0).UTC(),
+	}, nil
+}
+
+// GetAllByUserId returns all sessions of the given user.
+func (r *SessionSqliteRepository) GetAllByUserId(userId int64) ([]*Session, error) {
+	rows, err := r.db.Query(`
+    SELECT
+        S.ID,
+        S.USER,
+        S.CREATED,
+        S.EXPIRES
+    FROM SESSION S
+    WHERE S.USER = ?
+    ORDER BY S.ID;`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		var id int64
+		var user int64
+		var created int64
+		var expires int64
+
+		err := rows.Scan(&id, &user, &created, &expires)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &Session{
+			Id:      id,
+			User:    user,
+			Created: time.Unix(created, 0).UTC(),
+			Expires: time.Unix(expires, 0).UTC(),
+		})
+	}
+
+	return sessions, nil
+}
+
+// Create stores a new session identified by the given token hash and returns it.
+func (r *SessionSqliteRepository) Create(session *Session, tokenHash string) (*Session, error) {
+	_, err := r.db.Exec(`
+    INSERT INTO SESSION (USER, TOKEN, CREATED, EXPIRES)
+    VALUES (?, ?, ?, ?);`,
+		session.User,
+		tokenHash,
+		session.Created.Unix(),
+		session.Expires.Unix())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetByToken(tokenHash)
+}
+
+// DeleteById deletes a single session.
+func (r *SessionSqliteRepository) DeleteById(id int64) error {
+	_, err := r.db.Exec(`
+    DELETE FROM SESSION
+    WHERE ID = ?;`, id)
+
+	return err
+}
+
+// DeleteAllByUserId deletes all sessions of the given user.
+func (r *SessionSqliteRepository) DeleteAllByUserId(userId int64) error {
+	_, err := r.db.Exec(`
+    DELETE FROM SESSION
+    WHERE USER = ?;`, userId)
+
+	return err
+}
+
+// DeleteOthersByUserId deletes all sessions of the given user except the given one.
+func (r *SessionSqliteRepository) DeleteOthersByUserId(userId int64, keepId int64) error {
+	_, err := r.db.Exec(`
+    DELETE FROM SESSION
+    WHERE USER = ?
+        AND ID != ?;`, userId, keepId)
+
+	return err
+}
+
+// DeleteExpired deletes all sessions that have expired.
+func (r *SessionSqliteRepository) DeleteExpired() error {
+	_, err := r.db.Exec(`
+    DELETE FROM SESSION
+    WHERE EXPIRES <= ?;`, time.Now().Unix())
+
+	return err
+}
@@ -0,0 +1,28 @@
+package auth
+
+// TotpRepository provides access to the TOTP secrets and recovery codes of users.
+type TotpRepository interface {
+	// GetByUserId returns the TOTP secret of a user, whether enabled or not.
+	GetByUserId(userId int64) (*Totp, error)
+
+	// Save stores a new, not yet enabled secret for a user, replacing any previous one.
+	Save(totp *Totp) error
+
+	// Enable enables the secret of a user after the first code has been verified.
+	Enable(userId int64, lastStep int64) error
+
+	// UpdateLastStep remembers the period of the last code used, so it cannot be replayed.
+	UpdateLastStep(userId int64, lastStep int64) error
+
+	// DeleteByUserId removes the secret and all recovery codes of a user.
+	DeleteByUserId(userId int64) error
+
+	// ReplaceRecoveryCodes replaces all recovery codes of a user by the given hashes.
+	ReplaceRecoveryCodes(userId int64, hashes []string) error
+
+	// UseRecoveryCode removes a recovery code of a user. It returns false if the code does not exist.
+	UseRecoveryCode(userId int64, hash string) (bool, error)
+
+	// CountRecoveryCodes returns the number of unused recovery codes of a user.
+	CountRecoveryCodes(userId int64) (int, error)
+}
@@ -0,0 +1,441 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// auditEntityTotp is the entity type of changes to two-factor authentication in the audit log.
+const auditEntityTotp = "totp"
+
+// meTotpHandler handles all requests to `/v1/me/totp`, the two-factor authentication of the authenticated user.
+func meTotpHandler(w http.ResponseWriter, r *http.Request, user *SafeUser, segments []string) {
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodGet:
+		handleUserTotpGet(w, r, user.Id)
+	case len(segments) == 0 && r.Method == http.MethodPost:
+		handleMeTotpPost(w, r, user)
+	case len(segments) == 0 && r.Method == http.MethodDelete:
+		handleMeTotpDelete(w, r, user)
+	case len(segments) == 0:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET, POST, DELETE")
+	case len(segments) == 1 && segments[0] == "verify" && r.Method == http.MethodPost:
+		handleMeTotpVerifyPost(w, r, user)
+	case len(segments) == 1 && segments[0] == "recovery-codes" && r.Method == http.MethodPost:
+		handleMeRecoveryCodesPost(w, r, user)
+	case len(segments) == 1 && (segments[0] == "verify" || segments[0] == "recovery-codes"):
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: POST")
+	default:
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("Unknown resource %s", r.URL.Path))
+	}
+}
+
+// userTotpHandler handles all requests to `/v1/user/{id}/totp`.
+// Admins can check and reset the two-factor authentication of a user, e.g. if they lost their device.
+func userTotpHandler(w http.ResponseWriter, r *http.Request, userId int64) {
+	switch r.Method {
+	case http.MethodGet:
+		handleUserTotpGet(w, r, userId)
+	case http.MethodDelete:
+		handleUserTotpDelete(w, r, userId)
+	default:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET, DELETE")
+	}
+}
+
+// handleUserTotpGet handles GET requests to the TOTP endpoints.
+// It returns whether the user has enabled two-factor authentication.
+func handleUserTotpGet(w http.ResponseWriter, r *http.Request, userId int64) {
+	status, err := getTotpStatus(userId)
+	switch err {
+	case nil:
+		b, err := json.Marshal(status)
+		if err != nil {
+			msg := fmt.Sprintf("Error converting TOTP status of user %d to JSON: %s", userId, err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		utils.HttpOkResponse(w, b)
+	case sql.ErrNoRows:
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("User with id %d not found", userId))
+	default:
+		msg := fmt.Sprintf("Error getting TOTP status of user %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleMeTotpPost handles POST requests to the TOTP endpoint of the authenticated user.
+// It generates a new secret, which is enabled once the first code has been verified.
+func handleMeTotpPost(w http.ResponseWriter, r *http.Request, user *SafeUser) {
+	secret, err := enrollTotp(user.Id)
+	switch err {
+	case nil:
+		b, err := json.Marshal(&TotpEnrollment{
+			Secret: secret,
+			Uri:    utils.TotpUri(totpIssuer, user.Name, secret),
+		})
+		if err != nil {
+			msg := fmt.Sprintf("Error converting TOTP secret of user %s to JSON: %s", user.Name, err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		log.Printf("User %s started enabling two-factor authentication", user.Name)
+		utils.HttpOkResponse(w, b)
+	case ErrTotpAlreadyEnabled:
+		utils.HttpConflictResponse(w, "Two-factor authentication is already enabled")
+	default:
+		msg := fmt.Sprintf("Error generating TOTP secret of user %s: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleMeTotpVerifyPost handles POST requests to verify the first TOTP code of the authenticated user.
+// It enables two-factor authentication and returns the recovery codes.
+func handleMeTotpVerifyPost(w http.ResponseWriter, r *http.Request, user *SafeUser) {
+	confirmation, ok := decodeTotpConfirmation(w, r, user)
+	if !ok {
+		return
+	}
+
+	codes, err := enableTotp(user.Id, confirmation.Code)
+	switch err {
+	case nil:
+		b, err := json.Marshal(&RecoveryCodes{RecoveryCodes: codes})
+		if err != nil {
+			msg := fmt.Sprintf("Error converting recovery codes of user %s to JSON: %s", user.Name, err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		RecordAudit(r, auditEntityTotp, user.Id, &TotpStatus{Enabled: false}, &TotpStatus{Enabled: true})
+
+		log.Printf("User %s enabled two-factor authentication", user.Name)
+		utils.HttpOkResponse(w, b)
+	case ErrTotpAlreadyEnabled:
+		utils.HttpConflictResponse(w, "Two-factor authentication is already enabled")
+	case ErrTotpNotEnabled, sql.ErrNoRows:
+		utils.HttpConflictResponse(w, "No TOTP secret to verify, generate one first")
+	case ErrInvalidTotpCode:
+		recordFailedLogin(r, user.Name)
+		utils.HttpForbiddenResponse(w, "Invalid TOTP code")
+	default:
+		msg := fmt.Sprintf("Error enabling two-factor authentication of user %s: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleMeRecoveryCodesPost handles POST requests to the recovery codes of the authenticated user.
+// A valid code has to be confirmed. All previous recovery codes are replaced.
+func handleMeRecoveryCodesPost(w http.ResponseWriter, r *http.Request, user *SafeUser) {
+	confirmation, ok := decodeTotpConfirmation(w, r, user)
+	if !ok {
+		return
+	}
+
+	codes, err := regenerateRecoveryCodes(user.Id, confirmation.Code)
+	switch err {
+	case nil:
+		b, err := json.Marshal(&RecoveryCodes{RecoveryCodes: codes})
+		if err != nil {
+			msg := fmt.Sprintf("Error converting recovery codes of user %s to JSON: %s", user.Name, err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		log.Printf("User %s generated new recovery codes", user.Name)
+		utils.HttpOkResponse(w, b)
+	case ErrTotpNotEnabled, sql.ErrNoRows:
+		utils.HttpConflictResponse(w, "Two-factor authentication is not enabled")
+	case ErrInvalidTotpCode:
+		recordFailedLogin(r, user.Name)
+		utils.HttpForbiddenResponse(w, "Invalid TOTP code")
+	default:
+		msg := fmt.Sprintf("Error generating recovery codes of user %s: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleMeTotpDelete handles DELETE requests to the TOTP endpoint of the authenticated user.
+// A valid code has to be confirmed. Users who are required to use two-factor authentication cannot disable it.
+func handleMeTotpDelete(w http.ResponseWriter, r *http.Request, user *SafeUser) {
+	if totpRequired(user.Role) {
+		utils.HttpConflictResponse(w, "Two-factor authentication is required for admins")
+		return
+	}
+
+	confirmation, ok := decodeTotpConfirmation(w, r, user)
+	if !ok {
+		return
+	}
+
+	err := disableTotp(user.Id, confirmation.Code)
+	switch err {
+	case nil:
+		RecordAudit(r, auditEntityTotp, user.Id, &TotpStatus{Enabled: true}, &TotpStatus{Enabled: false})
+
+		log.Printf("User %s disabled two-factor authentication", user.Name)
+		utils.HttpOkResponse(w, nil)
+	case ErrTotpNotEnabled, sql.ErrNoRows:
+		utils.HttpConflictResponse(w, "Two-factor authentication is not enabled")
+	case ErrInvalidTotpCode:
+		recordFailedLogin(r, user.Name)
+		utils.HttpForbiddenResponse(w, "Invalid TOTP code")
+	default:
+		msg := fmt.Sprintf("Error disabling two-factor authentication of user %s: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleUserTotpDelete handles DELETE requests to the TOTP endpoint of a user.
+// It disables two-factor authentication without a code, so the user can enable it again on a new device.
+func handleUserTotpDelete(w http.ResponseWriter, r *http.Request, userId int64) {
+	user, err := getUserById(userId)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("User with id %d not found", userId))
+		return
+	default:
+		msg := fmt.Sprintf("Error getting user with id %d: %s", userId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	previous, err := getTotpStatus(userId)
+	if err != nil {
+		msg := fmt.Sprintf("Error getting TOTP status of user %s: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	err = resetTotp(userId)
+	if err != nil {
+		msg := fmt.Sprintf("Error resetting two-factor authentication of user %s: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	current, err := getTotpStatus(userId)
+	if err != nil {
+		msg := fmt.Sprintf("Error getting TOTP status of user %s: %s", user.Name, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	RecordAudit(r, auditEntityTotp, userId, previous, current)
+
+	log.Printf("Reset two-factor authentication of user %s", user.Name)
+	utils.HttpOkResponse(w, nil)
+}
+
+// decodeTotpConfirmation decodes the code confirming a change from the request body.
+// If it cannot be decoded, it writes an error response and returns false.
+func decodeTotpConfirmation(w http.ResponseWriter, r *http.Request, user *SafeUser) (*TotpConfirmation, bool) {
+	var confirmation TotpConfirmation
+	err := json.NewDecoder(r.Body).Decode(&confirmation)
+	if err != nil {
+		msg := fmt.Sprintf("Error decoding TOTP code of user %s: %s", user.Name, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return nil, false
+	}
+
+	if confirmation.Code == "" {
+		utils.HttpBadRequestResponse(w, "No TOTP code supplied")
+		return nil, false
+	}
+
+	return &confirmation, true
+}
+
+// getTotpStatus returns whether a user has enabled two-factor authentication.
+func getTotpStatus(userId int64) (*TotpStatus, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	userRepo, err := NewUserRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	totpRepo, err := NewTotpRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := userRepo.GetById(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &TotpStatus{Required: totpRequired(user.Role)}
+	totp, err := totpRepo.GetByUserId(userId)
+	if err == sql.ErrNoRows {
+		return status, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	status.Enabled = totp.Enabled
+	status.RecoveryCodesLeft, err = totpRepo.CountRecoveryCodes(userId)
+	return status, err
+}
+
+// enrollTotp generates a new TOTP secret for a user, replacing a secret that has not been enabled yet.
+func enrollTotp(userId int64) (string, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return "", err
+	}
+
+	repo, err := NewTotpRepository(session)
+	if err != nil {
+		return "", err
+	}
+
+	totp, err := repo.GetByUserId(userId)
+	if err == nil && totp.Enabled {
+		return "", ErrTotpAlreadyEnabled
+	} else if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	secret, err := utils.GenerateTotpSecret()
+	if err != nil {
+		return "", err
+	}
+
+	err = repo.Save(&Totp{User: userId, Secret: secret, Created: time.Now()})
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// enableTotp enables the TOTP secret of a user if the code matches and returns new recovery codes.
+func enableTotp(userId int64, code string) ([]string, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := NewTotpRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	totp, err := repo.GetByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if totp.Enabled {
+		return nil, ErrTotpAlreadyEnabled
+	}
+
+	step, ok := utils.CheckTotp(totp.Secret, code, time.Now(), totp.LastStep)
+	if !ok {
+		return nil, ErrInvalidTotpCode
+	}
+
+	err = repo.Enable(userId, step)
+	if err != nil {
+		return nil, err
+	}
+
+	return generateRecoveryCodes(repo, userId)
+}
+
+// regenerateRecoveryCodes replaces the recovery codes of a user if the code matches.
+func regenerateRecoveryCodes(userId int64, code string) ([]string, error) {
+	totp, err := confirmSecondFactor(userId, code)
+	if err != nil {
+		return nil, err
+	}
+
+	var session = db.NewSession()
+	defer session.Close()
+
+	err = session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := NewTotpRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return generateRecoveryCodes(repo, totp.User)
+}
+
+// disableTotp removes the TOTP secret and recovery codes of a user if the code matches.
+func disableTotp(userId int64, code string) error {
+	_, err := confirmSecondFactor(userId, code)
+	if err != nil {
+		return err
+	}
+
+	return resetTotp(userId)
+}
+
+// confirmSecondFactor returns the enabled TOTP secret of a user if the code matches.
+func confirmSecondFactor(userId int64, code string) (*Totp, error) {
+	totp, err := getTotp(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !totp.Enabled {
+		return nil, ErrTotpNotEnabled
+	}
+
+	valid, err := verifySecondFactor(totp, code, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !valid {
+		return nil, ErrInvalidTotpCode
+	}
+
+	return totp, nil
+}
+
+// resetTotp removes the TOTP secret and recovery codes of a user.
+func resetTotp(userId int64) error {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	repo, err := NewTotpRepository(session)
+	if err != nil {
+		return err
+	}
+
+	return repo.DeleteByUserId(userId)
+}
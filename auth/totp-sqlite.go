@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// TotpSqliteRepository implements the TotpRepository interface.
+type TotpSqliteRepository struct {
+	db db.Querier
+}
+
+// NewTotpRepository creates a new TotpRepository.
+func NewTotpRepository(session *db.Session) (TotpRepository, error) {
+	if !session.IsOpen() {
+		return nil, errors.New("session is not open")
+	}
+
+	return &TotpSqliteRepository{db: session.Querier()}, nil
+}
+
+// GetByUserId returns the TOTP secret of a user, whether enabled or not.
+func (r *TotpSqliteRepository) GetByUserId(userId int64) (*Totp, error) {
+	var totp Totp
+	var created int64
+	err := r.db.QueryRow(`
+    SELECT
+        UT.USER,
+        UT.SECRET,
+        UT.ENABLED,
+        UT.LAST_STEP,
+        UT.CREATED
+    FROM USER_TOTP UT
+    WHERE UT.USER = ?;`, userId).Scan(&totp.User, &totp.Secret, &totp.Enabled, &totp.LastStep, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	totp.Created = time.Unix(created, 0).UTC()
+	return &totp, nil
+}
+
+// Save stores a new, not yet enabled secret for a user, replacing any previous one.
+func (r *TotpSqliteRepository) Save(totp *Totp) error {
+	_, err := r.db.Exec(`
+    INSERT OR REPLACE INTO USER_TOTP (USER, SECRET, ENABLED, LAST_STEP, CREATED)
+    VALUES (?, ?, 0, 0, ?);`, totp.User, totp.Secret, totp.Created.Unix())
+
+	return err
+}
+
+// Enable enables the secret of a user after the first code has been verified.
+func (r *TotpSqliteRepository) Enable(userId int64, lastStep int64) error {
+	_, err := r.db.Exec(`
+    UPDATE USER_TOTP
+    SET ENABLED = 1,
+        LAST_STEP = ?
+    WHERE USER = ?;`, lastStep, userId)
+	return err
+}
+
+// UpdateLastStep remembers the period of the last code used, so it cannot be replayed.
+// A later period recorded concurrently is kept.
+func (r *TotpSqliteRepository) UpdateLastStep(userId int64, lastStep int64) error {
+	_, err := r.db.Exec(`
+    UPDATE USER_TOTP
+    SET LAST_STEP = MAX(LAST_STEP, ?)
+    WHERE USER = ?;`, lastStep, userId)
+	return err
+}
+
+// DeleteByUserId removes the secret and all recovery codes of a user.
+func (r *TotpSqliteRepository) DeleteByUserId(userId int64) error {
+	_, err := r.db.Exec(`
+    DELETE FROM USER_RECOVERY_CODE
+    WHERE USER = ?;`, userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`
+    DELETE FROM USER_TOTP
+    WHERE USER = ?;`, userId)
+	return err
+}
+
+// ReplaceRecoveryCodes replaces all recovery codes of a user by the given hashes.
+func (r *TotpSqliteRepository) ReplaceRecoveryCodes(userId int64, hashes []string) error {
+	return db.Transaction(r.db, func(tx db.Querier) error {
+		_, err := tx.Exec(`
+        DELETE FROM USER_RECOVERY_CODE
+        WHERE USER = ?;`, userId)
+		if err != nil {
+			return err
+		}
+
+		for _, hash := range hashes {
+			_, err = tx.Exec(`
+            INSERT INTO USER_RECOVERY_CODE (USER, CODE)
+            VALUES (?, ?);`, userId, hash)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// UseRecoveryCode removes a recovery code of a user. It returns false if the code does not exist.
+func (r *TotpSqliteRepository) UseRecoveryCode(userId int64, hash string) (bool, error) {
+	result, err := r.db.Exec(`
+    DELETE FROM USER_RECOVERY_CODE
+    WHERE USER = ?
+      AND CODE = ?;`, userId, hash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of a user.
+func (r *TotpSqliteRepository) CountRecoveryCodes(userId int64) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+    SELECT COUNT(*)
+    FROM USER_RECOVERY_CODE URC
+    WHERE URC.USER = ?;`, userId).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+const (
+	// totpIssuer is shown by authenticator apps next to the account name.
+	totpIssuer = "PlantBuddy"
+
+	// totpHeader carries the TOTP or recovery code along with basic auth.
+	totpHeader = "X-TOTP-Code"
+
+	// recoveryCodeCount is the number of recovery codes handed out when enabling two-factor authentication.
+	recoveryCodeCount = 10
+)
+
+// checkSecondFactor checks the TOTP or recovery code sent along with the password of a user.
+// Users without two-factor authentication pass without a code. A wrong code counts as failed login.
+// If login is set, a session is issued, so a TOTP code that has been used before is rejected. Otherwise, the code
+// may be sent along with every request authenticated with basic auth within its period, but not be used to log in.
+func checkSecondFactor(r *http.Request, user *User, login bool) error {
+	totp, err := getTotp(user.Id)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !totp.Enabled {
+		return nil
+	}
+
+	code := r.Header.Get(totpHeader)
+	if code == "" {
+		return ErrTotpRequired
+	}
+
+	valid, err := verifySecondFactor(totp, code, login)
+	if err != nil {
+		return err
+	}
+
+	if !valid {
+		recordFailedLogin(r, user.Name)
+		return ErrInvalidTotpCode
+	}
+
+	return nil
+}
+
+// verifySecondFactor checks a TOTP code or, if it does not look like one, a recovery code.
+// The period of every accepted TOTP code is recorded, so the code cannot be used again where consume is set.
+// Without consume, codes of the recorded period are still accepted. Recovery codes are always invalidated.
+func verifySecondFactor(totp *Totp, code string, consume bool) (bool, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return false, err
+	}
+
+	repo, err := NewTotpRepository(session)
+	if err != nil {
+		return false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if !strings.Contains(code, "-") {
+		lastStep := totp.LastStep
+		if !consume {
+			lastStep = 0
+		}
+
+		step, ok := utils.CheckTotp(totp.Secret, code, time.Now(), lastStep)
+		if !ok {
+			return false, nil
+		}
+
+		if step <= totp.LastStep {
+			return true, nil
+		}
+
+		return true, repo.UpdateLastStep(totp.User, step)
+	}
+
+	return repo.UseRecoveryCode(totp.User, utils.HashToken(strings.ToLower(code)))
+}
+
+// markTotpPending flags admins who have to enable two-factor authentication, if required by the configuration.
+func markTotpPending(user *SafeUser) error {
+	if !totpRequired(user.Role) {
+		return nil
+	}
+
+	totp, err := getTotp(user.Id)
+	if err == sql.ErrNoRows {
+		user.totpPending = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	user.totpPending = !totp.Enabled
+	return nil
+}
+
+// totpRequired returns true if users with the given role have to enable two-factor authentication.
+func totpRequired(role Role) bool {
+	return config.PlantBuddyConfig.Auth.RequireAdminTotp && role == Admin
+}
+
+// generateRecoveryCodes generates new recovery codes for a user and stores their hashes,
+// replacing all previous ones. It returns the codes in plain text.
+func generateRecoveryCodes(repo TotpRepository, userId int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = code
+		hashes[i] = utils.HashToken(code)
+	}
+
+	err := repo.ReplaceRecoveryCodes(userId, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// getTotp returns the TOTP secret of a user.
+func getTotp(userId int64) (*Totp, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := NewTotpRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.GetByUserId(userId)
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+)
+
+// testTotpSecret is the secret of the test vectors in RFC 6238, appendix B ("12345678901234567890").
+const testTotpSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// testTotpCode computes the code of a period for testTotpSecret (RFC 4226, section 5.3).
+func testTotpCode(t *testing.T, step int64) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(testTotpSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+func TestVerifySecondFactorRecordsStep(t *testing.T) {
+	dbtest.Setup(t)
+
+	user, err := createUser(&User{Name: "totp", Password: "", Role: Gardener, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbtest.Exec(t, `
+    INSERT INTO USER_TOTP (USER, SECRET, ENABLED, LAST_STEP, CREATED)
+    VALUES (?, ?, 1, 0, 0);`, user.Id, testTotpSecret)
+
+	current := time.Now().Unix() / 30
+
+	// Each step depends on the period recorded by the previous ones
+	steps := []struct {
+		name     string
+		step     int64
+		consume  bool
+		valid    bool
+		lastStep int64
+	}{
+		{"basic auth", current, false, true, current},
+		{"basic auth again", current, false, true, current},
+		{"login with recorded code", current, true, false, current},
+		{"login with older code", current - 1, true, false, current},
+		{"login with next code", current + 1, true, true, current + 1},
+		{"basic auth with older code", current, false, true, current + 1},
+	}
+
+	for _, step := range steps {
+		totp, err := getTotp(user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		valid, err := verifySecondFactor(totp, testTotpCode(t, step.step), step.consume)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if valid != step.valid {
+			t.Errorf("%s: got valid %t, want %t", step.name, valid, step.valid)
+		}
+
+		totp, err = getTotp(user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if totp.LastStep != step.lastStep {
+			t.Errorf("%s: got last step %d, want %d", step.name, totp.LastStep, step.lastStep)
+		}
+	}
+}
@@ -8,24 +8,48 @@ import (
 	"github.com/plantineers/plantbuddy-server/utils"
 )
 
-// Takes as parameters the function serving the endpoint, the minimum role
-func UserAuthMiddleware(f func(http.ResponseWriter, *http.Request), role Role) http.Handler {
+// Takes as parameters the function serving the endpoint and the permission needed for each HTTP method
+func UserAuthMiddleware(f func(http.ResponseWriter, *http.Request), permissions RoutePermissions) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handler := http.HandlerFunc(f)
 
+		permission, ok := requiredPermission(w, r, permissions)
+		if !ok {
+			return
+		}
+
 		user, err := authUser(r)
 		switch err {
 		case ErrWrongCredentials:
 			utils.HttpForbiddenResponse(w, "Wrong credentials")
+		case ErrTotpRequired:
+			utils.HttpUnauthorizedResponse(w, "TOTP code required (send it in the X-TOTP-Code header)", "TOTP")
+		case ErrInvalidTotpCode:
+			utils.HttpForbiddenResponse(w, "Invalid TOTP code")
+		case ErrUserDisabled:
+			utils.HttpForbiddenResponse(w, "User is disabled")
+		case ErrInvalidToken:
+			utils.HttpForbiddenResponse(w, "Invalid or expired token")
+		case ErrTooManyAttempts:
+			utils.HttpTooManyRequestsResponse(w, "Too many failed login attempts", retryAfter(r))
 		case ErrNoCredentials:
 			utils.HttpBadRequestResponse(w, "No credentials supplied")
+		case ErrInvalidAuthHeader:
+			utils.HttpBadRequestResponse(w, "Invalid authorization header (expected Basic or Bearer)")
 		case nil:
-			if user.Role > role {
-				utils.HttpForbiddenResponse(w, "Insufficient permissions")
+			if user.totpPending && permission != OwnAccount {
+				utils.HttpForbiddenResponse(w, "Admins have to enable two-factor authentication first (see /v1/me/totp)")
+				return
+			}
+
+			if !user.HasPermission(permission) {
+				msg := fmt.Sprintf("Insufficient permissions (%s required)", permission)
+				utils.HttpForbiddenResponse(w, msg)
 				return
 			}
 
-			handler.ServeHTTP(w, r)
+			// Pass the user down to the handler
+			handler.ServeHTTP(w, r.WithContext(withUser(r.Context(), user)))
 		default:
 			msg := fmt.Sprintf("Error authenticating user: %s", err.Error())
 			utils.HttpInternalServerErrorResponse(w, msg)
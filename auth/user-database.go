@@ -7,7 +7,17 @@ type UserRepository interface {
 	GetById(id int64) (*User, error)
 	GetByName(name string) (*User, error)
 	GetAll() ([]int64, error)
+
+	// GetAllOverview returns a page of the users matching the filter and the number of all matching users.
+	GetAllOverview(filter *usersFilter) ([]*SafeUser, int, error)
+
 	Create(user *User) error
 	DeleteById(id int64) error
 	Update(user *User) error
+
+	// UpdatePassword replaces the password hash of a user.
+	UpdatePassword(id int64, password string) error
+
+	// CountEnabledByRole returns the number of enabled users with the given role.
+	CountEnabledByRole(role Role) (int, error)
 }
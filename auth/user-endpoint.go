@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/plantineers/plantbuddy-server/db"
 	"github.com/plantineers/plantbuddy-server/utils"
@@ -23,28 +24,74 @@ func UserCreateHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // UserHandler handles all requests to the user endpoint, except POST.
+// Requests to `/v1/user/{id}/sessions`, `/v1/user/{id}/tokens`, `/v1/user/{id}/plant-groups`, `/v1/user/{id}/lockout`,
+// `/v1/user/{id}/totp` and `/v1/user/{id}/password-reset` are passed to their own handlers.
 func UserHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := utils.PathParameterFilter(r.URL.Path, "/v1/user/")
+	segments := utils.PathSegments(r.URL.Path, "/v1/user/")
+	if len(segments) == 0 {
+		utils.HttpBadRequestResponse(w, "No user id supplied")
+		return
+	}
+
+	id, err := strconv.ParseInt(segments[0], 10, 64)
 	if err != nil {
 		utils.HttpBadRequestResponse(w, "No user id supplied")
 		return
 	}
 
+	if len(segments) > 1 && segments[1] == "sessions" {
+		userSessionsHandler(w, r, id, segments[2:])
+		return
+	}
+
+	if len(segments) > 1 && segments[1] == "tokens" {
+		userAccessTokensHandler(w, r, id, segments[2:])
+		return
+	}
+
+	if len(segments) == 2 && segments[1] == "plant-groups" {
+		userAccessHandler(w, r, id)
+		return
+	}
+
+	if len(segments) == 2 && segments[1] == "lockout" {
+		userLockoutHandler(w, r, id)
+		return
+	}
+
+	if len(segments) == 2 && segments[1] == "totp" {
+		userTotpHandler(w, r, id)
+		return
+	}
+
+	if len(segments) == 2 && segments[1] == "password-reset" {
+		userPasswordResetHandler(w, r, id)
+		return
+	}
+
+	if len(segments) > 1 {
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("Unknown resource %s", r.URL.Path))
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		handleUserGet(w, r, id)
 	case http.MethodPut:
 		handleUserPut(w, r, id)
+	case http.MethodPatch:
+		handleUserPatch(w, r, id)
 	case http.MethodDelete:
 		handleUserDelete(w, r, id)
 	default:
-		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET, PUT, DELETE")
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET, PUT, PATCH, DELETE")
 	}
 }
 
 // handleUserPost handles POST requests to the user endpoint.
 func handleUserPost(w http.ResponseWriter, r *http.Request) {
-	var user User
+	// New users are enabled unless stated otherwise
+	user := User{Enabled: true}
 	// Get user from request body
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
@@ -53,16 +100,24 @@ func handleUserPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user.Password = utils.HashPassword(user.Password)
+	err = validateUser(&user)
+	if err != nil {
+		msg := fmt.Sprintf("Error validating new user %s: %s", user.Name, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	user.Password, err = utils.HashPassword(user.Password)
+	if err != nil {
+		msg := fmt.Sprintf("Error hashing password of new user %s: %s", user.Name, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
 
 	createdUser, err := createUser(&user)
 	switch err {
 	case nil:
-		safeUser := &SafeUser{
-			Id:   createdUser.Id,
-			Name: createdUser.Name,
-			Role: createdUser.Role,
-		}
+		safeUser := createdUser.safe()
 
 		b, err := json.Marshal(safeUser)
 		if err != nil {
@@ -71,6 +126,8 @@ func handleUserPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		RecordAudit(r, auditEntityUser, safeUser.Id, nil, safeUser)
+
 		msg := fmt.Sprintf("Created user %s", safeUser.Name)
 		location := fmt.Sprintf("/v1/user/%d", safeUser.Id)
 		utils.HttpCreatedResponse(w, b, location, msg)
@@ -88,11 +145,7 @@ func handleUserGet(w http.ResponseWriter, r *http.Request, id int64) {
 	user, err := getUserById(id)
 	switch err {
 	case nil:
-		safeUser := &SafeUser{
-			Id:   user.Id,
-			Name: user.Name,
-			Role: user.Role,
-		}
+		safeUser := user.safe()
 		b, err := json.Marshal(safeUser)
 		if err != nil {
 			msg := fmt.Sprintf("Error converting safe user %s to JSON: %s", safeUser.Name, err.Error())
@@ -112,53 +165,113 @@ func handleUserGet(w http.ResponseWriter, r *http.Request, id int64) {
 }
 
 // handleUserPut handles PUT requests to the user endpoint.
+// Name, password and role are replaced, so the password is required. Whether the user is enabled
+// or protected is left untouched, as these are changed via PATCH only.
 func handleUserPut(w http.ResponseWriter, r *http.Request, id int64) {
 	var user User
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		msg := fmt.Sprintf("Error decoding new user: %s", err.Error())
+		msg := fmt.Sprintf("Error decoding user with id %d: %s", id, err.Error())
 		utils.HttpBadRequestResponse(w, msg)
 		return
 	}
 
-	user.Password = utils.HashPassword(user.Password)
-	user.Id = id
-
-	err = updateUser(&user)
+	err = validateUser(&user)
 	if err != nil {
-		msg := fmt.Sprintf("Error converting user %s to JSON: %s", user.Name, err.Error())
-		utils.HttpInternalServerErrorResponse(w, msg)
+		msg := fmt.Sprintf("Error validating user with id %d: %s", id, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
 		return
 	}
 
-	safeUser := &SafeUser{
-		Id:   user.Id,
-		Name: user.Name,
-		Role: user.Role,
+	applyUserPatch(w, r, id, &UserPatch{
+		Name:     &user.Name,
+		Password: &user.Password,
+		Role:     &user.Role,
+	})
+}
+
+// handleUserPatch handles PATCH requests to the user endpoint.
+// Only the fields present in the request body are changed.
+func handleUserPatch(w http.ResponseWriter, r *http.Request, id int64) {
+	var patch UserPatch
+	err := json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		msg := fmt.Sprintf("Error decoding changes of user with id %d: %s", id, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
 	}
 
-	b, err := json.Marshal(safeUser)
+	err = validateUserPatch(&patch)
 	if err != nil {
-		msg := fmt.Sprintf("Error converting user %s to JSON: %s", user.Name, err.Error())
-		utils.HttpInternalServerErrorResponse(w, msg)
+		msg := fmt.Sprintf("Error validating changes of user with id %d: %s", id, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
 		return
 	}
 
-	log.Printf("Updated user %s with id %d", user.Name, user.Id)
-	utils.HttpOkResponse(w, b)
+	applyUserPatch(w, r, id, &patch)
+}
+
+// applyUserPatch changes a user and writes the updated user as response.
+func applyUserPatch(w http.ResponseWriter, r *http.Request, id int64, patch *UserPatch) {
+	previous, updated, err := patchUser(id, patch)
+	switch err {
+	case nil:
+		RecordAudit(r, auditEntityUser, id, previous.safe(), updated.safe())
+		if patch.Password != nil {
+			RecordAudit(r, auditEntityPassword, id, nil, nil)
+		}
+
+		b, err := json.Marshal(updated.safe())
+		if err != nil {
+			msg := fmt.Sprintf("Error converting user %s to JSON: %s", updated.Name, err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		log.Printf("Updated user %s with id %d", updated.Name, updated.Id)
+		utils.HttpOkResponse(w, b)
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("User with id %d not found", id)
+		utils.HttpNotFoundResponse(w, msg)
+	case ErrUserAlreadyExists:
+		msg := fmt.Sprintf("User %s already exists", *patch.Name)
+		utils.HttpConflictResponse(w, msg)
+	case ErrLastAdmin, ErrProtectedUser:
+		msg := fmt.Sprintf("Error while updating user with id %d: %s", id, err.Error())
+		utils.HttpConflictResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error while updating user with id %d: %s", id, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
 }
 
 // handleUserDelete handles DELETE requests to the user endpoint.
 func handleUserDelete(w http.ResponseWriter, r *http.Request, id int64) {
-	err := deleteUserById(id)
+	previous, err := getUserById(id)
+	if err == sql.ErrNoRows {
+		msg := fmt.Sprintf("User with id %d not found", id)
+		utils.HttpNotFoundResponse(w, msg)
+		return
+	} else if err != nil {
+		msg := fmt.Sprintf("Error while getting user with id %d: %s", id, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	err = deleteUserById(id)
 
 	switch err {
 	case nil:
+		RecordAudit(r, auditEntityUser, id, previous.safe(), nil)
+
 		log.Printf("Deleted user with id %d", id)
 		utils.HttpOkResponse(w, nil)
-	case ErrCannotDeleteRoot:
-		msg := fmt.Sprintf("Error while deleting user with id %d (user is root): %s", id, err.Error())
+	case ErrProtectedUser:
+		msg := fmt.Sprintf("Error while deleting user with id %d: %s", id, err.Error())
 		utils.HttpForbiddenResponse(w, msg)
+	case ErrLastAdmin:
+		msg := fmt.Sprintf("Error while deleting user with id %d: %s", id, err.Error())
+		utils.HttpConflictResponse(w, msg)
 	default:
 		msg := fmt.Sprintf("Error while deleting user with id %d: %s", id, err.Error())
 		utils.HttpInternalServerErrorResponse(w, msg)
@@ -216,22 +329,123 @@ func getUserById(id int64) (*User, error) {
 	return repo.GetById(id)
 }
 
-// updateUser updates a user in the database.
-func updateUser(user *User) error {
+// patchUser changes the given fields of a user in the database and returns the user before and after.
+// If the password changes or the user is disabled, all sessions of the user are revoked.
+func patchUser(id int64, patch *UserPatch) (*User, *User, error) {
 	session := db.NewSession()
 	defer session.Close()
 
 	err := session.Open()
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	// Hash before taking the write lock, as it takes a while
+	var hash string
+	if patch.Password != nil {
+		hash, err = utils.HashPassword(*patch.Password)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Check and change the user in one transaction, so concurrent changes cannot remove the last admin
+	err = session.Begin()
+	if err != nil {
+		return nil, nil, err
 	}
 
+	// Created after Begin, so they run in the transaction
 	repo, err := NewUserRepository(session)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sessionRepo, err := NewSessionRepository(session)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := repo.GetById(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	previous := *user
+	wasActiveAdmin := user.Enabled && user.Role == Admin
+
+	if patch.Name != nil && *patch.Name != user.Name {
+		_, err = repo.GetByName(*patch.Name)
+		if err == nil {
+			return nil, nil, ErrUserAlreadyExists
+		} else if err != sql.ErrNoRows {
+			return nil, nil, err
+		}
+
+		user.Name = *patch.Name
+	}
+
+	if patch.Role != nil {
+		user.Role = *patch.Role
+	}
+
+	if patch.Enabled != nil {
+		user.Enabled = *patch.Enabled
+	}
+
+	if patch.Protected != nil {
+		user.Protected = *patch.Protected
+	}
+
+	if user.Protected && !user.Enabled {
+		return nil, nil, ErrProtectedUser
+	}
+
+	// Demoting or disabling an admin must leave at least one enabled admin
+	if wasActiveAdmin && !(user.Enabled && user.Role == Admin) {
+		err = ensureNotLastAdmin(repo)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if patch.Password != nil {
+		user.Password = hash
+	}
+
+	err = repo.Update(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Changing the password or disabling the user logs them out everywhere
+	if patch.Password != nil || (previous.Enabled && !user.Enabled) {
+		err = sessionRepo.DeleteAllByUserId(id)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = session.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &previous, user, nil
+}
+
+// ensureNotLastAdmin returns ErrLastAdmin if there is only one enabled admin left, who must not be removed.
+func ensureNotLastAdmin(repo UserRepository) error {
+	admins, err := repo.CountEnabledByRole(Admin)
 	if err != nil {
 		return err
 	}
 
-	return repo.Update(user)
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+
+	return nil
 }
 
 // deleteUserById deletes a user from the database by id.
@@ -244,20 +458,99 @@ func deleteUserById(id int64) error {
 		return err
 	}
 
+	// Check and delete the user in one transaction, so concurrent deletes cannot remove the last admin.
+	// The repositories are created afterwards, so they run in it.
+	err = session.Begin()
+	if err != nil {
+		return err
+	}
+
 	repo, err := NewUserRepository(session)
 	if err != nil {
 		return err
 	}
 
-	user, err := getUserById(id)
+	sessionRepo, err := NewSessionRepository(session)
+	if err != nil {
+		return err
+	}
+
+	accessRepo, err := NewAccessRepository(session)
+	if err != nil {
+		return err
+	}
+
+	identityRepo, err := NewIdentityRepository(session)
 	if err != nil {
 		return err
 	}
 
-	// Prevent admins from deleting the root user
-	if user.Name == "root" {
-		return ErrCannotDeleteRoot
+	totpRepo, err := NewTotpRepository(session)
+	if err != nil {
+		return err
+	}
+
+	resetRepo, err := NewPasswordResetRepository(session)
+	if err != nil {
+		return err
+	}
+
+	tokenRepo, err := NewAccessTokenRepository(session)
+	if err != nil {
+		return err
+	}
+
+	user, err := repo.GetById(id)
+	if err != nil {
+		return err
+	}
+
+	if user.Protected {
+		return ErrProtectedUser
+	}
+
+	if user.Enabled && user.Role == Admin {
+		err = ensureNotLastAdmin(repo)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Foreign keys are not enforced, so everything referencing the user is deleted along with it
+	err = sessionRepo.DeleteAllByUserId(id)
+	if err != nil {
+		return err
+	}
+
+	err = accessRepo.DeleteAllByUserId(id)
+	if err != nil {
+		return err
+	}
+
+	err = identityRepo.DeleteAllByUserId(id)
+	if err != nil {
+		return err
+	}
+
+	err = totpRepo.DeleteByUserId(id)
+	if err != nil {
+		return err
+	}
+
+	err = resetRepo.DeleteByUserId(id)
+	if err != nil {
+		return err
+	}
+
+	err = tokenRepo.DeleteAllByUserId(id)
+	if err != nil {
+		return err
+	}
+
+	err = repo.DeleteById(id)
+	if err != nil {
+		return err
 	}
 
-	return repo.DeleteById(id)
+	return session.Commit()
 }
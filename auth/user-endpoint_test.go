@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+)
+
+// setupTestAdmins creates the given admins and demotes the admins of `buddy-default.sqlite`.
+func setupTestAdmins(t *testing.T, names ...string) []int64 {
+	t.Helper()
+
+	var ids []int64
+	for _, name := range names {
+		user, err := createUser(&User{Name: name, Password: "", Role: Admin, Enabled: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.Id)
+	}
+
+	viewer := Viewer
+	for _, name := range []string{"root", "kruse"} {
+		user, err := getUserByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = patchUser(user.Id, &UserPatch{Role: &viewer})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if admins := countTestAdmins(t); admins != len(names) {
+		t.Fatalf("got %d enabled admins, want %d", admins, len(names))
+	}
+
+	return ids
+}
+
+func countTestAdmins(t *testing.T) int {
+	t.Helper()
+
+	session := db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewUserRepository(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admins, err := repo.CountEnabledByRole(Admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return admins
+}
+
+func TestLastAdminConcurrently(t *testing.T) {
+	viewer := Viewer
+	disabled := false
+
+	tests := []struct {
+		name   string
+		remove func(id int64) error
+	}{
+		{"delete", deleteUserById},
+		{"demote", func(id int64) error {
+			_, _, err := patchUser(id, &UserPatch{Role: &viewer})
+			return err
+		}},
+		{"disable", func(id int64) error {
+			_, _, err := patchUser(id, &UserPatch{Enabled: &disabled})
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dbtest.Setup(t)
+			ids := setupTestAdmins(t, "alice", "bob")
+
+			var wg sync.WaitGroup
+			errs := make([]error, len(ids))
+			for i, id := range ids {
+				wg.Add(1)
+				go func(i int, id int64) {
+					defer wg.Done()
+					errs[i] = test.remove(id)
+				}(i, id)
+			}
+			wg.Wait()
+
+			var removed, refused int
+			for _, err := range errs {
+				switch err {
+				case nil:
+					removed++
+				case ErrLastAdmin:
+					refused++
+				default:
+					t.Fatal(err)
+				}
+			}
+
+			if removed != 1 || refused != 1 {
+				t.Errorf("got %d removed and %d refused admins, want 1 each", removed, refused)
+			}
+
+			if admins := countTestAdmins(t); admins != 1 {
+				t.Errorf("got %d enabled admins, want 1", admins)
+			}
+		})
+	}
+}
@@ -2,15 +2,15 @@
 package auth
 
 import (
-	"database/sql"
 	"errors"
+	"strings"
 
 	"github.com/plantineers/plantbuddy-server/db"
 )
 
 // UserSqliteRepository implements the UserRepository interface.
 type UserSqliteRepository struct {
-	db *sql.DB
+	db db.Querier
 }
 
 // NewUserRepository creates a new UserRepository.
@@ -20,64 +20,52 @@ func NewUserRepository(session *db.Session) (UserRepository, error) {
 	}
 
 	return &UserSqliteRepository{
-		db: session.DB,
+		db: session.Querier(),
 	}, nil
 }
 
 // GetById returns a user by its id.
 func (r *UserSqliteRepository) GetById(id int64) (*User, error) {
-	var userId int64
-	var userName string
-	var userPassword string
-	var userRole Role
+	var user User
 
 	err := r.db.QueryRow(`
     SELECT
         U.ID,
         U.NAME,
         U.PASSWORD,
-        U.ROLE
+        U.ROLE,
+        U.ENABLED,
+        U.PROTECTED
     FROM USERS U
-    WHERE U.ID = ?;`, id).Scan(&userId, &userName, &userPassword, &userRole)
+    WHERE U.ID = ?;`, id).Scan(&user.Id, &user.Name, &user.Password, &user.Role, &user.Enabled, &user.Protected)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &User{
-		Id:       userId,
-		Name:     userName,
-		Password: userPassword,
-		Role:     userRole,
-	}, nil
+	return &user, nil
 }
 
 // GetByName returns a user by its name.
 func (r *UserSqliteRepository) GetByName(name string) (*User, error) {
-	var userId int64
-	var userName string
-	var userPassword string
-	var userRole Role
+	var user User
 
 	err := r.db.QueryRow(`
     SELECT
         U.ID,
         U.NAME,
         U.PASSWORD,
-        U.ROLE
+        U.ROLE,
+        U.ENABLED,
+        U.PROTECTED
     FROM USERS U
-    WHERE U.NAME = ?;`, name).Scan(&userId, &userName, &userPassword, &userRole)
+    WHERE U.NAME = ?;`, name).Scan(&user.Id, &user.Name, &user.Password, &user.Role, &user.Enabled, &user.Protected)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &User{
-		Id:       userId,
-		Name:     userName,
-		Password: userPassword,
-		Role:     userRole,
-	}, nil
+	return &user, nil
 }
 
 // GetAll returns all user ids.
@@ -108,14 +96,81 @@ func (r *UserSqliteRepository) GetAll() ([]int64, error) {
 	return users, nil
 }
 
+// userSortColumns maps the fields users can be sorted by to their columns.
+// The ID is always appended, so pages are stable if several users share a value.
+var userSortColumns = map[string]string{
+	"id":   "U.ID",
+	"name": "U.NAME COLLATE NOCASE",
+	"role": "U.ROLE",
+}
+
+// GetAllOverview returns a page of the users matching the filter and the number of all matching users.
+func (r *UserSqliteRepository) GetAllOverview(filter *usersFilter) ([]*SafeUser, int, error) {
+	order := "ASC"
+	field := strings.TrimPrefix(filter.Sort, "-")
+	if field != filter.Sort {
+		order = "DESC"
+	}
+
+	column, ok := userSortColumns[field]
+	if !ok {
+		column = userSortColumns["id"]
+	}
+
+	// Escape wildcards, so the prefix is matched literally
+	prefix := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.NamePrefix) + "%"
+
+	where := `
+    WHERE (? = 0 OR U.ROLE = ?)
+        AND U.NAME LIKE ? ESCAPE '\'`
+	args := []any{filter.HasRole, filter.Role, prefix}
+
+	var total int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM USERS U`+where+`;`, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`
+    SELECT
+        U.ID,
+        U.NAME,
+        U.ROLE,
+        U.ENABLED,
+        U.PROTECTED
+    FROM USERS U`+where+`
+    ORDER BY `+column+` `+order+`, U.ID `+order+`
+    LIMIT ? OFFSET ?;`, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []*SafeUser
+	for rows.Next() {
+		var user SafeUser
+
+		err = rows.Scan(&user.Id, &user.Name, &user.Role, &user.Enabled, &user.Protected)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		users = append(users, &user)
+	}
+
+	return users, total, nil
+}
+
 // Create creates a new user.
 func (r *UserSqliteRepository) Create(user *User) error {
 	_, err := r.db.Exec(`
-    INSERT INTO USERS (NAME, PASSWORD, ROLE)
-    VALUES (?, ?, ?);`,
+    INSERT INTO USERS (NAME, PASSWORD, ROLE, ENABLED, PROTECTED)
+    VALUES (?, ?, ?, ?, ?);`,
 		user.Name,
 		user.Password,
-		user.Role)
+		user.Role,
+		user.Enabled,
+		user.Protected)
 
 	return err
 }
@@ -133,12 +188,38 @@ func (r *UserSqliteRepository) DeleteById(id int64) error {
 func (r *UserSqliteRepository) Update(user *User) error {
 	_, err := r.db.Exec(`
     UPDATE USERS
-    SET PASSWORD = ?, ROLE = ?, NAME = ?
+    SET PASSWORD = ?, ROLE = ?, NAME = ?, ENABLED = ?, PROTECTED = ?
     WHERE ID = ?;`,
 		user.Password,
 		user.Role,
 		user.Name,
+		user.Enabled,
+		user.Protected,
 		user.Id)
 
 	return err
 }
+
+// UpdatePassword replaces the password hash of a user.
+func (r *UserSqliteRepository) UpdatePassword(id int64, password string) error {
+	_, err := r.db.Exec(`
+    UPDATE USERS
+    SET PASSWORD = ?
+    WHERE ID = ?;`,
+		password,
+		id)
+
+	return err
+}
+
+// CountEnabledByRole returns the number of enabled users with the given role.
+func (r *UserSqliteRepository) CountEnabledByRole(role Role) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+    SELECT COUNT(*)
+    FROM USERS
+    WHERE ROLE = ?
+        AND ENABLED = 1;`, role).Scan(&count)
+
+	return count, err
+}
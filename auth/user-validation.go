@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/plantineers/plantbuddy-server/config"
+)
+
+// validateUserName returns an error if the name cannot be used to log in.
+func validateUserName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("name must not be empty")
+	}
+
+	// Basic auth separates the name from the password by the first colon
+	if strings.Contains(name, ":") {
+		return errors.New("name must not contain a colon")
+	}
+
+	return nil
+}
+
+// maxPasswordBytes is the maximum length of a password, as bcrypt only hashes the first 72 bytes.
+const maxPasswordBytes = 72
+
+// validatePassword returns an error if a new password does not comply with the password policy.
+func validatePassword(password string) error {
+	minLength := config.PlantBuddyConfig.Auth.PasswordMinLength
+	if utf8.RuneCountInString(password) < minLength {
+		return fmt.Errorf("password must be at least %d characters long", minLength)
+	}
+
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must not be longer than %d bytes", maxPasswordBytes)
+	}
+
+	return nil
+}
+
+// validateRole returns an error if the role is unknown.
+func validateRole(role Role) error {
+	if !role.IsValid() {
+		return fmt.Errorf("invalid role %d (allowed: 0 = Admin, 1 = Gardener, 2 = Viewer)", role)
+	}
+
+	return nil
+}
+
+// validateUser returns an error if a new or replaced user is incomplete or invalid.
+func validateUser(user *User) error {
+	return validateUserPatch(&UserPatch{
+		Name:     &user.Name,
+		Password: &user.Password,
+		Role:     &user.Role,
+	})
+}
+
+// validateUserPatch returns an error if any of the fields to be changed is invalid.
+func validateUserPatch(patch *UserPatch) error {
+	if patch.Name != nil {
+		if err := validateUserName(*patch.Name); err != nil {
+			return err
+		}
+	}
+
+	if patch.Password != nil {
+		if err := validatePassword(*patch.Password); err != nil {
+			return err
+		}
+	}
+
+	if patch.Role != nil {
+		if err := validateRole(*patch.Role); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateAccessTokenRequest returns an error if a personal access token to be created for the given user is invalid.
+// Tokens must expire and may only grant permissions the user has.
+func validateAccessTokenRequest(request *AccessTokenRequest, user *SafeUser) error {
+	if strings.TrimSpace(request.Name) == "" {
+		return errors.New("name must not be empty")
+	}
+
+	if len(request.Scopes) == 0 {
+		return errors.New("scopes must not be empty")
+	}
+
+	for _, scope := range request.Scopes {
+		if !scope.IsValid() {
+			return fmt.Errorf("unknown scope %s", scope)
+		}
+
+		if !user.HasPermission(scope) {
+			return fmt.Errorf("scope %s exceeds the permissions of the user", scope)
+		}
+	}
+
+	if request.Expires.IsZero() {
+		return errors.New("expires must be set")
+	}
+
+	now := time.Now()
+	if !request.Expires.After(now) {
+		return errors.New("expires must be in the future")
+	}
+
+	maxLifetime := config.PlantBuddyConfig.Auth.AccessTokenMaxLifetime.Duration
+	if request.Expires.After(now.Add(maxLifetime)) {
+		return fmt.Errorf("expires must be within %s", maxLifetime)
+	}
+
+	return nil
+}
@@ -3,15 +3,23 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/plantineers/plantbuddy-server/utils"
 
 	"github.com/plantineers/plantbuddy-server/db"
 )
 
+const (
+	defaultUsersLimit = 100
+	maxUsersLimit     = 1000
+)
+
 // UsersHandler handles all requests to the users endpoint.
 func UsersHandler(w http.ResponseWriter, r *http.Request) {
 	// UsersHandler only accepts GET requests.
@@ -22,6 +30,15 @@ func UsersHandler(w http.ResponseWriter, r *http.Request) {
 	handleUsersGet(w, r)
 }
 
+// UsersOverviewHandler handles all requests to the users overview endpoint.
+func UsersOverviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET")
+		return
+	}
+	handleUsersOverviewGet(w, r)
+}
+
 // handleUsersGet handles GET requests to the users endpoint.
 func handleUsersGet(w http.ResponseWriter, r *http.Request) {
 	users, err := getAllUsers()
@@ -58,3 +75,108 @@ func getAllUsers() ([]int64, error) {
 
 	return repo.GetAll()
 }
+
+// handleUsersOverviewGet handles GET requests to the users overview endpoint.
+// It returns the users matching the filter along with their names and roles.
+func handleUsersOverviewGet(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterUsers(r)
+	if err != nil {
+		msg := fmt.Sprintf("Error parsing users filter: %s", err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	overview, err := getAllUsersOverview(filter)
+	if err != nil {
+		msg := fmt.Sprintf("Error while loading users: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	b, err := json.Marshal(overview)
+	if err != nil {
+		msg := fmt.Sprintf("Error converting users to JSON: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	log.Printf("Loaded %d of %d users", len(overview.Users), overview.Total)
+	utils.HttpOkResponse(w, b)
+}
+
+// filterUsers parses the query parameters of a request and returns a usersFilter.
+func filterUsers(r *http.Request) (*usersFilter, error) {
+	query := r.URL.Query()
+	filter := &usersFilter{
+		NamePrefix: query.Get("name"),
+		Sort:       query.Get("sort"),
+		Limit:      defaultUsersLimit,
+	}
+
+	if role := query.Get("role"); role != "" {
+		value, err := strconv.ParseInt(role, 10, 8)
+		if err != nil || !Role(value).IsValid() {
+			return nil, fmt.Errorf("unknown role %s", role)
+		}
+
+		filter.Role = Role(value)
+		filter.HasRole = true
+	}
+
+	if filter.Sort == "" {
+		filter.Sort = "id"
+	}
+
+	if _, ok := userSortColumns[strings.TrimPrefix(filter.Sort, "-")]; !ok {
+		return nil, errors.New("sort must be one of id, name or role (prefixed with - for descending order)")
+	}
+
+	var err error
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxUsersLimit {
+			return nil, fmt.Errorf("limit must be an integer between 1 and %d", maxUsersLimit)
+		}
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		filter.Offset, err = strconv.Atoi(offset)
+		if err != nil || filter.Offset < 0 {
+			return nil, errors.New("offset must be a non-negative integer")
+		}
+	}
+
+	return filter, nil
+}
+
+// getAllUsersOverview returns a page of the users matching the filter.
+func getAllUsersOverview(filter *usersFilter) (*UsersOverview, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := NewUserRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	users, total, err := repo.GetAllOverview(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if users == nil {
+		users = make([]*SafeUser, 0)
+	}
+
+	return &UsersOverview{
+		Users:  users,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}, nil
+}
@@ -4,13 +4,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/plantineers/plantbuddy-server/audit"
 	"github.com/plantineers/plantbuddy-server/auth"
 	"github.com/plantineers/plantbuddy-server/config"
 	"github.com/plantineers/plantbuddy-server/controller"
+	"github.com/plantineers/plantbuddy-server/db"
 	"github.com/plantineers/plantbuddy-server/plant"
 	"github.com/plantineers/plantbuddy-server/sensor"
 )
@@ -22,31 +29,171 @@ func main() {
 		panic(err)
 	}
 
+	// Bring the database schema up to date and panic if it fails
+	err = db.Migrate()
+	if err != nil {
+		panic(err)
+	}
+
 	// Initialize the validator for the plant package
 	plant.InitializeValidator()
 
-	http.Handle("/v1/sensor-data", auth.UserAuthMiddleware(sensor.SensorDataHandler, auth.Gardener))
+	// Commit sensor data of concurrent requests in group transactions and panic if the configuration is invalid
+	if config.PlantBuddyConfig.SensorData.WriteBuffer.Enabled {
+		err = sensor.StartWriteBuffer()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Receive sensor data via MQTT and panic if the configuration is invalid
+	stopMqtt := func() {}
+	if config.PlantBuddyConfig.Mqtt.Enabled {
+		stopMqtt, err = sensor.StartMqttSubscriber()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Receive sensor data from low-power controllers via UDP and panic if the port is not available
+	stopUdp := func() {}
+	if config.PlantBuddyConfig.Udp.Enabled {
+		stopUdp, err = sensor.StartUdpListener()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	http.Handle("/v1/sensor-data", auth.ControllerAuthMiddleware(sensor.SensorDataHandler, auth.RoutePermissions{
+		http.MethodGet:  auth.SensorDataRead,
+		http.MethodPost: auth.SensorDataWrite,
+	}))
+
+	http.Handle("/v1/sensor-data/quarantine", auth.UserAuthMiddleware(sensor.SensorDataQuarantineHandler, auth.RoutePermissions{
+		http.MethodGet: auth.SensorDataAdmin,
+	}))
+	http.Handle("/v1/sensor-data/quarantine/", auth.UserAuthMiddleware(sensor.SensorDataQuarantineHandler, auth.RoutePermissions{
+		http.MethodPost:   auth.SensorDataAdmin,
+		http.MethodDelete: auth.SensorDataAdmin,
+	}))
 
-	http.Handle("/v1/sensor-types", auth.UserAuthMiddleware(sensor.SensorTypesHandler, auth.Gardener))
+	http.Handle("/v1/write", auth.ControllerAuthMiddleware(sensor.SensorDataWriteHandler, auth.RoutePermissions{
+		http.MethodPost: auth.SensorDataWrite,
+	}))
 
-	http.Handle("/v1/controllers", auth.UserAuthMiddleware(controller.ControllersHandler, auth.Gardener))
-	http.Handle("/v1/controller/", auth.UserAuthMiddleware(controller.ControllerHandler, auth.Gardener))
+	http.Handle("/v1/sensor-types", auth.UserAuthMiddleware(sensor.SensorTypesHandler, auth.RoutePermissions{
+		http.MethodGet: auth.SensorDataRead,
+	}))
 
-	http.Handle("/v1/plants", auth.UserAuthMiddleware(plant.PlantsHandler, auth.Gardener))
-	http.Handle("/v1/plants/overview", auth.UserAuthMiddleware(plant.PlantOverviewHandler, auth.Gardener))
-	http.Handle("/v1/plant", auth.UserAuthMiddleware(plant.PlantCreateHandler, auth.Gardener))
-	http.Handle("/v1/plant/", auth.UserAuthMiddleware(plant.PlantHandler, auth.Gardener))
+	http.Handle("/v1/controllers", auth.UserAuthMiddleware(controller.ControllersHandler, auth.RoutePermissions{
+		http.MethodGet: auth.ControllersRead,
+	}))
+	http.Handle("/v1/controller/", auth.UserAuthMiddleware(controller.ControllerHandler, auth.RoutePermissions{
+		http.MethodGet:    auth.ControllersRead,
+		http.MethodPost:   auth.ControllersAdmin,
+		http.MethodPatch:  auth.ControllersAdmin,
+		http.MethodDelete: auth.ControllersAdmin,
+	}))
 
-	http.Handle("/v1/plant-groups", auth.UserAuthMiddleware(plant.PlantGroupsHandler, auth.Gardener))
-	http.Handle("/v1/plant-groups/overview", auth.UserAuthMiddleware(plant.PlantGroupOverviewHandler, auth.Gardener))
-	http.Handle("/v1/plant-group", auth.UserAuthMiddleware(plant.PlantGroupCreateHandler, auth.Gardener))
-	http.Handle("/v1/plant-group/", auth.UserAuthMiddleware(plant.PlantGroupHandler, auth.Gardener))
+	http.Handle("/v1/plants", auth.UserAuthMiddleware(plant.PlantsHandler, auth.RoutePermissions{
+		http.MethodGet: auth.PlantsRead,
+	}))
+	http.Handle("/v1/plants/overview", auth.UserAuthMiddleware(plant.PlantOverviewHandler, auth.RoutePermissions{
+		http.MethodGet: auth.PlantsRead,
+	}))
+	http.Handle("/v1/plant", auth.UserAuthMiddleware(plant.PlantCreateHandler, auth.RoutePermissions{
+		http.MethodPost: auth.PlantsWrite,
+	}))
+	http.Handle("/v1/plant/", auth.UserAuthMiddleware(plant.PlantHandler, auth.RoutePermissions{
+		http.MethodGet:    auth.PlantsRead,
+		http.MethodPut:    auth.PlantsWrite,
+		http.MethodDelete: auth.PlantsWrite,
+	}))
+
+	http.Handle("/v1/plant-groups", auth.UserAuthMiddleware(plant.PlantGroupsHandler, auth.RoutePermissions{
+		http.MethodGet: auth.PlantsRead,
+	}))
+	http.Handle("/v1/plant-groups/overview", auth.UserAuthMiddleware(plant.PlantGroupOverviewHandler, auth.RoutePermissions{
+		http.MethodGet: auth.PlantsRead,
+	}))
+	http.Handle("/v1/plant-group", auth.UserAuthMiddleware(plant.PlantGroupCreateHandler, auth.RoutePermissions{
+		http.MethodPost: auth.PlantsWrite,
+	}))
+	http.Handle("/v1/plant-group/", auth.UserAuthMiddleware(plant.PlantGroupHandler, auth.RoutePermissions{
+		http.MethodGet:    auth.PlantsRead,
+		http.MethodPut:    auth.PlantsWrite,
+		http.MethodDelete: auth.PlantsWrite,
+	}))
+
+	http.Handle("/v1/users", auth.UserAuthMiddleware(auth.UsersHandler, auth.RoutePermissions{
+		http.MethodGet: auth.UsersAdmin,
+	}))
+	http.Handle("/v1/users/overview", auth.UserAuthMiddleware(auth.UsersOverviewHandler, auth.RoutePermissions{
+		http.MethodGet: auth.UsersAdmin,
+	}))
+	http.Handle("/v1/user", auth.UserAuthMiddleware(auth.UserCreateHandler, auth.RoutePermissions{
+		http.MethodPost: auth.UsersAdmin,
+	}))
+	http.Handle("/v1/user/", auth.UserAuthMiddleware(auth.UserHandler, auth.RoutePermissions{
+		http.MethodGet:    auth.UsersAdmin,
+		http.MethodPost:   auth.UsersAdmin,
+		http.MethodPut:    auth.UsersAdmin,
+		http.MethodPatch:  auth.UsersAdmin,
+		http.MethodDelete: auth.UsersAdmin,
+	}))
+	http.Handle("/v1/me", auth.UserAuthMiddleware(auth.MeHandler, auth.RoutePermissions{
+		http.MethodGet: auth.OwnAccount,
+	}))
+	http.Handle("/v1/me/", auth.UserAuthMiddleware(auth.MeHandler, auth.RoutePermissions{
+		http.MethodGet:    auth.OwnAccount,
+		http.MethodPost:   auth.OwnAccount,
+		http.MethodPut:    auth.OwnAccount,
+		http.MethodDelete: auth.OwnAccount,
+	}))
+
+	http.Handle("/v1/audit", auth.UserAuthMiddleware(audit.AuditHandler, auth.RoutePermissions{
+		http.MethodGet: auth.AuditRead,
+	}))
 
-	http.Handle("/v1/users", auth.UserAuthMiddleware(auth.UsersHandler, auth.Admin))
-	http.Handle("/v1/user", auth.UserAuthMiddleware(auth.UserCreateHandler, auth.Admin))
-	http.Handle("/v1/user/", auth.UserAuthMiddleware(auth.UserHandler, auth.Admin))
 	http.HandleFunc("/v1/user/login", auth.LoginHandler)
+	http.HandleFunc("/v1/user/logout", auth.LogoutHandler)
+	http.HandleFunc("/v1/user/password-reset", auth.PasswordResetHandler)
+	http.HandleFunc("/v1/user/oidc/login", auth.OidcLoginHandler)
+	http.HandleFunc("/v1/user/oidc/callback", auth.OidcCallbackHandler)
+
+	server := &http.Server{Addr: fmt.Sprintf(":%d", config.PlantBuddyConfig.Port)}
+
+	// Finish pending requests on SIGINT or SIGTERM, so no buffered sensor data is lost
+	idle := make(chan struct{})
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+
+		// No more readings are received via MQTT or UDP, but the ones being handled are still stored
+		log.Print("Shutting down")
+		stopMqtt()
+		stopUdp()
+
+		// Requests waiting for the write buffer are answered right away, later ones store their data themselves
+		sensor.StopWriteBuffer()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := server.Shutdown(ctx)
+		if err != nil {
+			log.Printf("Error shutting down: %s", err.Error())
+		}
+		close(idle)
+	}()
 
 	log.Printf("Server running on port %d", config.PlantBuddyConfig.Port)
-	fmt.Println(http.ListenAndServe(fmt.Sprintf(":%d", config.PlantBuddyConfig.Port), nil))
+	err = server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		fmt.Println(err)
+		return
+	}
+
+	<-idle
 }
@@ -6,12 +6,103 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"time"
 )
 
 // Holds the configuration
 type Config struct {
-	Database Database
-	Port     int `json:"port"`
+	Database   Database
+	Port       int        `json:"port"`
+	Auth       Auth       `json:"auth"`
+	SensorData SensorData `json:"sensorData"`
+	Mqtt       Mqtt       `json:"mqtt"`
+	Udp        Udp        `json:"udp"`
+}
+
+// Holds the configuration of posting sensor data
+type SensorData struct {
+	// BulkMode is the default mode of storing a batch of sensor data: "atomic" stores all data sets or none,
+	// "best-effort" stores all data sets that are valid. Clients can override it per request.
+	BulkMode string `json:"bulkMode"`
+
+	// MaxClockSkew is how far timestamps sent by controllers may be in the future, as their clocks may be ahead.
+	MaxClockSkew Duration `json:"maxClockSkew"`
+
+	// MaxAge is how far timestamps sent by controllers may be in the past, e.g. after buffering values during an outage.
+	MaxAge Duration `json:"maxAge"`
+
+	// InvalidReadings is what happens to readings of unknown or inactive controllers, unknown sensor types or values
+	// out of the bounds of their sensor type: "reject" fails them, "quarantine" stores them for review by admins.
+	InvalidReadings string `json:"invalidReadings"`
+
+	// OnConflict is what happens to a data set if there already is one of the same controller, sensor and timestamp:
+	// "ignore" keeps the stored one, "overwrite" replaces its value.
+	OnConflict string `json:"onConflict"`
+
+	// IdempotencyKeyLifetime is how long the response to a request with an `Idempotency-Key` is replayed to retries.
+	IdempotencyKeyLifetime Duration `json:"idempotencyKeyLifetime"`
+
+	// MaxBodySize is how many bytes a request posting sensor data may have. Line protocol is limited both as sent
+	// and once decompressed. Larger requests are answered with 413 Request Entity Too Large.
+	MaxBodySize int64 `json:"maxBodySize"`
+
+	// WriteBuffer queues the sensor data of concurrent requests and stores it in group transactions.
+	WriteBuffer WriteBuffer `json:"writeBuffer"`
+}
+
+// Holds the configuration of the write buffer, which commits the sensor data of all requests together
+// instead of opening a transaction per request, as SQLite only allows a single writer at a time.
+type WriteBuffer struct {
+	// Enabled turns the write buffer on.
+	Enabled bool `json:"enabled"`
+
+	// MaxReadings is how many readings may be queued or being committed at once. Requests exceeding it are answered
+	// with 503 Service Unavailable, so the memory used by the buffer is bounded.
+	MaxReadings int `json:"maxReadings"`
+
+	// BatchSize is how many queued readings are committed right away, without waiting for FlushInterval.
+	BatchSize int `json:"batchSize"`
+
+	// FlushInterval is how long readings are queued at most before they are committed.
+	FlushInterval Duration `json:"flushInterval"`
+}
+
+// Holds the configuration of receiving sensor data via MQTT.
+// Access to the topics has to be restricted by the broker, as the controller is taken from the topic.
+type Mqtt struct {
+	// Enabled turns the MQTT subscriber on.
+	Enabled bool `json:"enabled"`
+
+	// Broker is the URL of the MQTT broker, like "tcp://localhost:1883".
+	Broker string `json:"broker"`
+
+	// ClientId identifies the server at the broker, which keeps its session (and pending readings) while it is down.
+	ClientId string `json:"clientId"`
+
+	// Username and Password authenticate the server at the broker (optional).
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// Topic is the scheme of topics readings are published on. The levels {controller} and {sensor} are placeholders
+	// for the UUID of the controller and the type of the sensor.
+	Topic string `json:"topic"`
+
+	// Qos is the quality of service to subscribe with (0, 1 or 2).
+	Qos byte `json:"qos"`
+}
+
+// Holds the configuration of receiving sensor data via UDP from low-power controllers.
+type Udp struct {
+	// Enabled turns the UDP listener on.
+	Enabled bool `json:"enabled"`
+
+	// Port is the UDP port to listen on.
+	Port int `json:"port"`
+
+	// Secret derives the keys controllers authenticate their packets with, so the database alone is not enough to
+	// forge packets. It should not be stored in buddy.json, but set via the environment variable PLANTBUDDY_UDP_SECRET,
+	// which takes precedence. Changing it invalidates the packet keys of all controllers.
+	Secret string `json:"secret"`
 }
 
 // Holds the database configuration
@@ -20,18 +111,194 @@ type Database struct {
 	DriverName string `json:"driverName"`
 }
 
+// Holds the authentication configuration
+type Auth struct {
+	// SessionLifetime is the time a session token issued by the login endpoint is valid.
+	SessionLifetime Duration `json:"sessionLifetime"`
+
+	// BruteForce configures how failed login attempts are throttled.
+	BruteForce BruteForce `json:"bruteForce"`
+
+	// PasswordMinLength is the minimum number of characters of new passwords.
+	PasswordMinLength int `json:"passwordMinLength"`
+
+	// PasswordResetLifetime is the time a password reset token issued by an admin is valid.
+	PasswordResetLifetime Duration `json:"passwordResetLifetime"`
+
+	// AccessTokenMaxLifetime is the longest time a personal access token may be valid.
+	AccessTokenMaxLifetime Duration `json:"accessTokenMaxLifetime"`
+
+	// RequireAdminTotp forces admins to enable two-factor authentication.
+	// Until they do, they may only manage their own account.
+	RequireAdminTotp bool `json:"requireAdminTotp"`
+
+	// Oidc configures the login via an OpenID Connect identity provider.
+	Oidc Oidc `json:"oidc"`
+}
+
+// Holds the configuration of the OpenID Connect login.
+type Oidc struct {
+	// Enabled turns the OpenID Connect login on. Local accounts keep working either way.
+	Enabled bool `json:"enabled"`
+
+	// Issuer is the URL of the identity provider, used to discover its endpoints.
+	Issuer string `json:"issuer"`
+
+	// ClientId and ClientSecret identify PlantBuddy at the identity provider. The secret should not be stored in
+	// buddy.json, but set via the environment variable PLANTBUDDY_OIDC_CLIENT_SECRET, which takes precedence.
+	ClientId     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+
+	// RedirectUrl is the URL of the callback endpoint as registered at the identity provider.
+	RedirectUrl string `json:"redirectUrl"`
+
+	// Scopes are requested in addition to "openid".
+	Scopes []string `json:"scopes"`
+
+	// UsernameClaim is the claim used as name of provisioned users. The subject is used if it is missing.
+	UsernameClaim string `json:"usernameClaim"`
+
+	// GroupsClaim is the claim holding the groups of the user.
+	GroupsClaim string `json:"groupsClaim"`
+
+	// AutoProvision creates a user on the first login. Otherwise, unknown identities are rejected.
+	AutoProvision bool `json:"autoProvision"`
+
+	// DefaultRole is the role of provisioned users none of whose groups are mapped.
+	DefaultRole int8 `json:"defaultRole"`
+
+	// GroupRoles maps groups to roles. If a user is in several mapped groups, the most privileged role wins.
+	// If set, the role of a user is synchronized on every login.
+	GroupRoles map[string]int8 `json:"groupRoles"`
+}
+
+// Holds the configuration of the brute-force protection.
+// Failed attempts are counted per user name and per client IP.
+type BruteForce struct {
+	// FreeAttempts is the number of failed attempts per user name before further attempts are delayed.
+	FreeAttempts int `json:"freeAttempts"`
+
+	// FreeAttemptsPerIp is the number of failed attempts per client IP before further attempts are delayed.
+	// It should be higher than FreeAttempts, as several users may share an IP.
+	FreeAttemptsPerIp int `json:"freeAttemptsPerIp"`
+
+	// BaseDelay is the delay after the first delayed attempt. It doubles with each further failed attempt.
+	BaseDelay Duration `json:"baseDelay"`
+
+	// MaxDelay caps the exponential delay.
+	MaxDelay Duration `json:"maxDelay"`
+
+	// LockoutAttempts is the number of failed attempts after which an account is locked (0 = never).
+	LockoutAttempts int `json:"lockoutAttempts"`
+
+	// LockoutDuration is the time an account stays locked unless an admin unlocks it.
+	LockoutDuration Duration `json:"lockoutDuration"`
+
+	// ResetAfter is the time without failed attempts after which the counter is reset.
+	ResetAfter Duration `json:"resetAfter"`
+}
+
+// Duration is a time.Duration that is read from a string like "24h" or "15m".
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses a duration string as accepted by time.ParseDuration.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+// MarshalJSON writes the duration as a string like "24h0m0s".
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
 // Holds the global configuration
 var PlantBuddyConfig Config
 
+// envOidcClientSecret is the environment variable holding the client secret of the OpenID Connect provider.
+const envOidcClientSecret = "PLANTBUDDY_OIDC_CLIENT_SECRET"
+
+// envUdpSecret is the environment variable holding the secret the packet keys of controllers are derived from.
+const envUdpSecret = "PLANTBUDDY_UDP_SECRET"
+
+// defaultConfig holds the values used for all properties missing in buddy.json.
+var defaultConfig = Config{
+	Port: 3333,
+	Auth: Auth{
+		SessionLifetime: Duration{24 * time.Hour},
+		BruteForce: BruteForce{
+			FreeAttempts:      3,
+			FreeAttemptsPerIp: 20,
+			BaseDelay:         Duration{time.Second},
+			MaxDelay:          Duration{5 * time.Minute},
+			LockoutAttempts:   10,
+			LockoutDuration:   Duration{30 * time.Minute},
+			ResetAfter:        Duration{time.Hour},
+		},
+		PasswordMinLength:      8,
+		PasswordResetLifetime:  Duration{24 * time.Hour},
+		AccessTokenMaxLifetime: Duration{365 * 24 * time.Hour},
+		Oidc: Oidc{
+			Scopes:        []string{"profile", "email"},
+			UsernameClaim: "preferred_username",
+			GroupsClaim:   "groups",
+			AutoProvision: true,
+			DefaultRole:   2, // Viewer
+		},
+	},
+	Mqtt: Mqtt{
+		Broker:   "tcp://localhost:1883",
+		ClientId: "plantbuddy-server",
+		Topic:    "plantbuddy/{controller}/{sensor}",
+		Qos:      1,
+	},
+	Udp: Udp{
+		Port: 3334,
+	},
+	SensorData: SensorData{
+		BulkMode:               "atomic",
+		MaxClockSkew:           Duration{5 * time.Minute},
+		MaxAge:                 Duration{7 * 24 * time.Hour},
+		InvalidReadings:        "reject",
+		OnConflict:             "ignore",
+		IdempotencyKeyLifetime: Duration{24 * time.Hour},
+		MaxBodySize:            10 << 20,
+		WriteBuffer: WriteBuffer{
+			MaxReadings:   10000,
+			BatchSize:     500,
+			FlushInterval: Duration{100 * time.Millisecond},
+		},
+	},
+}
+
 // Reads the buddy.json file
 func InitConfig() error {
 	file, fileErr := os.ReadFile("buddy.json")
 	if fileErr != nil {
 		return fileErr
 	}
+
+	PlantBuddyConfig = defaultConfig
 	jsonErr := json.Unmarshal(file, &PlantBuddyConfig)
 	if jsonErr != nil {
 		return jsonErr
 	}
+
+	// Secrets are kept out of buddy.json, which is checked in
+	if secret, ok := os.LookupEnv(envOidcClientSecret); ok {
+		PlantBuddyConfig.Auth.Oidc.ClientSecret = secret
+	}
+
+	if secret, ok := os.LookupEnv(envUdpSecret); ok {
+		PlantBuddyConfig.Udp.Secret = secret
+	}
 	return nil
 }
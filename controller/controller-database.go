@@ -10,4 +10,12 @@ type ControllerRepository interface {
 	// GetByUUID returns the controller with the given UUID.
 	// Caution: This method does not use a transaction.
 	GetByUUID(uuid string) (*Controller, error)
+
+	// IsActive returns whether the controller with the given UUID is active.
+	// It returns sql.ErrNoRows if the controller does not exist.
+	IsActive(uuid string) (bool, error)
+
+	// SetActive activates or deactivates the controller with the given UUID.
+	// It returns sql.ErrNoRows if the controller does not exist.
+	SetActive(uuid string, active bool) error
 }
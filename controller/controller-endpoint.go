@@ -8,12 +8,20 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/plantineers/plantbuddy-server/auth"
 	"github.com/plantineers/plantbuddy-server/db"
 	"github.com/plantineers/plantbuddy-server/utils"
 )
 
 // ControllerHandler handles all requests to the controller endpoint.
+// Requests to `/v1/controller/{uuid}/key` are passed to the controller key handler.
 func ControllerHandler(w http.ResponseWriter, r *http.Request) {
+	segments := utils.PathSegments(r.URL.Path, "/v1/controller/")
+	if len(segments) == 2 && segments[1] == "key" {
+		controllerKeyHandler(w, r, segments[0])
+		return
+	}
+
 	uuid, err := utils.PathParameterFilterStr(r.URL.Path, "/v1/controller/")
 	if err != nil {
 		msg := fmt.Sprintf("Error getting path variable (controller UUID): %s", err.Error())
@@ -24,6 +32,10 @@ func ControllerHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		handleControllerGet(w, r, uuid)
+	case http.MethodPatch:
+		handleControllerPatch(w, r, uuid)
+	default:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET, PATCH")
 	}
 }
 
@@ -50,6 +62,75 @@ func handleControllerGet(w http.ResponseWriter, r *http.Request, uuid string) {
 	}
 }
 
+// handleControllerPatch handles PATCH requests to the controller endpoint.
+// Deactivating a controller keeps its key, but its sensor data is rejected or quarantined.
+func handleControllerPatch(w http.ResponseWriter, r *http.Request, uuid string) {
+	var patch ControllerPatch
+	err := json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		msg := fmt.Sprintf("Error decoding patch of controller %s: %s", uuid, err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	if patch.Active == nil {
+		utils.HttpBadRequestResponse(w, "Nothing to change (allowed: active)")
+		return
+	}
+
+	previous, after, err := patchController(uuid, &patch)
+	switch err {
+	case nil:
+		auth.RecordAudit(r, auditEntityController, uuid, previous, after)
+
+		b, err := json.Marshal(after)
+		if err != nil {
+			msg := fmt.Sprintf("Error converting controller to JSON: %s", err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		log.Printf("Controller with UUID %s changed (active: %t)", uuid, after.Active)
+		utils.HttpOkResponse(w, b)
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("Controller with UUID %s not found", uuid)
+		utils.HttpNotFoundResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error changing controller with UUID %s: %s", uuid, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// patchController applies the patch to the controller with the given UUID and returns it before and after.
+func patchController(uuid string, patch *ControllerPatch) (*Controller, *Controller, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	repository, err := NewControllerRepository(session)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	previous, err := repository.GetByUUID(uuid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = repository.SetActive(uuid, *patch.Active)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	after := *previous
+	after.Active = *patch.Active
+	return previous, &after, nil
+}
+
 // getControllerData returns the controller with the given UUID.
 func getControllerData(uuid string) (*Controller, error) {
 	var session = db.NewSession()
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/auth"
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// Entity types of the audit log
+const (
+	auditEntityController    = "controller"
+	auditEntityControllerKey = "controller-key"
+)
+
+// controllerKeyHandler handles all requests to the controller key endpoint.
+// Managing API keys requires the controllers:admin permission.
+func controllerKeyHandler(w http.ResponseWriter, r *http.Request, uuid string) {
+	if !auth.HasPermission(r.Context(), auth.ControllersAdmin) {
+		msg := fmt.Sprintf("Insufficient permissions (%s required)", auth.ControllersAdmin)
+		utils.HttpForbiddenResponse(w, msg)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		handleControllerKeyGet(w, r, uuid)
+	case http.MethodPost:
+		handleControllerKeyPost(w, r, uuid)
+	case http.MethodDelete:
+		handleControllerKeyDelete(w, r, uuid)
+	default:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET, POST, DELETE")
+	}
+}
+
+// handleControllerKeyGet handles GET requests to the controller key endpoint.
+// It only returns the metadata of the key, never the key itself.
+func handleControllerKeyGet(w http.ResponseWriter, r *http.Request, uuid string) {
+	key, err := getControllerKey(uuid)
+	switch err {
+	case nil:
+		b, err := json.Marshal(key)
+		if err != nil {
+			msg := fmt.Sprintf("Error converting key of controller %s to JSON: %s", uuid, err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		utils.HttpOkResponse(w, b)
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("Controller with UUID %s has no key", uuid)
+		utils.HttpNotFoundResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error getting key of controller %s: %s", uuid, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleControllerKeyPost handles POST requests to the controller key endpoint.
+// It issues a new key and thereby revokes the existing one (if any).
+func handleControllerKeyPost(w http.ResponseWriter, r *http.Request, uuid string) {
+	previous, ok := loadControllerKey(w, uuid)
+	if !ok {
+		return
+	}
+
+	key, err := issueControllerKey(uuid)
+	switch err {
+	case nil:
+		// Never record the key itself
+		auth.RecordAudit(r, auditEntityControllerKey, uuid, previous, &key.ControllerKey)
+
+		b, err := json.Marshal(key)
+		if err != nil {
+			msg := fmt.Sprintf("Error converting key of controller %s to JSON: %s", uuid, err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		msg := fmt.Sprintf("Issued new key for controller %s", uuid)
+		location := fmt.Sprintf("/v1/controller/%s/key", uuid)
+		utils.HttpCreatedResponse(w, b, location, msg)
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("Controller with UUID %s not found", uuid)
+		utils.HttpNotFoundResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error issuing key for controller %s: %s", uuid, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleControllerKeyDelete handles DELETE requests to the controller key endpoint.
+func handleControllerKeyDelete(w http.ResponseWriter, r *http.Request, uuid string) {
+	previous, ok := loadControllerKey(w, uuid)
+	if !ok {
+		return
+	}
+
+	err := revokeControllerKey(uuid)
+	if err != nil {
+		msg := fmt.Sprintf("Error revoking key of controller %s: %s", uuid, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	if previous != nil {
+		auth.RecordAudit(r, auditEntityControllerKey, uuid, previous, nil)
+	}
+
+	log.Printf("Revoked key of controller %s", uuid)
+	utils.HttpOkResponse(w, nil)
+}
+
+// loadControllerKey returns the key metadata of the given controller (nil if it has no key) and true.
+// If loading fails, it writes an error response and returns false.
+func loadControllerKey(w http.ResponseWriter, uuid string) (*auth.ControllerKey, bool) {
+	key, err := getControllerKey(uuid)
+	switch err {
+	case nil:
+		return key, true
+	case sql.ErrNoRows:
+		return nil, true
+	default:
+		msg := fmt.Sprintf("Error getting key of controller %s: %s", uuid, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return nil, false
+	}
+}
+
+// getControllerKey returns the key metadata of the given controller.
+func getControllerKey(uuid string) (*auth.ControllerKey, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := auth.NewControllerKeyRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.GetByController(uuid)
+}
+
+// issueControllerKey generates a new key for the given controller and stores its hash.
+// It returns sql.ErrNoRows if the controller does not exist.
+func issueControllerKey(uuid string) (*auth.IssuedControllerKey, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	controllerRepository, err := NewControllerRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = controllerRepository.GetByUUID(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	keyRepository, err := auth.NewControllerKeyRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := utils.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	controllerKey := auth.ControllerKey{
+		Controller: uuid,
+		Created:    time.Now().UTC().Truncate(time.Second),
+	}
+
+	keyHash := utils.HashToken(key)
+	err = keyRepository.Save(&controllerKey, keyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := &auth.IssuedControllerKey{
+		ControllerKey: controllerKey,
+		Key:           key,
+	}
+
+	// Controllers can only send UDP packets if there is a secret to derive their message key from
+	messageKey, err := auth.ControllerMessageKey(keyHash)
+	if err == nil {
+		issued.MessageKey = hex.EncodeToString(messageKey)
+	} else if err != auth.ErrNoMessageSecret {
+		return nil, err
+	}
+
+	return issued, nil
+}
+
+// revokeControllerKey deletes the key of the given controller.
+func revokeControllerKey(uuid string) error {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	repository, err := auth.NewControllerKeyRepository(session)
+	if err != nil {
+		return err
+	}
+
+	return repository.DeleteByController(uuid)
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"testing"
+
+	"github.com/plantineers/plantbuddy-server/auth"
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// testController is a controller of the test database.
+const testController = "11111111-1111-1111-1111-111111111111"
+
+// getTestControllerByKey returns the controller the given API key has been issued to.
+func getTestControllerByKey(t *testing.T, key string) (string, error) {
+	t.Helper()
+
+	session := db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repository, err := auth.NewControllerKeyRepository(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	controllerKey, err := repository.GetByKey(utils.HashToken(key))
+	if err != nil {
+		return "", err
+	}
+
+	return controllerKey.Controller, nil
+}
+
+func TestIssueAndRevokeControllerKey(t *testing.T) {
+	dbtest.Setup(t)
+	dbtest.Exec(t, `INSERT INTO CONTROLLER (UUID, PLANT_GROUP) VALUES (?, 1);`, testController)
+	config.PlantBuddyConfig.Udp.Secret = ""
+
+	_, err := issueControllerKey("22222222-2222-2222-2222-222222222222")
+	if err != sql.ErrNoRows {
+		t.Errorf("unknown controller: got error %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// Without a secret, controllers cannot authenticate UDP packets
+	first, err := issueControllerKey(testController)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Key == "" || first.MessageKey != "" {
+		t.Errorf("got key %q and message key %q, want a key without message key", first.Key, first.MessageKey)
+	}
+
+	config.PlantBuddyConfig.Udp.Secret = "secret"
+	second, err := issueControllerKey(testController)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messageKey, err := auth.ControllerMessageKey(utils.HashToken(second.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Key == first.Key || second.MessageKey != hex.EncodeToString(messageKey) {
+		t.Errorf("got key %q and message key %q, want a new key with its message key", second.Key, second.MessageKey)
+	}
+
+	// Issuing a key revokes the previous one
+	tests := []struct {
+		name string
+		key  string
+		err  error
+	}{
+		{"first key", first.Key, sql.ErrNoRows},
+		{"second key", second.Key, nil},
+	}
+
+	for _, test := range tests {
+		uuid, err := getTestControllerByKey(t, test.key)
+		if err != test.err || (err == nil && uuid != testController) {
+			t.Errorf("%s: got controller %q and error %v, want error %v", test.name, uuid, err, test.err)
+		}
+	}
+
+	key, err := getControllerKey(testController)
+	if err != nil || !key.Created.Equal(second.Created) {
+		t.Errorf("got key %+v (%v), want it to be created at %s", key, err, second.Created)
+	}
+
+	err = revokeControllerKey(testController)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = getTestControllerByKey(t, second.Key); err != sql.ErrNoRows {
+		t.Errorf("revoked key: got error %v, want %v", err, sql.ErrNoRows)
+	}
+
+	if _, err = getControllerKey(testController); err != sql.ErrNoRows {
+		t.Errorf("revoked key metadata: got error %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// Revoking is idempotent
+	if err = revokeControllerKey(testController); err != nil {
+		t.Errorf("revoking again: got error %v, want none", err)
+	}
+}
@@ -4,9 +4,15 @@ package controller
 type Controller struct {
 	UUID       string   `json:"uuid"`
 	PlantGroup int64    `json:"plantGroup"`
+	Active     bool     `json:"active"` // Sensor data of inactive controllers is rejected or quarantined
 	Sensors    []string `json:"sensors"`
 }
 
+// ControllerPatch represents a partial change of a controller. Fields that are nil are not changed.
+type ControllerPatch struct {
+	Active *bool `json:"active"`
+}
+
 // controllerUUIDs represents a list of controller UUIDs.
 type controllerUUIDs struct {
 	UUIDs []string `json:"controllers"`
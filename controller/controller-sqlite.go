@@ -50,9 +50,9 @@ func (r *ControllerSqliteRepository) GetByUUID(uuid string) (*Controller, error)
 	var controller Controller
 
 	err := r.db.QueryRow(`
-    SELECT C.UUID, C.PLANT_GROUP
+    SELECT C.UUID, C.PLANT_GROUP, C.ACTIVE
         FROM CONTROLLER C
-        WHERE C.UUID = ?;`, uuid).Scan(&controller.UUID, &controller.PlantGroup)
+        WHERE C.UUID = ?;`, uuid).Scan(&controller.UUID, &controller.PlantGroup, &controller.Active)
 
 	if err != nil {
 		return nil, err
@@ -82,3 +82,37 @@ func (r *ControllerSqliteRepository) GetByUUID(uuid string) (*Controller, error)
 	controller.Sensors = sensors
 	return &controller, nil
 }
+
+// IsActive returns whether the controller with the given UUID is active.
+// It returns sql.ErrNoRows if the controller does not exist.
+func (r *ControllerSqliteRepository) IsActive(uuid string) (bool, error) {
+	var active bool
+	err := r.db.QueryRow(`
+    SELECT C.ACTIVE
+        FROM CONTROLLER C
+        WHERE C.UUID = ?;`, uuid).Scan(&active)
+	return active, err
+}
+
+// SetActive activates or deactivates the controller with the given UUID.
+// It returns sql.ErrNoRows if the controller does not exist.
+func (r *ControllerSqliteRepository) SetActive(uuid string, active bool) error {
+	result, err := r.db.Exec(`
+    UPDATE CONTROLLER
+        SET ACTIVE = ?
+        WHERE UUID = ?;`, active, uuid)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -4,16 +4,27 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"strings"
 
 	// We know we'll never change the database, so it can be hard-coded here ...
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/plantineers/plantbuddy-server/config"
 )
 
+// Querier is implemented by both sql.DB and sql.Tx, so repositories can run their statements inside a transaction
+// started by Session.Begin.
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 // Session holds the database connection.
 type Session struct {
 	DB         *sql.DB
+	Tx         *sql.Tx // Transaction started by Begin, nil if there is none
 	Driver     string
 	DataSource string
 }
@@ -38,8 +49,19 @@ func (s *Session) IsOpen() bool {
 }
 
 // Open opens a connection to the database.
+// Transactions take the write lock right away, so concurrent transactions wait for each other instead of deciding on
+// data that is about to change (unless the data source sets `_txlock` itself).
 func (s *Session) Open() error {
-	db, err := sql.Open(s.Driver, s.DataSource)
+	dataSource := s.DataSource
+	if !strings.Contains(dataSource, "_txlock=") {
+		separator := "?"
+		if strings.Contains(dataSource, "?") {
+			separator = "&"
+		}
+		dataSource += separator + "_txlock=immediate"
+	}
+
+	db, err := sql.Open(s.Driver, dataSource)
 
 	if err != nil {
 		return err
@@ -50,9 +72,66 @@ func (s *Session) Open() error {
 }
 
 // Close closes the connection to the database in case it is open.
+// A transaction that has not been committed is rolled back.
 func (s *Session) Close() error {
+	if s.Tx != nil {
+		s.Tx.Rollback()
+		s.Tx = nil
+	}
+
 	if s.DB != nil {
 		return s.DB.Close()
 	}
 	return nil
 }
+
+// Querier returns the transaction started by Begin or, if there is none, the connection.
+// Repositories created after Begin run their statements inside the transaction.
+func (s *Session) Querier() Querier {
+	if s.Tx != nil {
+		return s.Tx
+	}
+
+	return s.DB
+}
+
+// Begin starts a transaction, which all repositories created from this session afterwards run in until Commit
+// is called. Closing the session without committing rolls the transaction back.
+func (s *Session) Begin() error {
+	tx, err := s.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+
+	s.Tx = tx
+	return nil
+}
+
+// Commit commits the transaction started by Begin.
+func (s *Session) Commit() error {
+	err := s.Tx.Commit()
+	s.Tx = nil
+	return err
+}
+
+// Transaction runs f in a new transaction, which is committed if f succeeds and rolled back otherwise.
+// If q already is a transaction (see Session.Begin), f runs in it and committing is left to its owner.
+func Transaction(q Querier, f func(tx Querier) error) error {
+	db, ok := q.(*sql.DB)
+	if !ok {
+		return f(q)
+	}
+
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+
+	err = f(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
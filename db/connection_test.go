@@ -0,0 +1,124 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+// countTestUsers returns the number of users with the given name.
+func countTestUsers(t *testing.T, q Querier, name string) int {
+	t.Helper()
+
+	var count int
+	err := q.QueryRow(`SELECT COUNT(*) FROM USERS WHERE NAME = ?;`, name).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestSessionTransaction(t *testing.T) {
+	db := setupTestBaseline(t)
+
+	tests := []struct {
+		name   string
+		commit bool
+		count  int
+	}{
+		{"rolled back", false, 0},
+		{"committed", true, 1},
+	}
+
+	for _, test := range tests {
+		session := NewSession()
+		err := session.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = session.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if session.Querier() != session.Tx {
+			t.Errorf("%s: statements do not run in the transaction", test.name)
+		}
+
+		_, err = session.Querier().Exec(`INSERT INTO USERS (NAME, PASSWORD, ROLE) VALUES (?, '', 1);`, test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.commit {
+			err = session.Commit()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Closing rolls back what has not been committed
+		session.Close()
+
+		if count := countTestUsers(t, db, test.name); count != test.count {
+			t.Errorf("%s: got %d users, want %d", test.name, count, test.count)
+		}
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	db := setupTestBaseline(t)
+	errFailed := errors.New("failed")
+
+	insert := func(name string, err error) func(tx Querier) error {
+		return func(tx Querier) error {
+			_, execErr := tx.Exec(`INSERT INTO USERS (NAME, PASSWORD, ROLE) VALUES (?, '', 1);`, name)
+			if execErr != nil {
+				return execErr
+			}
+
+			return err
+		}
+	}
+
+	tests := []struct {
+		name  string
+		err   error
+		count int
+	}{
+		{"succeeded", nil, 1},
+		{"failed", errFailed, 0},
+	}
+
+	for _, test := range tests {
+		err := Transaction(db, insert(test.name, test.err))
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+
+		if count := countTestUsers(t, db, test.name); count != test.count {
+			t.Errorf("%s: got %d users, want %d", test.name, count, test.count)
+		}
+	}
+
+	// Within a transaction, it is left to its owner to commit
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Transaction(tx, insert("joined", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := countTestUsers(t, tx, "joined"); count != 1 {
+		t.Errorf("got %d users in the transaction, want 1", count)
+	}
+
+	tx.Rollback()
+	if count := countTestUsers(t, db, "joined"); count != 0 {
+		t.Errorf("got %d users after rollback, want 0", count)
+	}
+}
@@ -0,0 +1,76 @@
+// Package dbtest provides a throwaway database for the tests of other packages.
+package dbtest
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// Setup migrates a copy of `buddy-default.sqlite` in a temporary directory and configures it as the database of the
+// test.
+func Setup(t testing.TB) {
+	t.Helper()
+
+	// The baseline lives in the root of the module, independent of the package under test
+	_, file, _, _ := runtime.Caller(0)
+	b, err := os.ReadFile(filepath.Join(filepath.Dir(file), "..", "..", "buddy-default.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "buddy.sqlite")
+	err = os.WriteFile(path, b, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.PlantBuddyConfig.Database = config.Database{DriverName: "sqlite3", DataSource: path}
+	err = db.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Exec executes a statement on the test database.
+func Exec(t testing.TB, statement string, args ...any) {
+	t.Helper()
+
+	session := db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = session.DB.Exec(statement, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// CountRows returns the number of rows of a table of the test database.
+func CountRows(t testing.TB, table string) int {
+	t.Helper()
+
+	session := db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	err = session.DB.QueryRow(`SELECT COUNT(*) FROM ` + table + `;`).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// migration describes a single, ordered change to the database schema.
+// Changes that cannot be expressed in SQL (like converting data) are made by migrate, which runs after the statements.
+type migration struct {
+	description string
+	statements  string
+	migrate     func(tx *sql.Tx) error
+}
+
+// Migrate brings the configured database up to date by applying all pending migrations.
+// The schema version is tracked using SQLite's `user_version` pragma, so every migration
+// is applied exactly once. Each migration runs in its own transaction.
+func Migrate() error {
+	var session = NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = session.DB.QueryRow(`PRAGMA user_version;`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		err = applyMigration(session.DB, i+1, migrations[i])
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %s", i+1, migrations[i].description, err.Error())
+		}
+
+		log.Printf("Applied database migration %d: %s", i+1, migrations[i].description)
+	}
+
+	return nil
+}
+
+// applyMigration applies the given migration and sets the schema version afterwards.
+func applyMigration(db *sql.DB, version int, m *migration) error {
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(m.statements)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if m.migrate != nil {
+		err = m.migrate(tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// PRAGMA statements do not support parameters.
+	_, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d;`, version))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
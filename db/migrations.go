@@ -0,0 +1,352 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// migrations holds all schema changes made on top of `buddy-default.sqlite`.
+// Caution: Never change or reorder existing migrations, only append new ones.
+// Foreign keys are not enforced (SQLite needs them to be enabled per connection), so references only document
+// relations and rows referencing a deleted one have to be deleted by the repositories.
+var migrations = []*migration{
+	{
+		description: "create table SESSION",
+		statements: `
+    CREATE TABLE SESSION
+    (
+        ID      INTEGER not null
+            constraint ID
+                primary key autoincrement,
+        USER    INTEGER not null
+            constraint USER
+                references USERS,
+        TOKEN   TEXT    not null
+            constraint TOKEN
+                unique,
+        CREATED INTEGER not null,
+        EXPIRES INTEGER not null
+    );`,
+	},
+	{
+		description: "create table CONTROLLER_KEY",
+		statements: `
+    CREATE TABLE CONTROLLER_KEY
+    (
+        CONTROLLER      TEXT    not null
+            constraint CONTROLLER
+                primary key
+            constraint CONTROLLER_FK
+                references CONTROLLER,
+        KEY             TEXT    not null
+            constraint KEY
+                unique,
+        CREATED         INTEGER not null,
+        MESSAGE_COUNTER INTEGER
+    );`,
+	},
+	{
+		// Before PLANT_GROUP_ACCESS, gardeners could change and viewers could see all plant groups, so existing users
+		// keep that access. Pairs with access already granted are skipped.
+		description: "create table PLANT_GROUP_ACCESS and grant existing non-admin users access to all plant groups",
+		statements: `
+    CREATE TABLE PLANT_GROUP_ACCESS
+    (
+        USER        INTEGER not null
+            constraint USER
+                references USERS,
+        PLANT_GROUP INTEGER not null
+            constraint PLANT_GROUP
+                references PLANT_GROUP,
+        ACCESS      TEXT    not null,
+        constraint KEY
+            primary key (USER, PLANT_GROUP)
+    );
+    INSERT INTO PLANT_GROUP_ACCESS (USER, PLANT_GROUP, ACCESS)
+        SELECT U.ID, PG.ID, CASE U.ROLE WHEN 1 THEN 'write' ELSE 'read' END
+        FROM USERS U,
+             PLANT_GROUP PG
+        WHERE U.ROLE != 0
+          AND NOT EXISTS (
+            SELECT 1
+            FROM PLANT_GROUP_ACCESS A
+            WHERE A.USER = U.ID
+              AND A.PLANT_GROUP = PG.ID
+          );`,
+	},
+	{
+		description: "create table AUDIT_LOG",
+		statements: `
+    CREATE TABLE AUDIT_LOG
+    (
+        ID          INTEGER not null
+            constraint ID
+                primary key autoincrement,
+        USER        INTEGER,
+        ACTOR       TEXT    not null,
+        TIMESTAMP   INTEGER not null,
+        METHOD      TEXT    not null,
+        ENDPOINT    TEXT    not null,
+        ENTITY_TYPE TEXT    not null,
+        ENTITY_ID   TEXT    not null,
+        BEFORE      TEXT,
+        AFTER       TEXT
+    );
+
+    CREATE INDEX AUDIT_LOG_TIMESTAMP ON AUDIT_LOG (TIMESTAMP);
+    CREATE INDEX AUDIT_LOG_ENTITY ON AUDIT_LOG (ENTITY_TYPE, ENTITY_ID);`,
+	},
+	{
+		description: "create table USER_IDENTITY",
+		statements: `
+    CREATE TABLE USER_IDENTITY
+    (
+        ISSUER  TEXT    not null,
+        SUBJECT TEXT    not null,
+        USER    INTEGER not null
+            constraint USER
+                references USERS,
+        CREATED INTEGER not null,
+        constraint KEY
+            primary key (ISSUER, SUBJECT)
+    );`,
+	},
+	{
+		description: "create tables USER_TOTP and USER_RECOVERY_CODE",
+		statements: `
+    CREATE TABLE USER_TOTP
+    (
+        USER      INTEGER not null
+            constraint USER_TOTP_PK
+                primary key
+            constraint USER
+                references USERS,
+        SECRET    TEXT    not null,
+        ENABLED   INTEGER not null default 0,
+        LAST_STEP INTEGER not null default 0,
+        CREATED   INTEGER not null
+    );
+    CREATE TABLE USER_RECOVERY_CODE
+    (
+        USER INTEGER not null
+            constraint USER
+                references USERS,
+        CODE TEXT    not null,
+        constraint KEY
+            primary key (USER, CODE)
+    );`,
+	},
+	{
+		description: "create table PASSWORD_RESET",
+		statements: `
+    CREATE TABLE PASSWORD_RESET
+    (
+        USER    INTEGER not null
+            constraint PASSWORD_RESET_PK
+                primary key
+            constraint USER
+                references USERS,
+        TOKEN   TEXT    not null
+            constraint TOKEN
+                unique,
+        CREATED INTEGER not null,
+        EXPIRES INTEGER not null
+    );`,
+	},
+	{
+		description: "add columns ENABLED and PROTECTED to table USERS",
+		statements: `
+    ALTER TABLE USERS ADD COLUMN ENABLED INTEGER not null default 1;
+    ALTER TABLE USERS ADD COLUMN PROTECTED INTEGER not null default 0;
+    UPDATE USERS SET PROTECTED = 1 WHERE NAME = 'root';`,
+	},
+	{
+		description: "create table ACCESS_TOKEN",
+		statements: `
+    CREATE TABLE ACCESS_TOKEN
+    (
+        ID        INTEGER not null
+            constraint ID
+                primary key autoincrement,
+        USER      INTEGER not null
+            constraint USER
+                references USERS,
+        NAME      TEXT    not null,
+        TOKEN     TEXT    not null
+            constraint TOKEN
+                unique,
+        SCOPES    TEXT    not null,
+        CREATED   INTEGER not null,
+        EXPIRES   INTEGER not null,
+        LAST_USED INTEGER
+    );`,
+	},
+	{
+		description: "store SENSOR_DATA timestamps as unix milliseconds",
+		statements: `
+    CREATE TABLE SENSOR_DATA_NEW
+    (
+        CONTROLLER TEXT    not null
+            constraint CONTROLLER
+                references CONTROLLER,
+        SENSOR     TEXT    not null
+            constraint SENSOR
+                references SENSOR_TYPE (NAME),
+        VALUE      REAL    not null,
+        TIMESTAMP  INTEGER not null
+    );`,
+		migrate: migrateSensorDataTimestamps,
+	},
+	{
+		description: "add ACTIVE to CONTROLLER, MIN and MAX to SENSOR_TYPE and create table SENSOR_DATA_QUARANTINE",
+		statements: `
+    ALTER TABLE CONTROLLER ADD COLUMN ACTIVE INTEGER not null default 1;
+    ALTER TABLE SENSOR_TYPE ADD COLUMN MIN REAL;
+    ALTER TABLE SENSOR_TYPE ADD COLUMN MAX REAL;
+    UPDATE SENSOR_TYPE SET MIN = 0, MAX = 100 WHERE NAME IN ('humidity', 'soil-moisture');
+    UPDATE SENSOR_TYPE SET MIN = -40, MAX = 85 WHERE NAME = 'temperature';
+    CREATE TABLE SENSOR_DATA_QUARANTINE
+    (
+        ID         INTEGER not null
+            constraint ID
+                primary key autoincrement,
+        CONTROLLER TEXT    not null,
+        SENSOR     TEXT    not null,
+        VALUE      REAL    not null,
+        TIMESTAMP  INTEGER not null,
+        REASON     TEXT    not null,
+        RECEIVED   INTEGER not null
+    );`,
+	},
+	{
+		description: "make SENSOR_DATA unique per CONTROLLER, SENSOR and TIMESTAMP",
+		statements: `
+    DELETE FROM SENSOR_DATA
+        WHERE ROWID NOT IN (
+            SELECT MAX(SD.ROWID)
+            FROM SENSOR_DATA SD
+            GROUP BY SD.CONTROLLER, SD.SENSOR, SD.TIMESTAMP
+        );
+    DROP INDEX SENSOR_DATA_CONTROLLER_SENSOR_TIMESTAMP;
+    CREATE UNIQUE INDEX SENSOR_DATA_CONTROLLER_SENSOR_TIMESTAMP
+        ON SENSOR_DATA (CONTROLLER, SENSOR, TIMESTAMP);`,
+	},
+	{
+		description: "create table IDEMPOTENCY_KEY",
+		statements: `
+    CREATE TABLE IDEMPOTENCY_KEY
+    (
+        PRINCIPAL    TEXT    not null,
+        KEY          TEXT    not null,
+        REQUEST_HASH TEXT    not null,
+        STATUS       INTEGER,
+        CONTENT_TYPE TEXT,
+        BODY         BLOB,
+        RESERVED     INTEGER not null,
+        CREATED      INTEGER not null,
+        constraint PRINCIPAL_KEY
+            primary key (PRINCIPAL, KEY)
+    );
+    CREATE INDEX IDEMPOTENCY_KEY_CREATED
+        ON IDEMPOTENCY_KEY (CREATED);`,
+	},
+}
+
+// legacyTimestampLayouts are the formats SENSOR_DATA timestamps have been stored in before migration 10.
+// Timestamps without a zone are in UTC.
+var legacyTimestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST", // Go's Time.String()
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999", // Python's datetime.isoformat()
+	"2006-01-02 15:04:05.999999999", // SQLite's DATETIME()
+}
+
+// migrateSensorDataTimestamps copies all sensor data to SENSOR_DATA_NEW, converting the timestamps to
+// unix milliseconds, and replaces SENSOR_DATA with it.
+func migrateSensorDataTimestamps(tx *sql.Tx) error {
+	insert, err := tx.Prepare(`
+    INSERT INTO SENSOR_DATA_NEW (CONTROLLER, SENSOR, VALUE, TIMESTAMP)
+    VALUES (?, ?, ?, ?);`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	type row struct {
+		rowId      int64
+		controller string
+		sensor     string
+		value      float64
+		timestamp  string
+	}
+
+	// Copy in batches, so large tables do not have to fit into memory
+	var lastRowId int64
+	for {
+		rows, err := tx.Query(`
+        SELECT ROWID, CONTROLLER, SENSOR, VALUE, TIMESTAMP
+        FROM SENSOR_DATA
+        WHERE ROWID > ?
+        ORDER BY ROWID
+        LIMIT 1000;`, lastRowId)
+		if err != nil {
+			return err
+		}
+
+		var batch []*row
+		for rows.Next() {
+			r := &row{}
+			err = rows.Scan(&r.rowId, &r.controller, &r.sensor, &r.value, &r.timestamp)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			batch = append(batch, r)
+		}
+		rows.Close()
+
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, r := range batch {
+			timestamp, err := parseLegacyTimestamp(r.timestamp)
+			if err != nil {
+				return fmt.Errorf("sensor data %d: %s", r.rowId, err.Error())
+			}
+
+			_, err = insert.Exec(r.controller, r.sensor, r.value, timestamp.UnixMilli())
+			if err != nil {
+				return err
+			}
+		}
+
+		lastRowId = batch[len(batch)-1].rowId
+	}
+
+	_, err = tx.Exec(`
+    DROP TABLE SENSOR_DATA;
+    ALTER TABLE SENSOR_DATA_NEW RENAME TO SENSOR_DATA;
+    CREATE INDEX SENSOR_DATA_CONTROLLER_SENSOR_TIMESTAMP
+        ON SENSOR_DATA (CONTROLLER, SENSOR, TIMESTAMP);`)
+
+	return err
+}
+
+// parseLegacyTimestamp parses a timestamp in any of the legacyTimestampLayouts.
+func parseLegacyTimestamp(value string) (time.Time, error) {
+	// Go's Time.String() appends the monotonic clock reading if there is one
+	value, _, _ = strings.Cut(value, " m=")
+
+	for _, layout := range legacyTimestampLayouts {
+		timestamp, err := time.Parse(layout, value)
+		if err == nil {
+			return timestamp, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown timestamp format %s", value)
+}
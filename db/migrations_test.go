@@ -0,0 +1,271 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+)
+
+// legacySensorData is sensor data as stored before migration 10, along with the timestamp it has to be migrated to.
+var legacySensorData = []struct {
+	timestamp string
+	millis    int64
+}{
+	{"2023-05-01 12:00:00.123456789 +0200 CEST m=+3.000000001", 1682935200123},
+	{"2023-05-01 12:00:01 +0000 UTC", 1682942401000},
+	{"2023-05-01T12:00:02.5Z", 1682942402500},
+	{"2023-05-01T14:00:03+02:00", 1682942403000},
+	{"2023-05-01T12:00:04.25", 1682942404250},
+	{"2023-05-01 12:00:05", 1682942405000},
+}
+
+// setupTestBaseline configures a database in memory holding the schema and data of `buddy-default.sqlite`
+// (version 0). It returns a connection to it, which keeps the database alive until the test ends.
+func setupTestBaseline(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dataSource := "file:" + t.Name() + "?mode=memory&cache=shared"
+	config.PlantBuddyConfig.Database = config.Database{DriverName: "sqlite3", DataSource: dataSource}
+
+	db, err := sql.Open("sqlite3", dataSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// ATTACH only applies to a single connection
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`ATTACH DATABASE '../buddy-default.sqlite' AS BASELINE;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`
+    SELECT TYPE, NAME, SQL
+    FROM BASELINE.SQLITE_MASTER
+    WHERE SQL IS NOT NULL
+        AND NAME != 'sqlite_sequence'
+    ORDER BY TYPE DESC;`) // Tables before indices
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statements []string
+	for rows.Next() {
+		var kind, name, statement string
+		err = rows.Scan(&kind, &name, &statement)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		statements = append(statements, statement)
+		if kind == "table" {
+			statements = append(statements, "INSERT INTO MAIN."+name+" SELECT * FROM BASELINE."+name+";")
+		}
+	}
+	rows.Close()
+
+	for _, statement := range statements {
+		_, err = db.Exec(statement)
+		if err != nil {
+			t.Fatalf("%s: %s", statement, err.Error())
+		}
+	}
+
+	_, err = db.Exec(`DETACH DATABASE BASELINE;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestMigrateSensorData(t *testing.T) {
+	db := setupTestBaseline(t)
+
+	_, err := db.Exec(`INSERT INTO CONTROLLER (UUID, PLANT_GROUP) VALUES ('controller', 1);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, d := range legacySensorData {
+		_, err = db.Exec(`INSERT INTO SENSOR_DATA (CONTROLLER, SENSOR, VALUE, TIMESTAMP) VALUES ('controller', 'humidity', ?, ?);`, i, d.timestamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The same instant in another format, which is a duplicate once migrated: the last one stored is kept
+	_, err = db.Exec(`INSERT INTO SENSOR_DATA (CONTROLLER, SENSOR, VALUE, TIMESTAMP) VALUES ('controller', 'humidity', 42, '2023-05-01T12:00:01Z');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var version int
+	err = db.QueryRow(`PRAGMA user_version;`).Scan(&version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != len(migrations) {
+		t.Fatalf("got version %d, want %d", version, len(migrations))
+	}
+
+	for i, d := range legacySensorData {
+		want := float64(i)
+		if i == 1 {
+			want = 42
+		}
+
+		var value float64
+		err = db.QueryRow(`SELECT VALUE FROM SENSOR_DATA WHERE TIMESTAMP = ?;`, d.millis).Scan(&value)
+		if err != nil {
+			t.Errorf("%s: %s", d.timestamp, err.Error())
+			continue
+		}
+
+		if value != want {
+			t.Errorf("%s: got value %g, want %g", d.timestamp, value, want)
+		}
+	}
+
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM SENSOR_DATA;`).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != len(legacySensorData) {
+		t.Errorf("got %d sensor data sets, want %d", count, len(legacySensorData))
+	}
+
+	// Migration 12
+	_, err = db.Exec(`INSERT INTO SENSOR_DATA (CONTROLLER, SENSOR, VALUE, TIMESTAMP) VALUES ('controller', 'humidity', 1, ?);`, legacySensorData[0].millis)
+	if err == nil {
+		t.Error("duplicate sensor data has been stored")
+	}
+
+	// Running it again must not change anything
+	err = Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateSchema(t *testing.T) {
+	db := setupTestBaseline(t)
+
+	_, err := db.Exec(`
+    INSERT INTO PLANT_GROUP (ID, NAME) VALUES (1, 'herbs'), (2, 'cacti');
+    INSERT INTO USERS (ID, NAME, PASSWORD, ROLE) VALUES (4, 'viewer', '', 2);
+    INSERT INTO CONTROLLER (UUID, PLANT_GROUP) VALUES ('controller', 1);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Migration 3: existing non-admin users keep their access to all plant groups
+	rows, err := db.Query(`
+    SELECT U.NAME, A.PLANT_GROUP, A.ACCESS
+    FROM PLANT_GROUP_ACCESS A
+             JOIN USERS U ON U.ID = A.USER
+    ORDER BY U.NAME, A.PLANT_GROUP;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var access []string
+	for rows.Next() {
+		var name, groupAccess string
+		var plantGroup int64
+		err = rows.Scan(&name, &plantGroup, &groupAccess)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		access = append(access, fmt.Sprintf("%s:%d:%s", name, plantGroup, groupAccess))
+	}
+	rows.Close()
+
+	want := []string{"hofi:1:write", "hofi:2:write", "viewer:1:read", "viewer:2:read"}
+	if strings.Join(access, ",") != strings.Join(want, ",") {
+		t.Errorf("got access %v, want %v", access, want)
+	}
+
+	// Migration 11: existing controllers stay active, the default sensor types get bounds
+	var active bool
+	err = db.QueryRow(`SELECT ACTIVE FROM CONTROLLER WHERE UUID = 'controller';`).Scan(&active)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !active {
+		t.Error("existing controller is not active")
+	}
+
+	bounds := []struct {
+		sensor string
+		min    float64
+		max    float64
+	}{
+		{"humidity", 0, 100},
+		{"soil-moisture", 0, 100},
+		{"temperature", -40, 85},
+	}
+
+	for _, b := range bounds {
+		var min, max float64
+		err = db.QueryRow(`SELECT MIN, MAX FROM SENSOR_TYPE WHERE NAME = ?;`, b.sensor).Scan(&min, &max)
+		if err != nil {
+			t.Errorf("%s: %s", b.sensor, err.Error())
+			continue
+		}
+
+		if min != b.min || max != b.max {
+			t.Errorf("%s: got bounds [%g, %g], want [%g, %g]", b.sensor, min, max, b.min, b.max)
+		}
+	}
+
+	tables := []string{"SENSOR_DATA_QUARANTINE", "IDEMPOTENCY_KEY"}
+	for _, table := range tables {
+		_, err = db.Exec(`SELECT * FROM ` + table + `;`)
+		if err != nil {
+			t.Errorf("table %s: %s", table, err.Error())
+		}
+	}
+}
+
+func TestParseLegacyTimestamp(t *testing.T) {
+	for _, d := range legacySensorData {
+		timestamp, err := parseLegacyTimestamp(d.timestamp)
+		if err != nil {
+			t.Errorf("%s: %s", d.timestamp, err.Error())
+			continue
+		}
+
+		if timestamp.UnixMilli() != d.millis {
+			t.Errorf("%s: got %s, want %s", d.timestamp, timestamp.UTC(), time.UnixMilli(d.millis).UTC())
+		}
+	}
+
+	for _, value := range []string{"", "yesterday", "01.05.2023 12:00:00", "1682942401000"} {
+		_, err := parseLegacyTimestamp(value)
+		if err == nil {
+			t.Errorf("%q has been parsed", value)
+		}
+	}
+}
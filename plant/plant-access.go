@@ -0,0 +1,47 @@
+package plant
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/plantineers/plantbuddy-server/auth"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// checkPlantGroupAccess returns true if the authenticated user has at least the given access to the plant group.
+// Otherwise, it writes an error response and returns false.
+func checkPlantGroupAccess(w http.ResponseWriter, r *http.Request, plantGroupId int64, access auth.Access) bool {
+	granted, err := auth.CanAccessPlantGroup(r.Context(), plantGroupId, access)
+	if err != nil {
+		msg := fmt.Sprintf("Error checking access to plant group %d: %s", plantGroupId, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return false
+	}
+
+	if !granted {
+		msg := fmt.Sprintf("Insufficient permissions (no %s access to plant group %d)", access, plantGroupId)
+		utils.HttpForbiddenResponse(w, msg)
+		return false
+	}
+
+	return true
+}
+
+// checkPlantAccess returns the plant and true if the authenticated user has at least the given access to the
+// plant's group. Otherwise, it writes an error response and returns false.
+func checkPlantAccess(w http.ResponseWriter, r *http.Request, id int64, access auth.Access) (*Plant, bool) {
+	plant, err := getPlantById(id)
+	switch err {
+	case nil:
+		return plant, checkPlantGroupAccess(w, r, plant.PlantGroup.ID, access)
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("Plant with id %d not found", id)
+		utils.HttpNotFoundResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error getting plant with id %d: %s", id, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+
+	return nil, false
+}
@@ -0,0 +1,164 @@
+package plant
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plantineers/plantbuddy-server/auth"
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// testPassword is the password of all users added by setupTestPlantAccess.
+const testPassword = "secret"
+
+// setupTestPlantAccess adds the plant groups 1 and 2 with one plant each and the following users:
+// "admin" (admin), "gardener" (write access to plant group 1), "viewer" (read access to plant group 1) and
+// "stranger" (gardener without any access).
+func setupTestPlantAccess(t *testing.T) {
+	t.Helper()
+
+	dbtest.Setup(t)
+	config.PlantBuddyConfig.Auth.BruteForce = config.BruteForce{FreeAttempts: 3, FreeAttemptsPerIp: 20}
+
+	hash, err := utils.HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbtest.Exec(t, `
+    INSERT INTO PLANT_GROUP (ID, NAME) VALUES (1, 'herbs'), (2, 'cacti');
+    INSERT INTO PLANT (ID, PLANT_GROUP, NAME, SPECIES, LOCATION)
+    VALUES (1, 1, 'basil', 'Ocimum basilicum', 'kitchen'),
+           (2, 2, 'aloe', 'Aloe vera', 'office');
+    INSERT INTO USERS (ID, NAME, PASSWORD, ROLE)
+    VALUES (10, 'admin', ?1, 0),
+           (11, 'gardener', ?1, 1),
+           (12, 'viewer', ?1, 2),
+           (13, 'stranger', ?1, 1);
+    INSERT INTO PLANT_GROUP_ACCESS (USER, PLANT_GROUP, ACCESS)
+    VALUES (11, 1, 'write'),
+           (12, 1, 'read');`, hash)
+}
+
+// serveTestAccess serves a GET request of the given user to the handler behind the authentication middleware.
+func serveTestAccess(name string, target string, handler func(http.ResponseWriter, *http.Request)) *httptest.ResponseRecorder {
+	permissions := auth.RoutePermissions{http.MethodGet: auth.PlantsRead}
+
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.SetBasicAuth(name, testPassword)
+	w := httptest.NewRecorder()
+	auth.UserAuthMiddleware(handler, permissions).ServeHTTP(w, r)
+	return w
+}
+
+func TestCheckPlantGroupAccess(t *testing.T) {
+	setupTestPlantAccess(t)
+
+	tests := []struct {
+		user       string
+		plantGroup int64
+		access     auth.Access
+		status     int
+	}{
+		{"admin", 1, auth.WriteAccess, http.StatusOK},
+		{"admin", 2, auth.WriteAccess, http.StatusOK},
+		{"gardener", 1, auth.ReadAccess, http.StatusOK},
+		{"gardener", 1, auth.WriteAccess, http.StatusOK},
+		{"gardener", 2, auth.ReadAccess, http.StatusForbidden},
+		{"viewer", 1, auth.ReadAccess, http.StatusOK},
+		{"viewer", 1, auth.WriteAccess, http.StatusForbidden},
+		{"viewer", 2, auth.ReadAccess, http.StatusForbidden},
+		{"stranger", 1, auth.ReadAccess, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		w := serveTestAccess(test.user, "/v1/plant-group/1", func(w http.ResponseWriter, r *http.Request) {
+			if checkPlantGroupAccess(w, r, test.plantGroup, test.access) {
+				utils.HttpOkResponse(w, nil)
+			}
+		})
+
+		if w.Code != test.status {
+			t.Errorf("%s with %s access to plant group %d: got status %d (%s), want %d",
+				test.user, test.access, test.plantGroup, w.Code, w.Body.String(), test.status)
+		}
+	}
+}
+
+func TestCheckPlantAccess(t *testing.T) {
+	setupTestPlantAccess(t)
+
+	tests := []struct {
+		user   string
+		plant  int64
+		access auth.Access
+		status int
+	}{
+		{"admin", 2, auth.WriteAccess, http.StatusOK},
+		{"gardener", 1, auth.WriteAccess, http.StatusOK},
+		{"gardener", 2, auth.ReadAccess, http.StatusForbidden},
+		{"viewer", 1, auth.ReadAccess, http.StatusOK},
+		{"viewer", 1, auth.WriteAccess, http.StatusForbidden},
+		{"stranger", 1, auth.ReadAccess, http.StatusForbidden},
+		{"gardener", 99, auth.ReadAccess, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		w := serveTestAccess(test.user, "/v1/plant/1", func(w http.ResponseWriter, r *http.Request) {
+			plant, ok := checkPlantAccess(w, r, test.plant, test.access)
+			if ok && plant.ID == test.plant {
+				utils.HttpOkResponse(w, nil)
+			}
+		})
+
+		if w.Code != test.status {
+			t.Errorf("%s with %s access to plant %d: got status %d (%s), want %d",
+				test.user, test.access, test.plant, w.Code, w.Body.String(), test.status)
+		}
+	}
+}
+
+func TestRestrictingUserIdFilter(t *testing.T) {
+	setupTestPlantAccess(t)
+
+	tests := []struct {
+		user        string
+		plantGroups []int64
+		plants      []int64
+	}{
+		{"admin", []int64{1, 2}, []int64{1, 2}},
+		{"gardener", []int64{1}, []int64{1}},
+		{"viewer", []int64{1}, []int64{1}},
+		{"stranger", nil, nil},
+	}
+
+	for _, test := range tests {
+		var groups plantGroups
+		w := serveTestAccess(test.user, "/v1/plant-groups", PlantGroupsHandler)
+		err := json.Unmarshal(w.Body.Bytes(), &groups)
+		if w.Code != http.StatusOK || err != nil {
+			t.Fatalf("%s: got status %d (%s), want %d", test.user, w.Code, w.Body.String(), http.StatusOK)
+		}
+
+		// Compared as text, so nothing granted equals an empty list
+		if fmt.Sprint(groups.PlantGroups) != fmt.Sprint(test.plantGroups) {
+			t.Errorf("%s: got plant groups %v, want %v", test.user, groups.PlantGroups, test.plantGroups)
+		}
+
+		var allPlants plants
+		w = serveTestAccess(test.user, "/v1/plants", PlantsHandler)
+		err = json.Unmarshal(w.Body.Bytes(), &allPlants)
+		if w.Code != http.StatusOK || err != nil {
+			t.Fatalf("%s: got status %d (%s), want %d", test.user, w.Code, w.Body.String(), http.StatusOK)
+		}
+
+		if fmt.Sprint(allPlants.Plants) != fmt.Sprint(test.plants) {
+			t.Errorf("%s: got plants %v, want %v", test.user, allPlants.Plants, test.plants)
+		}
+	}
+}
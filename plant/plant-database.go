@@ -10,8 +10,8 @@ type PlantRepository interface {
 	// Reads all plantIds from the database and returns them as a slice of plants.
 	GetAll(filter *plantsFilter) ([]int64, error)
 
-	// Read all plants in the database and return them in short form (PlantStub)
-	GetAllOverview() ([]PlantStub, error)
+	// Read all plants matching the filter and return them in short form (PlantStub)
+	GetAllOverview(filter *plantsFilter) ([]PlantStub, error)
 
 	// Creates a new plant and returns it.
 	Create(plant *plantChange) (*Plant, error)
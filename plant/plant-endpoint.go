@@ -8,11 +8,15 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/plantineers/plantbuddy-server/auth"
 	"github.com/plantineers/plantbuddy-server/db"
 	"github.com/plantineers/plantbuddy-server/utils"
 )
 
-const convertPlantErrorStr = "Error converting plant %d to JSON: %s"
+const (
+	convertPlantErrorStr = "Error converting plant %d to JSON: %s"
+	auditEntityPlant     = "plant"
+)
 
 // PlantCreateHandler handles the creation of a new plant.
 func PlantCreateHandler(w http.ResponseWriter, r *http.Request) {
@@ -62,6 +66,10 @@ func handlePlantPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !checkPlantGroupAccess(w, r, plant.PlantGroupId, auth.WriteAccess) {
+		return
+	}
+
 	createdPlantGroup, err := createPlant(&plant)
 	if err == ErrPlantGroupNotExisting {
 		msg := fmt.Sprintf("Plant group with id %d does not exist", plant.PlantGroupId)
@@ -82,6 +90,8 @@ func handlePlantPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auth.RecordAudit(r, auditEntityPlant, createdPlantGroup.ID, nil, createdPlantGroup)
+
 	msg := fmt.Sprintf("Plant with id %d created", createdPlantGroup.ID)
 	location := fmt.Sprintf("/v1/plant/%d", createdPlantGroup.ID)
 	utils.HttpCreatedResponse(w, b, location, msg)
@@ -95,6 +105,10 @@ func handlePlantGet(w http.ResponseWriter, r *http.Request, id int64) {
 		msg := fmt.Sprintf("Plant with id %d not found", id)
 		utils.HttpNotFoundResponse(w, msg)
 	case nil:
+		if !checkPlantGroupAccess(w, r, plant.PlantGroup.ID, auth.ReadAccess) {
+			return
+		}
+
 		b, err := json.Marshal(plant)
 		if err != nil {
 			msg := fmt.Sprintf(convertPlantErrorStr, plant.ID, err.Error())
@@ -127,6 +141,16 @@ func handlePlantPut(w http.ResponseWriter, r *http.Request, id int64) {
 		return
 	}
 
+	// The user needs write access to both the current and the new plant group
+	previous, ok := checkPlantAccess(w, r, id, auth.WriteAccess)
+	if !ok {
+		return
+	}
+
+	if !checkPlantGroupAccess(w, r, plantChange.PlantGroupId, auth.WriteAccess) {
+		return
+	}
+
 	plant, err := updatePlantById(id, &plantChange)
 	if err == ErrPlantGroupNotExisting {
 		msg := fmt.Sprintf("Plant group with id %d does not exist", plantChange.PlantGroupId)
@@ -147,12 +171,19 @@ func handlePlantPut(w http.ResponseWriter, r *http.Request, id int64) {
 		return
 	}
 
+	auth.RecordAudit(r, auditEntityPlant, id, previous, plant)
+
 	log.Printf("Plant with id %d updated", id)
 	utils.HttpOkResponse(w, b)
 }
 
 // handlePlantDelete handles the deletion of a plant by its ID.
 func handlePlantDelete(w http.ResponseWriter, r *http.Request, id int64) {
+	previous, ok := checkPlantAccess(w, r, id, auth.WriteAccess)
+	if !ok {
+		return
+	}
+
 	err := deletePlantById(id)
 	if err != nil {
 		msg := fmt.Sprintf("Error deleting plant with id %d: %s", id, err.Error())
@@ -160,6 +191,8 @@ func handlePlantDelete(w http.ResponseWriter, r *http.Request, id int64) {
 		return
 	}
 
+	auth.RecordAudit(r, auditEntityPlant, id, previous, nil)
+
 	log.Printf("Plant with id %d deleted", id)
 	utils.HttpOkResponse(w, nil)
 }
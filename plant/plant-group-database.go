@@ -6,11 +6,11 @@ type PlantGroupRepository interface {
 	// GetPlantGroupById returns a plant group by its ID.
 	GetById(id int64) (*PlantGroup, error)
 
-	// Reads all plantGroupIds from the database and returns them as a slice of plant groups.
-	GetAll() ([]int64, error)
+	// Reads all plantGroupIds matching the filter and returns them as a slice of plant groups.
+	GetAll(filter *plantGroupsFilter) ([]int64, error)
 
-	// Read all plant groups in the database and return them in short form (PlantGroupStub)
-	GetAllOverview() ([]PlantGroupStub, error)
+	// Read all plant groups matching the filter and return them in short form (PlantGroupStub)
+	GetAllOverview(filter *plantGroupsFilter) ([]PlantGroupStub, error)
 
 	// Create creates a new plant group in the database.
 	Create(plantGroup *plantGroupChange) (*PlantGroup, error)
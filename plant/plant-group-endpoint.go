@@ -7,11 +7,15 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/plantineers/plantbuddy-server/auth"
 	"github.com/plantineers/plantbuddy-server/db"
 	"github.com/plantineers/plantbuddy-server/utils"
 )
 
-const convertPlantGroupErrorStr = "Error converting plant group %d to JSON: %s"
+const (
+	convertPlantGroupErrorStr = "Error converting plant group %d to JSON: %s"
+	auditEntityPlantGroup     = "plant-group"
+)
 
 // PlantGroupCreateHandler handles the creation of a new plant group.
 func PlantGroupCreateHandler(w http.ResponseWriter, r *http.Request) {
@@ -68,12 +72,22 @@ func handlePlantGroupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Whoever creates a plant group may manage it
+	err = auth.GrantPlantGroupAccess(r.Context(), createdPlantGroup.ID, auth.WriteAccess)
+	if err != nil {
+		msg := fmt.Sprintf("Error granting access to plant group %d: %s", createdPlantGroup.ID, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
 	b, err := json.Marshal(createdPlantGroup)
 	if err != nil {
 		msg := fmt.Sprintf(convertPlantGroupErrorStr, createdPlantGroup.ID, err.Error())
 		utils.HttpInternalServerErrorResponse(w, msg)
 	}
 
+	auth.RecordAudit(r, auditEntityPlantGroup, createdPlantGroup.ID, nil, createdPlantGroup)
+
 	msg := fmt.Sprintf("Plant group with id %d created", createdPlantGroup.ID)
 	location := fmt.Sprintf("/v1/plant-group/%d", createdPlantGroup.ID)
 	utils.HttpCreatedResponse(w, b, location, msg)
@@ -81,6 +95,10 @@ func handlePlantGroupPost(w http.ResponseWriter, r *http.Request) {
 
 // handlePlantGroupGet handles the retrieval of a plant group by its ID.
 func handlePlantGroupGet(w http.ResponseWriter, r *http.Request, id int64) {
+	if !checkPlantGroupAccess(w, r, id, auth.ReadAccess) {
+		return
+	}
+
 	plantGroup, err := getPlantGroupById(id)
 
 	switch err {
@@ -119,6 +137,15 @@ func handlePlantGroupPut(w http.ResponseWriter, r *http.Request, id int64) {
 		return
 	}
 
+	if !checkPlantGroupAccess(w, r, id, auth.WriteAccess) {
+		return
+	}
+
+	previous, ok := loadPlantGroup(w, id)
+	if !ok {
+		return
+	}
+
 	updatedPlantGroup, err := updatePlantGroup(id, &plantGroup)
 	if err != nil {
 		msg := fmt.Sprintf("Error updating plant group with id %d: %s", id, err.Error())
@@ -132,12 +159,23 @@ func handlePlantGroupPut(w http.ResponseWriter, r *http.Request, id int64) {
 		utils.HttpInternalServerErrorResponse(w, msg)
 	}
 
+	auth.RecordAudit(r, auditEntityPlantGroup, id, previous, updatedPlantGroup)
+
 	log.Printf("Plant group with id %d updated", id)
 	utils.HttpOkResponse(w, b)
 }
 
 // handlePlantGroupDelete handles the deletion of a plant group by its ID.
 func handlePlantGroupDelete(w http.ResponseWriter, r *http.Request, id int64) {
+	if !checkPlantGroupAccess(w, r, id, auth.WriteAccess) {
+		return
+	}
+
+	previous, ok := loadPlantGroup(w, id)
+	if !ok {
+		return
+	}
+
 	err := deletePlantGroup(id)
 	if err != nil {
 		msg := fmt.Sprintf("Error deleting plant group with id %d: %s", id, err.Error())
@@ -145,10 +183,37 @@ func handlePlantGroupDelete(w http.ResponseWriter, r *http.Request, id int64) {
 		return
 	}
 
+	err = auth.RevokePlantGroupAccess(id)
+	if err != nil {
+		msg := fmt.Sprintf("Error revoking access to plant group with id %d: %s", id, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	auth.RecordAudit(r, auditEntityPlantGroup, id, previous, nil)
+
 	log.Printf("Plant group with id %d deleted", id)
 	utils.HttpOkResponse(w, nil)
 }
 
+// loadPlantGroup returns the plant group and true if it exists.
+// Otherwise, it writes an error response and returns false.
+func loadPlantGroup(w http.ResponseWriter, id int64) (*PlantGroup, bool) {
+	plantGroup, err := getPlantGroupById(id)
+	switch err {
+	case nil:
+		return plantGroup, true
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("Plant group with id %d not found", id)
+		utils.HttpNotFoundResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error loading plant group with id %d: %s", id, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+
+	return nil, false
+}
+
 // createPlantGroup creates a new plant group.
 func createPlantGroup(plantGroup *plantGroupChange) (*PlantGroup, error) {
 	var session = db.NewSession()
@@ -90,9 +90,20 @@ func (r *PlantGroupSqliteRepository) GetById(id int64) (*PlantGroup, error) {
 	return &plantGroup, nil
 }
 
-func (r *PlantGroupSqliteRepository) GetAll() ([]int64, error) {
+func (r *PlantGroupSqliteRepository) GetAll(filter *plantGroupsFilter) ([]int64, error) {
+	if filter == nil {
+		filter = &plantGroupsFilter{}
+	}
+
 	var plantGroupIds []int64
-	rows, err := r.db.Query(`SELECT ID FROM PLANT_GROUP;`)
+	rows, err := r.db.Query(`
+    SELECT PG.ID
+    FROM PLANT_GROUP PG
+    WHERE ? = 0 OR PG.ID IN (
+        SELECT PGA.PLANT_GROUP
+        FROM PLANT_GROUP_ACCESS PGA
+        WHERE PGA.USER = ?
+    );`, filter.UserId, filter.UserId)
 	if err != nil {
 		return nil, err
 	}
@@ -222,12 +233,21 @@ func (r *PlantGroupSqliteRepository) Delete(id int64) error {
 	return nil
 }
 
-func (r *PlantGroupSqliteRepository) GetAllOverview() ([]PlantGroupStub, error) {
+func (r *PlantGroupSqliteRepository) GetAllOverview(filter *plantGroupsFilter) ([]PlantGroupStub, error) {
+	if filter == nil {
+		filter = &plantGroupsFilter{}
+	}
+
 	var plantGroups []PlantGroupStub
 	rows, err := r.db.Query(`
     SELECT PG.ID,
         PG.NAME
-        FROM PLANT_GROUP PG;`)
+        FROM PLANT_GROUP PG
+    WHERE ? = 0 OR PG.ID IN (
+        SELECT PGA.PLANT_GROUP
+        FROM PLANT_GROUP_ACCESS PGA
+        WHERE PGA.USER = ?
+    );`, filter.UserId, filter.UserId)
 	if err != nil {
 		return nil, err
 	}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/plantineers/plantbuddy-server/auth"
 	"github.com/plantineers/plantbuddy-server/db"
 	"github.com/plantineers/plantbuddy-server/utils"
 )
@@ -30,7 +31,11 @@ func PlantGroupOverviewHandler(w http.ResponseWriter, r *http.Request) {
 
 // handlePlantGroupsGet handles the retrieval of all plant groups.
 func handlePlantGroupsGet(w http.ResponseWriter, r *http.Request) {
-	allPlantGroups, err := getAllPlantGroups()
+	filter := &plantGroupsFilter{
+		UserId: auth.RestrictingUserId(r.Context()),
+	}
+
+	allPlantGroups, err := getAllPlantGroups(filter)
 	if err != nil {
 		msg := fmt.Sprintf("Error getting all plant groups: %s", err.Error())
 		utils.HttpInternalServerErrorResponse(w, msg)
@@ -49,7 +54,7 @@ func handlePlantGroupsGet(w http.ResponseWriter, r *http.Request) {
 }
 
 // getAllPlantGroups retrieves all plant groups from the database.
-func getAllPlantGroups() (*plantGroups, error) {
+func getAllPlantGroups(filter *plantGroupsFilter) (*plantGroups, error) {
 	var session = db.NewSession()
 	defer session.Close()
 
@@ -63,13 +68,17 @@ func getAllPlantGroups() (*plantGroups, error) {
 		return nil, err
 	}
 
-	plantGroupIds, err := repository.GetAll()
+	plantGroupIds, err := repository.GetAll(filter)
 	return &plantGroups{PlantGroups: plantGroupIds}, err
 }
 
 // handlePlantGroupOverviewGet handles the retrieval of all plant group overviews.
 func handlePlantGroupOverviewGet(w http.ResponseWriter, r *http.Request) {
-	allPlantGroups, err := getAllPlantGroupOverview()
+	filter := &plantGroupsFilter{
+		UserId: auth.RestrictingUserId(r.Context()),
+	}
+
+	allPlantGroups, err := getAllPlantGroupOverview(filter)
 	if err != nil {
 		msg := fmt.Sprintf("Error getting all plant groups: %s", err.Error())
 		utils.HttpInternalServerErrorResponse(w, msg)
@@ -88,7 +97,7 @@ func handlePlantGroupOverviewGet(w http.ResponseWriter, r *http.Request) {
 }
 
 // getAllPlantGroupOverview retrieves all plant group overviews from the database.
-func getAllPlantGroupOverview() (*plantGroupsOverview, error) {
+func getAllPlantGroupOverview(filter *plantGroupsFilter) (*plantGroupsOverview, error) {
 	var session = db.NewSession()
 	defer session.Close()
 
@@ -102,6 +111,6 @@ func getAllPlantGroupOverview() (*plantGroupsOverview, error) {
 		return nil, err
 	}
 
-	plantGroupStubs, err := repository.GetAllOverview()
+	plantGroupStubs, err := repository.GetAllOverview(filter)
 	return &plantGroupsOverview{PlantGroups: plantGroupStubs}, err
 }
@@ -40,7 +40,12 @@ type plantsOverview struct {
 }
 
 type plantsFilter struct {
-	PlantGroupId int64
+	PlantGroupId int64 // Only plants of this plant group (0 = all plant groups)
+	UserId       int64 // Only plants of plant groups the user has access to (0 = unrestricted)
+}
+
+type plantGroupsFilter struct {
+	UserId int64 // Only plant groups the user has access to (0 = unrestricted)
 }
 
 type plantGroups struct {
@@ -117,11 +117,21 @@ func (r *PlantSqliteRepository) GetAll(filter *plantsFilter) ([]int64, error) {
 }
 
 func (r *PlantSqliteRepository) getAllApplyFilter(filter *plantsFilter) (*sql.Rows, error) {
-	if filter != nil {
-		return r.db.Query(`SELECT ID FROM PLANT WHERE PLANT_GROUP = ?;`, filter.PlantGroupId)
+	if filter == nil {
+		filter = &plantsFilter{}
 	}
 
-	return r.db.Query(`SELECT ID FROM PLANT;`)
+	return r.db.Query(`
+    SELECT P.ID
+    FROM PLANT P
+    WHERE (? = 0 OR P.PLANT_GROUP = ?)
+        AND (? = 0 OR P.PLANT_GROUP IN (
+            SELECT PGA.PLANT_GROUP
+            FROM PLANT_GROUP_ACCESS PGA
+            WHERE PGA.USER = ?
+        ));`,
+		filter.PlantGroupId, filter.PlantGroupId,
+		filter.UserId, filter.UserId)
 }
 
 func (r *PlantSqliteRepository) Create(plant *plantChange) (*Plant, error) {
@@ -234,12 +244,24 @@ func (r *PlantSqliteRepository) DeleteById(id int64) error {
 	return nil
 }
 
-func (r *PlantSqliteRepository) GetAllOverview() ([]PlantStub, error) {
+func (r *PlantSqliteRepository) GetAllOverview(filter *plantsFilter) ([]PlantStub, error) {
+	if filter == nil {
+		filter = &plantsFilter{}
+	}
+
 	rows, err := r.db.Query(`
     SELECT
         P.ID,
         P.NAME
-        FROM PLANT P;`)
+        FROM PLANT P
+    WHERE (? = 0 OR P.PLANT_GROUP = ?)
+        AND (? = 0 OR P.PLANT_GROUP IN (
+            SELECT PGA.PLANT_GROUP
+            FROM PLANT_GROUP_ACCESS PGA
+            WHERE PGA.USER = ?
+        ));`,
+		filter.PlantGroupId, filter.PlantGroupId,
+		filter.UserId, filter.UserId)
 
 	if err != nil {
 		return nil, err
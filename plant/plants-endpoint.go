@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/plantineers/plantbuddy-server/auth"
 	"github.com/plantineers/plantbuddy-server/db"
 	"github.com/plantineers/plantbuddy-server/utils"
 )
@@ -32,7 +33,10 @@ func PlantOverviewHandler(w http.ResponseWriter, r *http.Request) {
 // handlePlantsGet handles the retrieval of all plants.
 func handlePlantsGet(w http.ResponseWriter, r *http.Request) {
 	plantGroupIdStr := r.URL.Query().Get("plantGroupId")
-	var filter *plantsFilter
+	filter := &plantsFilter{
+		UserId: auth.RestrictingUserId(r.Context()),
+	}
+
 	if plantGroupIdStr != "" {
 		plantGroupId, err := strconv.ParseInt(plantGroupIdStr, 10, 64)
 		if err != nil {
@@ -41,9 +45,7 @@ func handlePlantsGet(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		filter = &plantsFilter{
-			PlantGroupId: plantGroupId,
-		}
+		filter.PlantGroupId = plantGroupId
 	}
 
 	allPlants, err := getAllPlants(filter)
@@ -85,7 +87,11 @@ func getAllPlants(filter *plantsFilter) (*plants, error) {
 
 // handlePlantOverviewGet handles the retrieval of all plants.
 func handlePlantOverviewGet(w http.ResponseWriter, r *http.Request) {
-	allPlants, err := getAllPlantOverview()
+	filter := &plantsFilter{
+		UserId: auth.RestrictingUserId(r.Context()),
+	}
+
+	allPlants, err := getAllPlantOverview(filter)
 	if err != nil {
 		msg := fmt.Sprintf("Error getting all plants: %s", err.Error())
 		utils.HttpInternalServerErrorResponse(w, msg)
@@ -104,7 +110,7 @@ func handlePlantOverviewGet(w http.ResponseWriter, r *http.Request) {
 }
 
 // getAllPlantOverview retrieves all plants from the database.
-func getAllPlantOverview() (*plantsOverview, error) {
+func getAllPlantOverview(filter *plantsFilter) (*plantsOverview, error) {
 	var session = db.NewSession()
 	defer session.Close()
 
@@ -118,6 +124,6 @@ func getAllPlantOverview() (*plantsOverview, error) {
 		return nil, err
 	}
 
-	plantIds, err := plantRepository.GetAllOverview()
+	plantIds, err := plantRepository.GetAllOverview(filter)
 	return &plantsOverview{Plants: plantIds}, err
 }
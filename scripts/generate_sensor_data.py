@@ -14,7 +14,7 @@ table to get the range of values for each sensor
     c. Save the value in the SENSOR_DATA table
 """
 
-from datetime import datetime, timedelta
+from datetime import datetime, timedelta, timezone
 from random import uniform
 from sqlite3 import Cursor, connect
 from sys import exit as _exit
@@ -38,10 +38,11 @@ def read_sensor_ranges(cursor: Cursor, plant_group: int) -> List[Tuple[str, int,
 
 
 def generate_sensor_data(cursor: Cursor, controller: str, sensor: Tuple[str, int, int], time: datetime) -> None:
-    """Inserts the generated sensor data into the SENSOR_DATA table"""
+    """Inserts the generated sensor data into the SENSOR_DATA table (timestamps in unix milliseconds)"""
     value = round(uniform(sensor[1], sensor[2]), 2)
+    timestamp = int(time.replace(tzinfo=timezone.utc).timestamp() * 1000)
     cursor.execute("INSERT INTO SENSOR_DATA (CONTROLLER, SENSOR, VALUE, TIMESTAMP) VALUES (?, ?, ?, ?)",
-                   (controller, sensor[0], value, time.isoformat()))
+                   (controller, sensor[0], value, timestamp))
 
 
 if __name__ == '__main__':
@@ -54,7 +55,7 @@ if __name__ == '__main__':
 
     t = datetime(2023, 5, 20, 0, 0, 0)
     COUNTER = 0
-    while t < datetime.now():
+    while t < datetime.utcnow():
         for c, sr in full_controllers.items():
             for s in sr:
                 generate_sensor_data(cur, c, s, t)
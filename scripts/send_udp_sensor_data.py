@@ -0,0 +1,56 @@
+#!/usr/bin/python3
+
+"""
+This script sends sensor data to the UDP listener of the server like a low-power controller would.
+
+Usage: send_udp_sensor_data.py <controller UUID> <message key> <counter> <sensor>=<value> [<sensor>=<value> ...]
+
+The packet format is described in `sensor/sensor-data-udp.go`. The packet is authenticated by an HMAC-SHA256 keyed
+with the message key of the controller, which is returned as hex string along with its API key. The counter must be
+greater than the one of the last packet accepted since the key has been issued.
+"""
+
+import hashlib
+import hmac
+import socket
+import struct
+import time
+import uuid
+from sys import argv
+from sys import exit as _exit
+from typing import List, Tuple
+
+VERSION = 1
+MAC_LENGTH = 16
+
+
+def build_packet(controller: str, message_key: str, counter: int, readings: List[Tuple[str, float]]) -> bytes:
+    """Builds an authenticated packet with the given readings, measured now"""
+    message = struct.pack('>B16sIIB', VERSION, uuid.UUID(controller).bytes, counter, int(time.time()), len(readings))
+    for sensor, value in readings:
+        message += struct.pack('>B', len(sensor)) + sensor.encode() + struct.pack('>f', value)
+
+    return message + hmac.new(bytes.fromhex(message_key), message, hashlib.sha256).digest()[:MAC_LENGTH]
+
+
+if __name__ == '__main__':
+    if len(argv) < 5:
+        print(__doc__)
+        _exit(-1)
+
+    packet = build_packet(argv[1], argv[2], int(argv[3]),
+                          [(s, float(v)) for s, v in (reading.split('=', 1) for reading in argv[4:])])
+
+    sock = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+    sock.settimeout(2)
+    sock.sendto(packet, ('localhost', 3334))
+
+    try:
+        ack = sock.recv(6)
+        status = {0: 'saved', 1: 'rejected', 2: 'error'}.get(ack[5], 'unknown')
+        print(f"Packet {struct.unpack('>I', ack[1:5])[0]} ({len(packet)} bytes): {status}")
+    except socket.timeout:
+        print("No acknowledgement (invalid packet or MAC)")
+else:
+    print("This script cannot be imported")
+    _exit(-1)
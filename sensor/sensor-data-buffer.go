@@ -0,0 +1,228 @@
+package sensor
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// ErrWriteBufferFull is returned if a batch cannot be queued, as the write buffer already holds the maximum
+// number of readings. The batch should be sent again later.
+var ErrWriteBufferFull = errors.New("write buffer is full")
+
+// writeBuffer is the running write buffer, nil if it is disabled or has been stopped.
+var writeBuffer *sensorDataWriteBuffer
+
+// sensorDataWriteBuffer queues the batches of all requests and commits them in a single transaction (group commit)
+// once enough readings are queued or the flush interval has passed. Requests wait until their batch is committed,
+// so they get the result of each data set as if they had stored it themselves.
+type sensorDataWriteBuffer struct {
+	mu       sync.Mutex
+	queued   []*queuedBatch
+	pending  int // Readings in queued
+	readings int // Readings queued or being committed
+	closed   bool
+
+	maxReadings int
+	batchSize   int
+
+	flush   chan struct{} // Signals that batchSize has been reached
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// queuedBatch is a batch waiting to be committed along with the channel its result is sent to.
+type queuedBatch struct {
+	batch *SensorDataBatch
+	done  chan *SensorDataBatchResult
+}
+
+// StartWriteBuffer starts committing the sensor data of all requests in group transactions
+// as configured in `sensorData.writeBuffer`.
+func StartWriteBuffer() error {
+	conf := config.PlantBuddyConfig.SensorData.WriteBuffer
+	if conf.MaxReadings <= 0 || conf.BatchSize <= 0 || conf.FlushInterval.Duration <= 0 {
+		return errors.New("maxReadings, batchSize and flushInterval of the write buffer must be positive")
+	}
+
+	buffer := &sensorDataWriteBuffer{
+		maxReadings: conf.MaxReadings,
+		batchSize:   conf.BatchSize,
+		flush:       make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+
+	go buffer.run(conf.FlushInterval.Duration)
+	writeBuffer = buffer
+
+	log.Printf("Buffering up to %d readings of sensor data for %s", conf.MaxReadings, conf.FlushInterval.Duration)
+	return nil
+}
+
+// StopWriteBuffer commits all queued sensor data and stops the write buffer. Sensor data received afterwards
+// is stored right away.
+func StopWriteBuffer() {
+	buffer := writeBuffer
+	if buffer == nil {
+		return
+	}
+
+	buffer.mu.Lock()
+	buffer.closed = true
+	buffer.mu.Unlock()
+
+	close(buffer.stop)
+	<-buffer.stopped
+
+	log.Print("Flushed the write buffer of sensor data")
+}
+
+// run commits the queued batches whenever the flush interval has passed or enough readings are queued.
+func (b *sensorDataWriteBuffer) run(interval time.Duration) {
+	defer close(b.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.flush:
+		case <-b.stop:
+			b.commit()
+			return
+		}
+
+		b.commit()
+	}
+}
+
+// enqueue queues a batch and returns the channel its result will be sent to. It returns a nil channel if the buffer
+// is not running or the batch exceeds the maximum number of readings on its own, so the caller has to store it.
+func (b *sensorDataWriteBuffer) enqueue(batch *SensorDataBatch) (chan *SensorDataBatchResult, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	n := len(batch.Data) + len(batch.Quarantined)
+	if n > b.maxReadings {
+		return nil, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, nil
+	}
+
+	if b.readings+n > b.maxReadings {
+		return nil, ErrWriteBufferFull
+	}
+
+	done := make(chan *SensorDataBatchResult, 1)
+	b.queued = append(b.queued, &queuedBatch{batch: batch, done: done})
+	b.pending += n
+	b.readings += n
+
+	if b.pending >= b.batchSize {
+		select {
+		case b.flush <- struct{}{}:
+		default: // A flush is already due
+		}
+	}
+
+	return done, nil
+}
+
+// commit stores all queued batches in a single transaction and sends each batch its result.
+// The readings are counted until they have been committed, so new ones cannot pile up meanwhile.
+func (b *sensorDataWriteBuffer) commit() {
+	b.mu.Lock()
+	queued := b.queued
+	committing := b.pending
+	b.queued = nil
+	b.pending = 0
+	b.mu.Unlock()
+
+	if len(queued) == 0 {
+		return
+	}
+
+	batches := make([]*SensorDataBatch, len(queued))
+	for i, q := range queued {
+		batches[i] = q.batch
+	}
+
+	results, err := commitSensorDataBatches(batches)
+	if err != nil {
+		log.Printf("Error committing %d readings of %d batches of sensor data: %s", committing, len(batches), err.Error())
+	}
+
+	for i, q := range queued {
+		if err != nil {
+			q.done <- &SensorDataBatchResult{Err: err}
+		} else {
+			q.done <- results[i]
+		}
+	}
+
+	b.mu.Lock()
+	b.readings -= committing
+	b.mu.Unlock()
+}
+
+// ingestConcurrency returns how many readings received via MQTT or UDP are stored concurrently. With the write
+// buffer, enough of them wait for the next flush to fill a batch. Otherwise, they are stored one after another.
+func ingestConcurrency() int {
+	conf := config.PlantBuddyConfig.SensorData.WriteBuffer
+	if !conf.Enabled || conf.BatchSize <= 0 {
+		return 1
+	}
+
+	return conf.BatchSize
+}
+
+// storeSensorDataBatch stores a batch along with the batches of concurrent requests if the write buffer is running,
+// otherwise on its own. It returns the error of each data set like SensorDataRepository.SaveAll.
+func storeSensorDataBatch(batch *SensorDataBatch) ([]error, error) {
+	done, err := writeBuffer.enqueue(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	if done != nil {
+		result := <-done
+		return result.Errs, result.Err
+	}
+
+	results, err := commitSensorDataBatches([]*SensorDataBatch{batch})
+	if err != nil {
+		return nil, err
+	}
+
+	return results[0].Errs, results[0].Err
+}
+
+// commitSensorDataBatches stores the given batches in a single transaction.
+func commitSensorDataBatches(batches []*SensorDataBatch) ([]*SensorDataBatchResult, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := NewSensorDataRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.SaveAll(batches, config.PlantBuddyConfig.SensorData.OnConflict)
+}
@@ -0,0 +1,222 @@
+package sensor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+)
+
+// setupTestWriteBuffer uses the given write buffer for the test. It is neither started nor stopped.
+func setupTestWriteBuffer(t *testing.T, buffer *sensorDataWriteBuffer) {
+	t.Helper()
+
+	writeBuffer = buffer
+	t.Cleanup(func() { writeBuffer = nil })
+}
+
+// testSensorDataBatch returns an atomic batch of n readings of the test controller, measured a second apart
+// starting at the given time.
+func testSensorDataBatch(n int, measured time.Time) *SensorDataBatch {
+	batch := &SensorDataBatch{Atomic: true}
+	for i := 0; i < n; i++ {
+		batch.Data = append(batch.Data, testSensorData("humidity", 40, measured.Add(-time.Duration(i)*time.Second)))
+	}
+
+	return batch
+}
+
+func TestWriteBufferConcurrently(t *testing.T) {
+	setupTestDatabase(t)
+	config.PlantBuddyConfig.SensorData.WriteBuffer = config.WriteBuffer{
+		Enabled:       true,
+		MaxReadings:   1000,
+		BatchSize:     50,
+		FlushInterval: config.Duration{Duration: 50 * time.Millisecond},
+	}
+
+	err := StartWriteBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { writeBuffer = nil })
+
+	const callers = 20
+	const readings = 5
+	measured := time.Now().Add(-time.Hour)
+
+	// Every caller stores readings of its own, the last one repeats those of the first
+	batches := make([]*SensorDataBatch, callers+1)
+	for i := 0; i < callers; i++ {
+		batches[i] = testSensorDataBatch(readings, measured.Add(-time.Duration(i*readings)*time.Second))
+	}
+	batches[callers] = testSensorDataBatch(readings, measured)
+
+	var wg sync.WaitGroup
+	results := make([][]error, len(batches))
+	errs := make([]error, len(batches))
+	for i, batch := range batches {
+		wg.Add(1)
+		go func(i int, batch *SensorDataBatch) {
+			defer wg.Done()
+			results[i], errs[i] = storeSensorDataBatch(batch)
+		}(i, batch)
+	}
+	wg.Wait()
+
+	duplicates := 0
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("caller %d: %s", i, err.Error())
+		}
+
+		if len(results[i]) != readings {
+			t.Fatalf("caller %d: got %d results, want %d", i, len(results[i]), readings)
+		}
+
+		for j, err := range results[i] {
+			switch err {
+			case nil:
+			case ErrDuplicateSensorData:
+				duplicates++
+			default:
+				t.Errorf("caller %d: reading %d: %s", i, j, err.Error())
+			}
+		}
+	}
+
+	// Whichever of the first and the last caller is committed first stores the readings, the other one gets duplicates
+	if duplicates != readings {
+		t.Errorf("got %d duplicates, want %d", duplicates, readings)
+	}
+
+	// Queued batches are committed on stop, batches afterwards are stored right away
+	done, err := writeBuffer.enqueue(testSensorDataBatch(1, measured.Add(time.Minute)))
+	if err != nil || done == nil {
+		t.Fatalf("got channel %v and error %v, want a queued batch", done, err)
+	}
+
+	StopWriteBuffer()
+	if result := <-done; result.Err != nil || result.Errs[0] != nil {
+		t.Errorf("got %v and %v for a batch queued before stop, want it to be stored", result.Err, result.Errs)
+	}
+
+	stored, err := storeSensorDataBatch(testSensorDataBatch(1, measured.Add(2*time.Minute)))
+	if err != nil || stored[0] != nil {
+		t.Errorf("got %v and %v for a batch stored after stop, want it to be stored", err, stored)
+	}
+
+	if count := dbtest.CountRows(t, "SENSOR_DATA"); count != callers*readings+2 {
+		t.Errorf("got %d stored readings, want %d", count, callers*readings+2)
+	}
+}
+
+func TestWriteBufferFull(t *testing.T) {
+	setupTestDatabase(t)
+	config.PlantBuddyConfig.SensorData.WriteBuffer.FlushInterval = config.Duration{Duration: 1500 * time.Millisecond}
+
+	// Not running, so nothing is committed unless commit is called
+	buffer := &sensorDataWriteBuffer{maxReadings: 5, batchSize: 4, flush: make(chan struct{}, 1)}
+	setupTestWriteBuffer(t, buffer)
+	measured := time.Now().Add(-time.Hour)
+
+	// Each step depends on the readings queued by the previous ones
+	steps := []struct {
+		name   string
+		n      int
+		queued bool
+		full   bool
+	}{
+		{"first batch", 3, true, false},
+		{"exceeding the maximum with the first", 3, false, true},
+		{"filling up", 2, true, false},
+		{"exceeding the maximum on its own", 6, false, false},
+		{"while full", 1, false, true},
+	}
+
+	var queued []chan *SensorDataBatchResult
+	var sizes []int
+	for i, step := range steps {
+		done, err := buffer.enqueue(testSensorDataBatch(step.n, measured.Add(-time.Duration(i)*time.Minute)))
+		if (err == ErrWriteBufferFull) != step.full || (done != nil) != step.queued {
+			t.Errorf("%s: got channel %v and error %v, want queued %t and full %t", step.name, done, err, step.queued, step.full)
+		}
+
+		if done != nil {
+			queued = append(queued, done)
+			sizes = append(sizes, step.n)
+		}
+	}
+
+	// The batch size has been reached with the second queued batch
+	select {
+	case <-buffer.flush:
+	default:
+		t.Error("flush has not been signaled")
+	}
+
+	// The maximum applies to requests as well
+	body := fmt.Sprintf(`{"data": [{"controller": "%s", "sensor": "humidity", "value": 40}]}`, testController)
+	w := httptest.NewRecorder()
+	SensorDataHandler(w, httptest.NewRequest(http.MethodPost, "/v1/sensor-data", strings.NewReader(body)))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("got status %d with Retry-After %q, want %d with 2", w.Code, w.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+
+	buffer.commit()
+	for i, done := range queued {
+		if result := <-done; result.Err != nil || len(result.Errs) != sizes[i] {
+			t.Errorf("queued batch %d: got %v and %d results, want %d", i, result.Err, len(result.Errs), sizes[i])
+		}
+	}
+
+	// Committed readings free the buffer
+	if done, err := buffer.enqueue(testSensorDataBatch(5, measured.Add(time.Minute))); err != nil || done == nil {
+		t.Errorf("got channel %v and error %v after commit, want a queued batch", done, err)
+	}
+
+	// Batches that are not queued are up to the caller
+	if count := dbtest.CountRows(t, "SENSOR_DATA"); count != 3+2 {
+		t.Errorf("got %d stored readings, want %d", count, 3+2)
+	}
+}
+
+func TestCommitSensorDataBatchesIsolatesErrors(t *testing.T) {
+	setupTestDatabase(t)
+	measured := time.Now().Add(-time.Hour)
+
+	// Quarantined data that cannot be stored fails its batch, but not the others
+	broken := testSensorDataBatch(2, measured.Add(-time.Minute))
+	broken.Quarantined = []*QuarantinedSensorData{{SensorData: *testSensorData("humidity", 40, measured), Received: "now"}}
+
+	batches := []*SensorDataBatch{
+		testSensorDataBatch(2, measured),
+		broken,
+		testSensorDataBatch(3, measured.Add(-2*time.Minute)),
+	}
+
+	results, err := commitSensorDataBatches(batches)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, result := range results {
+		if failed := result.Err != nil; failed != (i == 1) {
+			t.Errorf("batch %d: got error %v, want failed %t", i, result.Err, i == 1)
+		}
+	}
+
+	if count := dbtest.CountRows(t, "SENSOR_DATA"); count != 5 {
+		t.Errorf("got %d stored readings, want 5", count)
+	}
+
+	if count := dbtest.CountRows(t, "SENSOR_DATA_QUARANTINE"); count != 0 {
+		t.Errorf("got %d quarantined readings, want 0", count)
+	}
+}
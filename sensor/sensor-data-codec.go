@@ -0,0 +1,283 @@
+package sensor
+
+import (
+	"encoding/json"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Media types sensor data can be exchanged in
+const (
+	mediaTypeJson     = "application/json"
+	mediaTypeCbor     = "application/cbor"
+	mediaTypeProtobuf = "application/x-protobuf"
+)
+
+// supportedMediaTypes lists the media types for error messages.
+const supportedMediaTypes = mediaTypeJson + ", " + mediaTypeCbor + ", " + mediaTypeProtobuf
+
+// sensorDataCodec encodes and decodes sensor data in a single media type.
+// CBOR uses the same structure as JSON. Protocol Buffers follow the schema in `sensor-data.proto`.
+type sensorDataCodec struct {
+	decodePost   func(b []byte) (*sensorDataPost, error)
+	encodeSet    func(set *sensorDataSet) ([]byte, error)
+	encodeResult func(result *sensorDataPostResult) ([]byte, error)
+}
+
+// sensorDataCodecs maps all supported media types (including aliases) to their codec.
+var sensorDataCodecs = map[string]*sensorDataCodec{
+	mediaTypeJson: {
+		decodePost:   unmarshalPost(json.Unmarshal),
+		encodeSet:    func(set *sensorDataSet) ([]byte, error) { return json.Marshal(set) },
+		encodeResult: func(result *sensorDataPostResult) ([]byte, error) { return json.Marshal(result) },
+	},
+	mediaTypeCbor: {
+		decodePost:   unmarshalPost(cbor.Unmarshal),
+		encodeSet:    func(set *sensorDataSet) ([]byte, error) { return cbor.Marshal(set) },
+		encodeResult: func(result *sensorDataPostResult) ([]byte, error) { return cbor.Marshal(result) },
+	},
+	mediaTypeProtobuf:      protobufCodec,
+	"application/protobuf": protobufCodec,
+}
+
+var protobufCodec = &sensorDataCodec{
+	decodePost:   unmarshalPostProto,
+	encodeSet:    func(set *sensorDataSet) ([]byte, error) { return marshalSetProto(set), nil },
+	encodeResult: func(result *sensorDataPostResult) ([]byte, error) { return marshalResultProto(result), nil },
+}
+
+// requestMediaType returns the media type of the request body according to the Content-Type header.
+// JSON is assumed if the header is missing.
+func requestMediaType(contentType string) (string, bool) {
+	if contentType == "" {
+		return mediaTypeJson, true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+
+	_, ok := sensorDataCodecs[mediaType]
+	return mediaType, ok
+}
+
+// responseMediaType returns the supported media type the client prefers according to the Accept header.
+// JSON is used if the header is missing or the client accepts anything.
+func responseMediaType(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return mediaTypeJson, true
+	}
+
+	best, bestQuality := "", 0.0
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(entry)
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		if mediaType == "*/*" || mediaType == "application/*" {
+			mediaType = mediaTypeJson
+		}
+
+		// The first of several types with the same quality wins
+		if _, ok := sensorDataCodecs[mediaType]; ok && quality > bestQuality {
+			best, bestQuality = mediaType, quality
+		}
+	}
+
+	return best, best != ""
+}
+
+// unmarshalPost decodes a sensorDataPost with the given unmarshal function of JSON or CBOR.
+func unmarshalPost(unmarshal func(b []byte, v any) error) func(b []byte) (*sensorDataPost, error) {
+	return func(b []byte) (*sensorDataPost, error) {
+		var post sensorDataPost
+		err := unmarshal(b, &post)
+		return &post, err
+	}
+}
+
+// Field numbers of the messages in `sensor-data.proto`
+const (
+	protoSensorDataController = 1
+	protoSensorDataSensor     = 2
+	protoSensorDataValue      = 3
+	protoSensorDataTimestamp  = 4
+
+	protoSetData = 1
+
+	protoResultMode        = 1
+	protoResultSaved       = 2
+	protoResultFailed      = 3
+	protoResultResults     = 4
+	protoResultQuarantined = 5
+	protoResultDuplicates  = 6
+
+	protoItemIndex  = 1
+	protoItemStatus = 2
+	protoItemError  = 3
+)
+
+// unmarshalPostProto decodes a SensorDataSet message. Unknown fields are skipped.
+func unmarshalPostProto(b []byte) (*sensorDataPost, error) {
+	post := &sensorDataPost{Data: make([]*SensorData, 0)}
+
+	err := consumeProtoFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != protoSetData || typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+
+		message, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+
+		data, err := unmarshalSensorDataProto(message)
+		if err != nil {
+			return 0, err
+		}
+
+		post.Data = append(post.Data, data)
+		return n, nil
+	})
+
+	return post, err
+}
+
+// unmarshalSensorDataProto decodes a SensorData message.
+func unmarshalSensorDataProto(b []byte) (*SensorData, error) {
+	data := &SensorData{}
+
+	err := consumeProtoFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == protoSensorDataController && typ == protowire.BytesType:
+			value, n := protowire.ConsumeString(b)
+			data.Controller = value
+			return n, nil
+		case num == protoSensorDataSensor && typ == protowire.BytesType:
+			value, n := protowire.ConsumeString(b)
+			data.Sensor = value
+			return n, nil
+		case num == protoSensorDataValue && typ == protowire.Fixed64Type:
+			value, n := protowire.ConsumeFixed64(b)
+			data.Value = math.Float64frombits(value)
+			return n, nil
+		case num == protoSensorDataTimestamp && typ == protowire.VarintType:
+			value, n := protowire.ConsumeVarint(b)
+			if value != 0 { // Unset, the time of receipt is used
+				data.Timestamp = time.UnixMilli(int64(value)).UTC().Format(timestampLayout)
+			}
+			return n, nil
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+
+	return data, err
+}
+
+// consumeProtoFields calls consume for every field of a message. consume returns the length of the field value
+// or a negative number if it is invalid.
+func consumeProtoFields(b []byte, consume func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n, err := consume(num, typ, b)
+		if err != nil {
+			return err
+		}
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// marshalSetProto encodes a SensorDataSet message.
+func marshalSetProto(set *sensorDataSet) []byte {
+	var b []byte
+	for _, data := range set.SensorData {
+		var message []byte
+		message = appendProtoString(message, protoSensorDataController, data.Controller)
+		message = appendProtoString(message, protoSensorDataSensor, data.Sensor)
+
+		if data.Value != 0 {
+			message = protowire.AppendTag(message, protoSensorDataValue, protowire.Fixed64Type)
+			message = protowire.AppendFixed64(message, math.Float64bits(data.Value))
+		}
+
+		if timestamp, err := time.Parse(time.RFC3339, data.Timestamp); err == nil {
+			message = protowire.AppendTag(message, protoSensorDataTimestamp, protowire.VarintType)
+			message = protowire.AppendVarint(message, uint64(timestamp.UnixMilli()))
+		}
+
+		b = protowire.AppendTag(b, protoSetData, protowire.BytesType)
+		b = protowire.AppendBytes(b, message)
+	}
+
+	return b
+}
+
+// marshalResultProto encodes a SensorDataPostResult message.
+func marshalResultProto(result *sensorDataPostResult) []byte {
+	var b []byte
+	b = appendProtoString(b, protoResultMode, result.Mode)
+	b = appendProtoVarint(b, protoResultSaved, uint64(result.Saved))
+	b = appendProtoVarint(b, protoResultFailed, uint64(result.Failed))
+	b = appendProtoVarint(b, protoResultQuarantined, uint64(result.Quarantined))
+	b = appendProtoVarint(b, protoResultDuplicates, uint64(result.Duplicates))
+
+	for _, item := range result.Results {
+		var message []byte
+		message = appendProtoVarint(message, protoItemIndex, uint64(item.Index))
+		message = appendProtoString(message, protoItemStatus, item.Status)
+		message = appendProtoString(message, protoItemError, item.Error)
+
+		b = protowire.AppendTag(b, protoResultResults, protowire.BytesType)
+		b = protowire.AppendBytes(b, message)
+	}
+
+	return b
+}
+
+// appendProtoString appends a string field, omitting it if it is empty like proto3 does.
+func appendProtoString(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+// appendProtoVarint appends an integer field, omitting it if it is zero like proto3 does.
+func appendProtoVarint(b []byte, num protowire.Number, value uint64) []byte {
+	if value == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
@@ -0,0 +1,231 @@
+package sensor
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// testSensorDataSet is a set covering all fields, including a zero value omitted by Protocol Buffers.
+var testSensorDataSet = &sensorDataSet{SensorData: []*SensorData{
+	{Controller: testController, Sensor: "humidity", Value: 42.5, Timestamp: "2023-05-01T12:00:00.123Z"},
+	{Controller: testController, Sensor: "temperature", Value: -3.25, Timestamp: "2023-05-01T12:00:01.000Z"},
+	{Controller: testInactiveController, Sensor: "soil-moisture", Value: 0, Timestamp: "2023-05-01T12:00:02.500Z"},
+}}
+
+// testSensorDataPostResult is a result covering all fields.
+var testSensorDataPostResult = &sensorDataPostResult{
+	Mode:        bulkModeBestEffort,
+	Saved:       1,
+	Failed:      1,
+	Quarantined: 1,
+	Duplicates:  1,
+	Results: []*sensorDataResult{
+		{Index: 0, Status: sensorDataSaved},
+		{Index: 1, Status: sensorDataFailed, Error: "sensor is missing"},
+		{Index: 2, Status: sensorDataQuarantined, Error: "controller is inactive"},
+		{Index: 3, Status: sensorDataDuplicate},
+	},
+}
+
+func TestSensorDataCodecRoundTrip(t *testing.T) {
+	for mediaType, codec := range sensorDataCodecs {
+		t.Run(mediaType, func(t *testing.T) {
+			b, err := codec.encodeSet(testSensorDataSet)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A set has the same structure as a post, so it can be posted again
+			post, err := codec.decodePost(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(post.Data, testSensorDataSet.SensorData) {
+				t.Errorf("got %+v, want %+v", post.Data, testSensorDataSet.SensorData)
+			}
+
+			b, err = codec.encodeResult(testSensorDataPostResult)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := decodeTestResult(mediaType, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(result, testSensorDataPostResult) {
+				t.Errorf("got %+v, want %+v", result, testSensorDataPostResult)
+			}
+		})
+	}
+}
+
+func TestUnmarshalPostProto(t *testing.T) {
+	var unknown []byte
+	unknown = protowire.AppendTag(unknown, 15, protowire.VarintType)
+	unknown = protowire.AppendVarint(unknown, 1)
+
+	withoutTimestamp := appendProtoString(nil, protoSensorDataController, testController)
+	withoutTimestamp = appendProtoString(withoutTimestamp, protoSensorDataSensor, "humidity")
+	withoutTimestamp = append(withoutTimestamp, unknown...)
+
+	tests := []struct {
+		name string
+		b    []byte
+		want []*SensorData // nil if invalid
+	}{
+		{"empty", nil, []*SensorData{}},
+		{"unknown field", unknown, []*SensorData{}},
+		{"without timestamp", protowire.AppendBytes(protowire.AppendTag(nil, protoSetData, protowire.BytesType), withoutTimestamp),
+			[]*SensorData{{Controller: testController, Sensor: "humidity"}}},
+		{"truncated tag", []byte{0x80}, nil},
+		{"truncated message", protowire.AppendTag(nil, protoSetData, protowire.BytesType), nil},
+		{"truncated value", []byte{protoSetData<<3 | byte(protowire.BytesType), 10, 0x0a}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			post, err := unmarshalPostProto(test.b)
+			if test.want == nil {
+				if err == nil {
+					t.Errorf("got %+v, want error", post.Data)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(post.Data, test.want) {
+				t.Errorf("got %+v, want %+v", post.Data, test.want)
+			}
+		})
+	}
+}
+
+func TestRequestMediaType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string // Empty if unsupported
+	}{
+		{"", mediaTypeJson},
+		{"application/json", mediaTypeJson},
+		{"application/json; charset=utf-8", mediaTypeJson},
+		{"application/cbor", mediaTypeCbor},
+		{"application/x-protobuf", mediaTypeProtobuf},
+		{"application/protobuf", "application/protobuf"},
+		{"text/plain", ""},
+		{"application/", ""},
+	}
+
+	for _, test := range tests {
+		mediaType, ok := requestMediaType(test.contentType)
+		switch {
+		case test.want == "" && ok:
+			t.Errorf("%q: got %s, want unsupported", test.contentType, mediaType)
+		case test.want != "" && (!ok || mediaType != test.want):
+			t.Errorf("%q: got %s (supported %t), want %s", test.contentType, mediaType, ok, test.want)
+		}
+	}
+}
+
+func TestResponseMediaType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string // Empty if not acceptable
+	}{
+		{"", mediaTypeJson},
+		{"*/*", mediaTypeJson},
+		{"application/*", mediaTypeJson},
+		{"application/cbor", mediaTypeCbor},
+		{"application/protobuf", "application/protobuf"},
+		{"text/html, application/x-protobuf", mediaTypeProtobuf},
+		{"application/json;q=0.5, application/cbor", mediaTypeCbor},
+		{"application/cbor;q=0.2, application/x-protobuf;q=0.8, */*;q=0.1", mediaTypeProtobuf},
+		{"application/cbor, application/json", mediaTypeCbor},
+		{"application/cbor;q=abc, application/json;q=0.1", mediaTypeJson},
+		{"text/html", ""},
+		{"application/json;q=0", ""},
+		{"text/*", ""},
+	}
+
+	for _, test := range tests {
+		mediaType, ok := responseMediaType(test.accept)
+		switch {
+		case test.want == "" && ok:
+			t.Errorf("%q: got %s, want not acceptable", test.accept, mediaType)
+		case test.want != "" && (!ok || mediaType != test.want):
+			t.Errorf("%q: got %s (acceptable %t), want %s", test.accept, mediaType, ok, test.want)
+		}
+	}
+}
+
+// decodeTestResult decodes a result encoded in the given media type, as the server only encodes results.
+func decodeTestResult(mediaType string, b []byte) (*sensorDataPostResult, error) {
+	result := &sensorDataPostResult{}
+	switch mediaType {
+	case mediaTypeJson:
+		return result, json.Unmarshal(b, result)
+	case mediaTypeCbor:
+		return result, cbor.Unmarshal(b, result)
+	}
+
+	err := consumeProtoFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case protoResultMode:
+			value, n := protowire.ConsumeString(b)
+			result.Mode = value
+			return n, nil
+		case protoResultSaved:
+			value, n := protowire.ConsumeVarint(b)
+			result.Saved = int(value)
+			return n, nil
+		case protoResultFailed:
+			value, n := protowire.ConsumeVarint(b)
+			result.Failed = int(value)
+			return n, nil
+		case protoResultQuarantined:
+			value, n := protowire.ConsumeVarint(b)
+			result.Quarantined = int(value)
+			return n, nil
+		case protoResultDuplicates:
+			value, n := protowire.ConsumeVarint(b)
+			result.Duplicates = int(value)
+			return n, nil
+		case protoResultResults:
+			message, n := protowire.ConsumeBytes(b)
+			item := &sensorDataResult{}
+			err := consumeProtoFields(message, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+				switch num {
+				case protoItemIndex:
+					value, n := protowire.ConsumeVarint(b)
+					item.Index = int(value)
+					return n, nil
+				case protoItemStatus:
+					value, n := protowire.ConsumeString(b)
+					item.Status = value
+					return n, nil
+				case protoItemError:
+					value, n := protowire.ConsumeString(b)
+					item.Error = value
+					return n, nil
+				default:
+					return protowire.ConsumeFieldValue(num, typ, b), nil
+				}
+			})
+			result.Results = append(result.Results, item)
+			return n, err
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+
+	return result, err
+}
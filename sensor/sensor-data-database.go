@@ -1,16 +1,27 @@
 // Author: Yannick Kirschen
 package sensor
 
+import "errors"
+
+// ErrDuplicateSensorData is returned for a data set that has been ignored, as there already is one of the same
+// controller, sensor and timestamp.
+var ErrDuplicateSensorData = errors.New("sensor data of the same controller, sensor and timestamp already exists")
+
+// Ways of handling a data set of the same controller, sensor and timestamp as a stored one (see `sensorData.onConflict`)
+const (
+	conflictIgnore    = "ignore"    // Keep the stored data set
+	conflictOverwrite = "overwrite" // Replace the value of the stored data set
+)
+
 // SensorDataRepository provides access to sensor data.
 type SensorDataRepository interface {
 	// GetAll returns all sensor data matching the given filter.
 	GetAll(filter *SensorDataFilter) ([]*SensorData, error)
 
-	// Save stores the given sensor data.
-	// Note: This is done using a transaction.
-	Save(data *SensorData) error
-
-	// SaveAll stores the given sensor data slice.
-	// Note: Each data set is written in its own transaction.
-	SaveAll(data []*SensorData) []error
+	// SaveAll stores the given batches of sensor data and quarantined sensor data in a single transaction, so the
+	// batches of concurrent requests can be committed together. It returns the result of each batch in the order of
+	// the given batches. Nothing of an atomic batch is stored if any of its data sets fails, duplicates don't count
+	// as failed. Nothing of a batch is stored if an error keeps it from being stored, which only that batch reports.
+	// Quarantined data is never stored partially.
+	SaveAll(batches []*SensorDataBatch, onConflict string) ([]*SensorDataBatchResult, error)
 }
@@ -2,31 +2,53 @@
 package sensor
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"math"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
+	"github.com/plantineers/plantbuddy-server/auth"
+	"github.com/plantineers/plantbuddy-server/config"
 	"github.com/plantineers/plantbuddy-server/db"
 	"github.com/plantineers/plantbuddy-server/utils"
 )
 
+// Modes of storing a batch of sensor data
+const (
+	bulkModeAtomic     = "atomic"      // All data sets or none are stored
+	bulkModeBestEffort = "best-effort" // All valid data sets are stored
+)
+
+// Statuses of a single data set of a batch
+const (
+	sensorDataSaved       = "saved"
+	sensorDataFailed      = "failed"
+	sensorDataSkipped     = "skipped"     // Valid, but not stored as another data set failed in atomic mode
+	sensorDataQuarantined = "quarantined" // Failed the referential validation, stored for review by admins
+	sensorDataDuplicate   = "duplicate"   // Ignored, as the same controller, sensor and timestamp is already stored
+)
+
 // SensorDataHandler handles requests to the sensor-data endpoint.
 func SensorDataHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		handleSensorDataGet(w, r)
 	case http.MethodPost:
-		handleSensorDataPost(w, r)
+		withIdempotencyKey(w, r, handleSensorDataPost)
 	}
 }
 
 // handleSensorDataGet handles GET requests to the sensor-data endpoint.
+// The sensor data is returned in the media type the client accepts (JSON, CBOR or Protocol Buffers).
 func handleSensorDataGet(w http.ResponseWriter, r *http.Request) {
+	codec, mediaType, ok := negotiateResponse(w, r)
+	if !ok {
+		return
+	}
+
 	filter, err := filterSensorData(r)
 	if err != nil {
 		msg := fmt.Sprintf("Error parsing sensor data filter: %s", err.Error())
@@ -41,48 +63,140 @@ func handleSensorDataGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	b, err := json.Marshal(&sensorDataSet{SensorData: allSensorData})
+	b, err := codec.encodeSet(&sensorDataSet{SensorData: allSensorData})
 	if err != nil {
-		msg := fmt.Sprintf("Error converting all sensor data to JSON: %s", err.Error())
+		msg := fmt.Sprintf("Error converting all sensor data to %s: %s", mediaType, err.Error())
 		utils.HttpInternalServerErrorResponse(w, msg)
 		return
 	}
 
-	utils.HttpOkResponse(w, b)
+	msg := fmt.Sprintf("Loaded %d sensor data sets as %s", len(allSensorData), mediaType)
+	utils.HttpContentResponse(w, http.StatusOK, mediaType, b, msg)
 }
 
 // handleSensorDataPost handles POST requests to the sensor-data endpoint.
+// The body may be sent as JSON, CBOR or Protocol Buffers, the result is returned in the media type the client accepts.
 func handleSensorDataPost(w http.ResponseWriter, r *http.Request) {
-	var data sensorDataPost
+	codec, mediaType, ok := negotiateResponse(w, r)
+	if !ok {
+		return
+	}
+
+	requestType, ok := requestMediaType(r.Header.Get("Content-Type"))
+	if !ok {
+		msg := fmt.Sprintf("Unsupported content type %s (supported: %s)", r.Header.Get("Content-Type"), supportedMediaTypes)
+		utils.HttpUnsupportedMediaTypeResponse(w, msg)
+		return
+	}
+
+	maxBodySize := config.PlantBuddyConfig.SensorData.MaxBodySize
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if bodyTooLarge(err) == ErrBodyTooLarge {
+		msg := fmt.Sprintf("Error reading sensor data: %s (max. %d bytes)", ErrBodyTooLarge.Error(), maxBodySize)
+		utils.HttpRequestEntityTooLargeResponse(w, msg)
+		return
+	} else if err != nil {
+		msg := fmt.Sprintf("Error reading sensor data: %s", err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
 
-	err := json.NewDecoder(r.Body).Decode(&data)
+	data, err := sensorDataCodecs[requestType].decodePost(body)
 	if err != nil {
 		msg := fmt.Sprintf("Error parsing sensor data: %s", err.Error())
-		utils.HttpInternalServerErrorResponse(w, msg)
+		utils.HttpBadRequestResponse(w, msg)
 		return
 	}
 
-	errs := saveSensorData(data.Data)
-	switch errs {
-	case nil:
-		b, err := json.Marshal(data)
-		if err != nil {
-			msg := fmt.Sprintf("Error converting sensor data to JSON: %s", err.Error())
-			utils.HttpInternalServerErrorResponse(w, msg)
-			return
-		}
+	// Controllers may only submit data on their own behalf
+	if uuid, ok := auth.ControllerFromContext(r.Context()); ok {
+		for _, d := range data.Data {
+			if d == nil {
+				continue
+			}
 
-		log.Printf("Saved %d sensor data sets", len(data.Data))
-		utils.HttpOkResponse(w, b)
-	default:
-		var errStrings []string
-		for _, err := range errs {
-			errStrings = append(errStrings, err.Error())
+			if d.Controller == "" {
+				d.Controller = uuid
+			}
+
+			if d.Controller != uuid {
+				msg := fmt.Sprintf("Controller %s must not submit sensor data of controller %s", uuid, d.Controller)
+				utils.HttpForbiddenResponse(w, msg)
+				return
+			}
 		}
+	}
 
-		msg := fmt.Sprintf("Error saving sensor data: %s", strings.Join(errStrings, "; "))
+	mode, err := requestBulkMode(r)
+	if err != nil {
+		msg := fmt.Sprintf("Error parsing sensor data mode: %s", err.Error())
 		utils.HttpBadRequestResponse(w, msg)
+		return
 	}
+
+	result, err := saveSensorData(data.Data, mode, "")
+	if err == ErrWriteBufferFull {
+		msg := fmt.Sprintf("Error saving sensor data: %s", err.Error())
+		utils.HttpServiceUnavailableResponse(w, msg, config.PlantBuddyConfig.SensorData.WriteBuffer.FlushInterval.Duration)
+		return
+	} else if err != nil {
+		msg := fmt.Sprintf("Error saving sensor data: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	b, err := codec.encodeResult(result)
+	if err != nil {
+		msg := fmt.Sprintf("Error converting sensor data result to %s: %s", mediaType, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	msg := fmt.Sprintf("Saved %d of %d sensor data sets (%s), %d quarantined", result.Saved, len(data.Data), mode, result.Quarantined)
+	utils.HttpContentResponse(w, result.status(), mediaType, b, msg)
+}
+
+// status returns the HTTP status of a batch: 200 if all data sets have been saved (or already were), 400 if none has
+// been saved or quarantined, otherwise 207.
+func (r *sensorDataPostResult) status() int {
+	switch {
+	case r.Failed == 0 && r.Quarantined == 0:
+		return http.StatusOK
+	case r.Saved == 0 && r.Duplicates == 0 && r.Quarantined == 0:
+		return http.StatusBadRequest
+	default:
+		return http.StatusMultiStatus
+	}
+}
+
+// requestBulkMode returns the mode of storing a batch given by the query parameter `mode`
+// or configured as `sensorData.bulkMode`.
+func requestBulkMode(r *http.Request) (string, error) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = config.PlantBuddyConfig.SensorData.BulkMode
+	}
+
+	if mode != bulkModeAtomic && mode != bulkModeBestEffort {
+		return "", fmt.Errorf("invalid mode %s (allowed: %s, %s)", mode, bulkModeAtomic, bulkModeBestEffort)
+	}
+
+	return mode, nil
+}
+
+// negotiateResponse returns the codec of the media type the client accepts.
+// If none of the supported media types is acceptable, it responds with 406 Not Acceptable and returns false.
+func negotiateResponse(w http.ResponseWriter, r *http.Request) (*sensorDataCodec, string, bool) {
+	w.Header().Add("Vary", "Accept")
+
+	mediaType, ok := responseMediaType(r.Header.Get("Accept"))
+	if !ok {
+		msg := fmt.Sprintf("None of the accepted media types %s is supported (supported: %s)", r.Header.Get("Accept"), supportedMediaTypes)
+		utils.HttpNotAcceptableResponse(w, msg)
+		return nil, "", false
+	}
+
+	return sensorDataCodecs[mediaType], mediaType, true
 }
 
 // filterSensorData parses the query parameters of a request and returns a SensorDataFilter.
@@ -117,14 +231,15 @@ func filterSensorData(r *http.Request) (*SensorDataFilter, error) {
 		return nil, errors.New("plant ID and plantGroup ID cannot be set at the same time")
 	}
 
-	from := r.URL.Query().Get("from")
-	to := r.URL.Query().Get("to")
-
-	if from == "" {
-		from = time.Now().AddDate(0, 0, -1).Format(time.RFC3339)
+	now := time.Now()
+	from, err := parseFilterTime(r.URL.Query().Get("from"), now.AddDate(0, 0, -1))
+	if err != nil {
+		return nil, fmt.Errorf("from %s", err.Error())
 	}
-	if to == "" {
-		to = time.Now().Format(time.RFC3339)
+
+	to, err := parseFilterTime(r.URL.Query().Get("to"), now)
+	if err != nil {
+		return nil, fmt.Errorf("to %s", err.Error())
 	}
 
 	return &SensorDataFilter{
@@ -133,9 +248,30 @@ func filterSensorData(r *http.Request) (*SensorDataFilter, error) {
 		PlantGroup: plantGroup,
 		From:       from,
 		To:         to,
+		UserId:     auth.RestrictingUserId(r.Context()),
 	}, nil
 }
 
+// parseFilterTime parses a time of the sensor data filter, which is either an RFC 3339 timestamp or a date (in UTC).
+// If the value is empty, the fallback is returned.
+func parseFilterTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.Parse(time.DateOnly, value)
+	if err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, errors.New("must be an RFC 3339 timestamp or a date")
+}
+
 // getAllSensorData returns all sensor data matching the given filter.
 func getAllSensorData(filter *SensorDataFilter) ([]*SensorData, error) {
 	var session = db.NewSession()
@@ -154,25 +290,146 @@ func getAllSensorData(filter *SensorDataFilter) ([]*SensorData, error) {
 	return repository.GetAll(filter)
 }
 
-// saveSensorData saves the given sensor data.
-func saveSensorData(data []*SensorData) []error {
-	var session = db.NewSession()
-	defer session.Close()
+// saveSensorData saves the given sensor data in a single transaction and returns the result of each data set.
+// In atomic mode, nothing is saved if any data set is invalid or cannot be stored. Data sets that fail the
+// referential validation are quarantined instead if `sensorData.invalidReadings` is set to quarantine.
+// If the write buffer is enabled, the transaction is shared with concurrent requests and ErrWriteBufferFull
+// is returned if the buffer is full. If controller is set, the batch has been submitted by that controller,
+// so data sets of other controllers fail.
+func saveSensorData(data []*SensorData, mode string, controller string) (*sensorDataPostResult, error) {
+	atomic := mode == bulkModeAtomic
+	quarantine := config.PlantBuddyConfig.SensorData.InvalidReadings == invalidReadingsQuarantine
+	result := &sensorDataPostResult{Mode: mode, Results: make([]*sensorDataResult, len(data))}
 
-	errors := make([]error, 0)
-	err := session.Open()
+	references, err := getSensorDataReferences(data)
 	if err != nil {
-		return append(errors, err)
+		return nil, err
 	}
 
-	repository, err := NewSensorDataRepository(session)
+	now := time.Now()
+	received := now.UTC().Format(timestampLayout)
+
+	var valid []*SensorData
+	var validIndices []int
+	var quarantined []*QuarantinedSensorData
+	var quarantinedIndices []int
+	for i, d := range data {
+		result.Results[i] = &sensorDataResult{Index: i}
+
+		err := validateSensorData(d, now)
+		if err == nil && controller != "" && d.Controller != controller {
+			err = fmt.Errorf("controller %s must not submit sensor data of controller %s", controller, d.Controller)
+		}
+
+		if err == nil {
+			err = references.validate(d)
+			if err != nil && quarantine {
+				quarantined = append(quarantined, &QuarantinedSensorData{SensorData: *d, Reason: err.Error(), Received: received})
+				quarantinedIndices = append(quarantinedIndices, i)
+				result.Results[i].Error = err.Error()
+				continue
+			}
+		}
+
+		if err != nil {
+			result.Results[i].Status = sensorDataFailed
+			result.Results[i].Error = err.Error()
+			result.Failed++
+			continue
+		}
+
+		valid = append(valid, d)
+		validIndices = append(validIndices, i)
+	}
+
+	if atomic && result.Failed > 0 {
+		for _, i := range append(validIndices, quarantinedIndices...) {
+			result.Results[i].Status = sensorDataSkipped
+		}
+
+		return result, nil
+	}
+
+	errs, err := storeSensorDataBatch(&SensorDataBatch{Data: valid, Quarantined: quarantined, Atomic: atomic})
 	if err != nil {
-		return append(errors, err)
+		return nil, err
+	}
+
+	failed := false
+	for _, err := range errs {
+		failed = failed || (err != nil && err != ErrDuplicateSensorData)
+	}
+
+	for j, i := range validIndices {
+		switch {
+		case errs[j] != nil && errs[j] != ErrDuplicateSensorData:
+			result.Results[i].Status = sensorDataFailed
+			result.Results[i].Error = errs[j].Error()
+			result.Failed++
+		case atomic && failed: // Either rolled back or never tried
+			result.Results[i].Status = sensorDataSkipped
+		case errs[j] == ErrDuplicateSensorData:
+			result.Results[i].Status = sensorDataDuplicate
+			result.Duplicates++
+		default:
+			result.Results[i].Status = sensorDataSaved
+			result.Saved++
+		}
+	}
+
+	for _, i := range quarantinedIndices {
+		if atomic && failed {
+			result.Results[i].Status = sensorDataSkipped
+		} else {
+			result.Results[i].Status = sensorDataQuarantined
+			result.Quarantined++
+		}
+	}
+
+	return result, nil
+}
+
+// validateSensorData returns an error if a data set is incomplete or its timestamp is out of range.
+// Controllers send the time a value has been measured if they have buffered it, otherwise it is set to now.
+// The timestamp is normalized to the format it is stored in.
+func validateSensorData(data *SensorData, now time.Time) error {
+	if data == nil {
+		return errors.New("data set must not be null")
+	}
+
+	if data.Controller == "" {
+		return errors.New("controller must be set")
+	}
+
+	if data.Sensor == "" {
+		return errors.New("sensor must be set")
+	}
+
+	// CBOR and Protocol Buffers can encode them, unlike JSON
+	if math.IsNaN(data.Value) || math.IsInf(data.Value, 0) {
+		return errors.New("value must be a finite number")
+	}
+
+	if data.Timestamp == "" {
+		data.Timestamp = now.UTC().Format(timestampLayout)
+		return nil
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, data.Timestamp)
+	if err != nil {
+		return fmt.Errorf("timestamp %s must be in RFC 3339 format", data.Timestamp)
+	}
+
+	maxClockSkew := config.PlantBuddyConfig.SensorData.MaxClockSkew.Duration
+	if timestamp.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("timestamp %s is more than %s in the future", data.Timestamp, maxClockSkew)
 	}
 
-	for _, d := range data {
-		d.Timestamp = time.Now().UTC().String()
+	maxAge := config.PlantBuddyConfig.SensorData.MaxAge.Duration
+	if timestamp.Before(now.Add(-maxAge)) {
+		return fmt.Errorf("timestamp %s is more than %s in the past", data.Timestamp, maxAge)
 	}
 
-	return repository.SaveAll(data)
+	data.Timestamp = timestamp.UTC().Format(timestampLayout)
+	return nil
 }
@@ -0,0 +1,219 @@
+package sensor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+)
+
+// Controllers of the test database
+const (
+	testController         = "11111111-1111-1111-1111-111111111111"
+	testInactiveController = "22222222-2222-2222-2222-222222222222"
+)
+
+// setupTestDatabase migrates a copy of `buddy-default.sqlite`, adds an active and an inactive controller and uses it
+// for the test along with the default configuration of sensor data.
+func setupTestDatabase(t *testing.T) {
+	t.Helper()
+
+	dbtest.Setup(t)
+	config.PlantBuddyConfig.SensorData = config.SensorData{
+		BulkMode:        bulkModeAtomic,
+		MaxClockSkew:    config.Duration{Duration: 5 * time.Minute},
+		MaxAge:          config.Duration{Duration: 7 * 24 * time.Hour},
+		InvalidReadings: invalidReadingsReject,
+		OnConflict:      conflictIgnore,
+		MaxBodySize:     10 << 20,
+	}
+
+	dbtest.Exec(t, `
+    INSERT INTO CONTROLLER (UUID, PLANT_GROUP, ACTIVE)
+    VALUES (?, 1, 1),
+           (?, 1, 0);`, testController, testInactiveController)
+}
+
+// testSensorData returns a data set of the test controller measured at the given time.
+func testSensorData(sensor string, value float64, measured time.Time) *SensorData {
+	return &SensorData{
+		Controller: testController,
+		Sensor:     sensor,
+		Value:      value,
+		Timestamp:  measured.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func TestSaveSensorData(t *testing.T) {
+	measured := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name     string
+		mode     string
+		data     []*SensorData
+		statuses []string
+		saved    int // Rows stored in SENSOR_DATA
+		status   int
+	}{
+		{
+			name: "atomic",
+			mode: bulkModeAtomic,
+			data: []*SensorData{
+				testSensorData("humidity", 40, measured),
+				testSensorData("temperature", 20, measured),
+			},
+			statuses: []string{sensorDataSaved, sensorDataSaved},
+			saved:    2,
+			status:   http.StatusOK,
+		},
+		{
+			name: "atomic with invalid data set",
+			mode: bulkModeAtomic,
+			data: []*SensorData{
+				testSensorData("humidity", 40, measured),
+				testSensorData("", 20, measured),
+				testSensorData("temperature", 20, measured),
+			},
+			statuses: []string{sensorDataSkipped, sensorDataFailed, sensorDataSkipped},
+			saved:    0,
+			status:   http.StatusBadRequest,
+		},
+		{
+			name: "best-effort with invalid data set",
+			mode: bulkModeBestEffort,
+			data: []*SensorData{
+				testSensorData("humidity", 40, measured),
+				testSensorData("", 20, measured),
+				testSensorData("temperature", 20, measured),
+			},
+			statuses: []string{sensorDataSaved, sensorDataFailed, sensorDataSaved},
+			saved:    2,
+			status:   http.StatusMultiStatus,
+		},
+		{
+			name: "best-effort without valid data set",
+			mode: bulkModeBestEffort,
+			data: []*SensorData{
+				nil,
+				{Sensor: "humidity", Value: 40},
+			},
+			statuses: []string{sensorDataFailed, sensorDataFailed},
+			saved:    0,
+			status:   http.StatusBadRequest,
+		},
+		{
+			name: "atomic with duplicate",
+			mode: bulkModeAtomic,
+			data: []*SensorData{
+				testSensorData("humidity", 40, measured),
+				testSensorData("humidity", 40, measured),
+			},
+			statuses: []string{sensorDataSaved, sensorDataDuplicate},
+			saved:    1,
+			status:   http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupTestDatabase(t)
+
+			result, err := saveSensorData(test.data, test.mode, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, status := range test.statuses {
+				if result.Results[i].Status != status {
+					t.Errorf("data set %d: got status %s (%s), want %s", i, result.Results[i].Status, result.Results[i].Error, status)
+				}
+			}
+
+			if saved := dbtest.CountRows(t, "SENSOR_DATA"); saved != test.saved {
+				t.Errorf("got %d stored data sets, want %d", saved, test.saved)
+			}
+
+			if status := result.status(); status != test.status {
+				t.Errorf("got HTTP status %d, want %d", status, test.status)
+			}
+		})
+	}
+}
+
+func TestValidateSensorDataTimestamp(t *testing.T) {
+	setupTestDatabase(t)
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		want      string // Normalized timestamp, empty if invalid
+	}{
+		{"missing", "", "2023-05-01T12:00:00.000Z"},
+		{"UTC", "2023-05-01T11:30:00Z", "2023-05-01T11:30:00.000Z"},
+		{"offset", "2023-05-01T13:30:00+02:00", "2023-05-01T11:30:00.000Z"},
+		{"milliseconds", "2023-05-01T11:30:00.123Z", "2023-05-01T11:30:00.123Z"},
+		{"nanoseconds truncated", "2023-05-01T11:30:00.123456789Z", "2023-05-01T11:30:00.123Z"},
+		{"within clock skew", "2023-05-01T12:04:59Z", "2023-05-01T12:04:59.000Z"},
+		{"beyond clock skew", "2023-05-01T12:05:01Z", ""},
+		{"within max age", "2023-04-24T12:00:01Z", "2023-04-24T12:00:01.000Z"},
+		{"beyond max age", "2023-04-24T11:59:59Z", ""},
+		{"without zone", "2023-05-01T11:30:00", ""},
+		{"date only", "2023-05-01", ""},
+		{"unix seconds", "1682942400", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := &SensorData{Controller: testController, Sensor: "humidity", Value: 40, Timestamp: test.timestamp}
+			err := validateSensorData(data, now)
+
+			switch {
+			case test.want == "" && err == nil:
+				t.Errorf("timestamp %s has been accepted as %s", test.timestamp, data.Timestamp)
+			case test.want != "" && err != nil:
+				t.Errorf("timestamp %s has been rejected: %s", test.timestamp, err.Error())
+			case test.want != "" && data.Timestamp != test.want:
+				t.Errorf("got timestamp %s, want %s", data.Timestamp, test.want)
+			}
+		})
+	}
+}
+
+func TestSensorDataPostBodySize(t *testing.T) {
+	setupTestDatabase(t)
+	body := `{"data": [{"controller": "` + testController + `", "sensor": "humidity", "value": 40}]}`
+	config.PlantBuddyConfig.SensorData.MaxBodySize = int64(len(body))
+
+	tests := []struct {
+		name   string
+		body   string
+		key    string // Idempotency key, none if empty
+		status int
+	}{
+		{"within limit", body, "", http.StatusOK},
+		{"too large", body + " ", "", http.StatusRequestEntityTooLarge},
+		{"too large with idempotency key", body + " ", "key", http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/sensor-data", strings.NewReader(test.body))
+			r.Header.Set("Content-Type", mediaTypeJson)
+			if test.key != "" {
+				r.Header.Set(headerIdempotencyKey, test.key)
+			}
+
+			w := httptest.NewRecorder()
+			SensorDataHandler(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("got status %d (%s), want %d", w.Code, w.Body.String(), test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package sensor
+
+import "time"
+
+// IdempotencyKeyRepository provides access to the responses of requests with an `Idempotency-Key` header.
+type IdempotencyKeyRepository interface {
+	// Reserve stores a new key whose request is being processed.
+	// It returns false if the principal has already used the key, unless the same request has been reserved before
+	// staleBefore and never completed. Then, the reservation is taken over.
+	Reserve(key *IdempotencyKey, staleBefore time.Time) (bool, error)
+
+	// Get returns the key of the given principal.
+	Get(principal string, key string) (*IdempotencyKey, error)
+
+	// Complete stores the response to the request of a reserved key.
+	// Nothing is stored if the reservation has been taken over in the meantime.
+	Complete(key *IdempotencyKey) error
+
+	// Delete deletes the reserved key, so the request can be retried.
+	// Nothing is deleted if the reservation has been taken over in the meantime.
+	Delete(key *IdempotencyKey) error
+
+	// DeleteExpired deletes all keys created before the given time.
+	DeleteExpired(before time.Time) error
+}
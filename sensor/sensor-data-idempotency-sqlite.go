@@ -0,0 +1,89 @@
+package sensor
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// IdempotencyKeySqliteRepository implements the IdempotencyKeyRepository interface.
+// It uses a SQLite database as data source.
+type IdempotencyKeySqliteRepository struct {
+	db *sql.DB
+}
+
+// NewIdempotencyKeyRepository creates a new repository for idempotency keys.
+// It will use the configured driver and data source from `buddy.json`
+func NewIdempotencyKeyRepository(session *db.Session) (IdempotencyKeyRepository, error) {
+	if !session.IsOpen() {
+		return nil, errors.New("session is not open")
+	}
+
+	return &IdempotencyKeySqliteRepository{db: session.DB}, nil
+}
+
+func (r *IdempotencyKeySqliteRepository) Reserve(key *IdempotencyKey, staleBefore time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+    INSERT INTO IDEMPOTENCY_KEY (PRINCIPAL, KEY, REQUEST_HASH, RESERVED, CREATED)
+        VALUES (?, ?, ?, ?, ?)
+        ON CONFLICT (PRINCIPAL, KEY) DO UPDATE
+            SET RESERVED = excluded.RESERVED
+            WHERE IDEMPOTENCY_KEY.STATUS IS NULL
+              AND IDEMPOTENCY_KEY.REQUEST_HASH = excluded.REQUEST_HASH
+              AND IDEMPOTENCY_KEY.RESERVED < ?;`,
+		key.Principal, key.Key, key.RequestHash, key.Reserved.UnixMilli(), key.Created.UnixMilli(), staleBefore.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (r *IdempotencyKeySqliteRepository) Get(principal string, key string) (*IdempotencyKey, error) {
+	var k IdempotencyKey
+	var status sql.NullInt64
+	var contentType sql.NullString
+	var reserved, created int64
+
+	err := r.db.QueryRow(`
+    SELECT IK.PRINCIPAL, IK.KEY, IK.REQUEST_HASH, IK.STATUS, IK.CONTENT_TYPE, IK.BODY, IK.RESERVED, IK.CREATED
+        FROM IDEMPOTENCY_KEY IK
+        WHERE IK.PRINCIPAL = ? AND IK.KEY = ?;`, principal, key).
+		Scan(&k.Principal, &k.Key, &k.RequestHash, &status, &contentType, &k.Body, &reserved, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	k.Status = int(status.Int64)
+	k.ContentType = contentType.String
+	k.Reserved = time.UnixMilli(reserved)
+	k.Created = time.UnixMilli(created)
+	return &k, nil
+}
+
+func (r *IdempotencyKeySqliteRepository) Complete(key *IdempotencyKey) error {
+	_, err := r.db.Exec(`
+    UPDATE IDEMPOTENCY_KEY
+        SET STATUS = ?, CONTENT_TYPE = ?, BODY = ?
+        WHERE PRINCIPAL = ? AND KEY = ? AND RESERVED = ?;`,
+		key.Status, key.ContentType, key.Body, key.Principal, key.Key, key.Reserved.UnixMilli())
+
+	return err
+}
+
+func (r *IdempotencyKeySqliteRepository) Delete(key *IdempotencyKey) error {
+	_, err := r.db.Exec(`
+    DELETE FROM IDEMPOTENCY_KEY
+        WHERE PRINCIPAL = ? AND KEY = ? AND RESERVED = ?;`,
+		key.Principal, key.Key, key.Reserved.UnixMilli())
+
+	return err
+}
+
+func (r *IdempotencyKeySqliteRepository) DeleteExpired(before time.Time) error {
+	_, err := r.db.Exec(`DELETE FROM IDEMPOTENCY_KEY WHERE CREATED < ?;`, before.UnixMilli())
+	return err
+}
@@ -0,0 +1,223 @@
+package sensor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/auth"
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// Headers of idempotent requests
+const (
+	headerIdempotencyKey     = "Idempotency-Key"     // Sent by clients to make retries of a request safe
+	headerIdempotentReplayed = "Idempotent-Replayed" // Set on responses that have been replayed
+)
+
+// maxIdempotencyKeyLength is the maximum length of an idempotency key.
+const maxIdempotencyKeyLength = 255
+
+// idempotencyRetryAfter is how long clients should wait before retrying a request whose key is in use.
+const idempotencyRetryAfter = time.Second
+
+// idempotencyStaleAfter is how long a request may be processed before a retry takes over its key. Requests whose
+// processing has been aborted (e.g. by a restart of the server) never release their key.
+const idempotencyStaleAfter = time.Minute
+
+// withIdempotencyKey passes the first request with an `Idempotency-Key` header to the handler and stores its response.
+// Retries with the same key get the stored response again without being processed. Requests without the header are
+// passed through. Keys are unique per user or controller and expire after `sensorData.idempotencyKeyLifetime`.
+// The response is only sent once it has been stored, so a client never misses the response it would get on retry.
+func withIdempotencyKey(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) {
+	key := r.Header.Get(headerIdempotencyKey)
+	if key == "" {
+		handler(w, r)
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		msg := fmt.Sprintf("Idempotency key must not be longer than %d characters", maxIdempotencyKeyLength)
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	maxBodySize := config.PlantBuddyConfig.SensorData.MaxBodySize
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if bodyTooLarge(err) == ErrBodyTooLarge {
+		msg := fmt.Sprintf("Error reading request: %s (max. %d bytes)", ErrBodyTooLarge.Error(), maxBodySize)
+		utils.HttpRequestEntityTooLargeResponse(w, msg)
+		return
+	} else if err != nil {
+		msg := fmt.Sprintf("Error reading request: %s", err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	now := time.Now()
+	idempotencyKey := &IdempotencyKey{
+		Principal:   requestPrincipal(r),
+		Key:         key,
+		RequestHash: hashRequest(r, body),
+		Reserved:    now,
+		Created:     now,
+	}
+
+	stored, err := reserveIdempotencyKey(idempotencyKey)
+	switch {
+	case err == sql.ErrNoRows: // The first request failed with a server error in the meantime
+		w.Header().Set("Retry-After", strconv.Itoa(int(idempotencyRetryAfter.Seconds())))
+		msg := fmt.Sprintf("Request with idempotency key %s has just been released, retry it", key)
+		utils.HttpConflictResponse(w, msg)
+		return
+	case err != nil:
+		msg := fmt.Sprintf("Error reserving idempotency key %s: %s", key, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	case stored == nil: // First request with this key, or the first one has been aborted
+	case stored.RequestHash != idempotencyKey.RequestHash:
+		msg := fmt.Sprintf("Idempotency key %s has already been used for another request", key)
+		utils.HttpUnprocessableEntityResponse(w, msg)
+		return
+	case stored.Status == 0:
+		w.Header().Set("Retry-After", strconv.Itoa(int(idempotencyRetryAfter.Seconds())))
+		msg := fmt.Sprintf("Request with idempotency key %s is still being processed", key)
+		utils.HttpConflictResponse(w, msg)
+		return
+	default:
+		w.Header().Set(headerIdempotentReplayed, "true")
+		msg := fmt.Sprintf("Replayed response to request with idempotency key %s of %s", key, idempotencyKey.Principal)
+		utils.HttpContentResponse(w, stored.Status, stored.ContentType, stored.Body, msg)
+		return
+	}
+
+	recorder := &idempotencyRecorder{header: make(http.Header), status: http.StatusOK}
+	handler(recorder, r)
+
+	idempotencyKey.Status = recorder.status
+	idempotencyKey.ContentType = recorder.header.Get("Content-Type")
+	idempotencyKey.Body = recorder.body.Bytes()
+
+	// Errors on the server may be gone on retry, so the request must be processed again
+	err = completeIdempotencyKey(idempotencyKey, recorder.status < http.StatusInternalServerError)
+	if err != nil {
+		msg := fmt.Sprintf("Error storing response to idempotency key %s: %s", key, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	for name, values := range recorder.header {
+		w.Header()[name] = values
+	}
+
+	w.WriteHeader(recorder.status)
+	w.Write(idempotencyKey.Body)
+}
+
+// idempotencyRecorder keeps a response to store it along with the idempotency key before it is sent.
+type idempotencyRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *idempotencyRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+// requestPrincipal returns who sent the request, as authenticated by the middleware.
+func requestPrincipal(r *http.Request) string {
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		return fmt.Sprintf("user:%d", user.Id)
+	}
+
+	if uuid, ok := auth.ControllerFromContext(r.Context()); ok {
+		return fmt.Sprintf("controller:%s", uuid)
+	}
+
+	return "anonymous"
+}
+
+// hashRequest returns the SHA-256 hash of everything that affects the result of a request, including the media type
+// of the response, so a response is never replayed in another media type than the one negotiated.
+func hashRequest(r *http.Request, body []byte) string {
+	accept, ok := responseMediaType(r.Header.Get("Accept"))
+	if !ok {
+		accept = r.Header.Get("Accept")
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n", r.Method, r.URL.RequestURI(), r.Header.Get("Content-Type"), accept)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// reserveIdempotencyKey stores a new key, deleting expired ones before. If the key has already been used,
+// it returns the stored one instead, or sql.ErrNoRows if it has been deleted since. A key whose request has been
+// processed for longer than idempotencyStaleAfter is taken over by a retry of the same request.
+func reserveIdempotencyKey(key *IdempotencyKey) (*IdempotencyKey, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := NewIdempotencyKeyRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repository.DeleteExpired(key.Created.Add(-config.PlantBuddyConfig.SensorData.IdempotencyKeyLifetime.Duration))
+	if err != nil {
+		return nil, err
+	}
+
+	reserved, err := repository.Reserve(key, key.Reserved.Add(-idempotencyStaleAfter))
+	if err != nil || reserved {
+		return nil, err
+	}
+
+	return repository.Get(key.Principal, key.Key)
+}
+
+// completeIdempotencyKey stores the response to the request of a reserved key.
+// If keep is false, the key is deleted instead, so the request can be retried.
+func completeIdempotencyKey(key *IdempotencyKey, keep bool) error {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return err
+	}
+
+	repository, err := NewIdempotencyKeyRepository(session)
+	if err != nil {
+		return err
+	}
+
+	if !keep {
+		return repository.Delete(key)
+	}
+
+	return repository.Complete(key)
+}
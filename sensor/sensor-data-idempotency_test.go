@@ -0,0 +1,213 @@
+package sensor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+)
+
+// newTestIdempotentRequest returns a request posting the given body with an idempotency key.
+func newTestIdempotentRequest(key string, accept string, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/v1/sensor-data", strings.NewReader(body))
+	r.Header.Set("Content-Type", mediaTypeJson)
+	r.Header.Set(headerIdempotencyKey, key)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+
+	return r
+}
+
+func TestHashRequest(t *testing.T) {
+	hash := func(accept string, body string) string {
+		r := newTestIdempotentRequest("key", accept, body)
+		return hashRequest(r, []byte(body))
+	}
+
+	tests := []struct {
+		name  string
+		a     string
+		b     string
+		equal bool
+	}{
+		{"same request", hash("", "{}"), hash("", "{}"), true},
+		{"same negotiated media type", hash("", "{}"), hash("*/*", "{}"), true},
+		{"same negotiated media type with quality", hash(mediaTypeCbor, "{}"), hash("application/json;q=0.5, application/cbor", "{}"), true},
+		{"other negotiated media type", hash(mediaTypeJson, "{}"), hash(mediaTypeCbor, "{}"), false},
+		{"other unsupported media type", hash("text/html", "{}"), hash("text/plain", "{}"), false},
+		{"other body", hash("", "{}"), hash("", `{"data": []}`), false},
+	}
+
+	for _, test := range tests {
+		if (test.a == test.b) != test.equal {
+			t.Errorf("%s: got equal hashes %t, want %t", test.name, test.a == test.b, test.equal)
+		}
+	}
+}
+
+func TestWithIdempotencyKey(t *testing.T) {
+	setupTestDatabase(t)
+	config.PlantBuddyConfig.SensorData.IdempotencyKeyLifetime = config.Duration{Duration: time.Hour}
+
+	body := fmt.Sprintf(`{"data": [{"controller": "%s", "sensor": "humidity", "value": 40}]}`, testController)
+
+	// The first request reserves the key, all other steps are retries of it
+	steps := []struct {
+		name     string
+		accept   string
+		body     string
+		status   int
+		replayed bool
+	}{
+		{"first request", "", body, http.StatusOK, false},
+		{"retry", "", body, http.StatusOK, true},
+		{"retry accepting anything", "*/*", body, http.StatusOK, true},
+		{"retry accepting another media type", mediaTypeCbor, body, http.StatusUnprocessableEntity, false},
+		{"retry with another body", "", `{"data": []}`, http.StatusUnprocessableEntity, false},
+	}
+
+	var first string
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		SensorDataHandler(w, newTestIdempotentRequest("key", step.accept, step.body))
+
+		if w.Code != step.status {
+			t.Errorf("%s: got status %d (%s), want %d", step.name, w.Code, w.Body.String(), step.status)
+		}
+
+		if replayed := w.Header().Get(headerIdempotentReplayed) == "true"; replayed != step.replayed {
+			t.Errorf("%s: got replayed %t, want %t", step.name, replayed, step.replayed)
+		}
+
+		switch {
+		case first == "":
+			first = w.Body.String()
+		case step.replayed && w.Body.String() != first:
+			t.Errorf("%s: got %s, want %s", step.name, w.Body.String(), first)
+		}
+	}
+
+	// Data sets without a timestamp would be stored again if the request was processed again
+	if count := dbtest.CountRows(t, "SENSOR_DATA"); count != 1 {
+		t.Errorf("got %d stored data sets, want 1", count)
+	}
+}
+
+func TestWithIdempotencyKeyInProgress(t *testing.T) {
+	setupTestDatabase(t)
+	config.PlantBuddyConfig.SensorData.IdempotencyKeyLifetime = config.Duration{Duration: time.Hour}
+
+	body := `{"data": []}`
+	r := newTestIdempotentRequest("key", "", body)
+
+	// Reserve the key as if the first request was still being processed
+	session := db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repository, err := NewIdempotencyKeyRepository(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	key := &IdempotencyKey{
+		Principal:   requestPrincipal(r),
+		Key:         "key",
+		RequestHash: hashRequest(r, []byte(body)),
+		Reserved:    now,
+		Created:     now,
+	}
+
+	reserved, err := repository.Reserve(key, now.Add(-idempotencyStaleAfter))
+	if err != nil || !reserved {
+		t.Fatalf("got reserved %t (%v), want true", reserved, err)
+	}
+
+	w := httptest.NewRecorder()
+	SensorDataHandler(w, newTestIdempotentRequest("key", "", body))
+	if w.Code != http.StatusConflict || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("got status %d with Retry-After %q, want %d with 1", w.Code, w.Header().Get("Retry-After"), http.StatusConflict)
+	}
+
+	// Once the first request failed with a server error, the key is released and the retry is processed
+	err = repository.Delete(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	SensorDataHandler(w, newTestIdempotentRequest("key", "", body))
+	if w.Code == http.StatusConflict || w.Header().Get(headerIdempotentReplayed) != "" {
+		t.Errorf("got status %d (%s) after the key has been released, want the request to be processed", w.Code, w.Body.String())
+	}
+}
+
+func TestWithIdempotencyKeyStale(t *testing.T) {
+	setupTestDatabase(t)
+	config.PlantBuddyConfig.SensorData.IdempotencyKeyLifetime = config.Duration{Duration: time.Hour}
+
+	body := `{"data": []}`
+	r := newTestIdempotentRequest("key", "", body)
+
+	// Reserved by a request that has been aborted while being processed
+	reserved := time.Now().Add(-idempotencyStaleAfter - time.Second).UnixMilli()
+	dbtest.Exec(t, `
+    INSERT INTO IDEMPOTENCY_KEY (PRINCIPAL, KEY, REQUEST_HASH, RESERVED, CREATED)
+    VALUES (?, 'key', ?, ?, ?);`, requestPrincipal(r), hashRequest(r, []byte(body)), reserved, reserved)
+
+	// Each step depends on the key stored by the previous ones
+	steps := []struct {
+		name     string
+		body     string
+		status   int
+		replayed bool
+	}{
+		{"another request", `{"data": null}`, http.StatusUnprocessableEntity, false},
+		{"retry taking over", body, http.StatusOK, false},
+		{"retry", body, http.StatusOK, true},
+	}
+
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		SensorDataHandler(w, newTestIdempotentRequest("key", "", step.body))
+
+		if w.Code != step.status {
+			t.Errorf("%s: got status %d (%s), want %d", step.name, w.Code, w.Body.String(), step.status)
+		}
+
+		if replayed := w.Header().Get(headerIdempotentReplayed) == "true"; replayed != step.replayed {
+			t.Errorf("%s: got replayed %t, want %t", step.name, replayed, step.replayed)
+		}
+	}
+}
+
+func TestWithIdempotencyKeyNotStored(t *testing.T) {
+	setupTestDatabase(t)
+	config.PlantBuddyConfig.SensorData.IdempotencyKeyLifetime = config.Duration{Duration: time.Hour}
+
+	dbtest.Exec(t, `
+    CREATE TRIGGER IDEMPOTENCY_KEY_READ_ONLY
+        BEFORE UPDATE ON IDEMPOTENCY_KEY
+    BEGIN
+        SELECT RAISE(ABORT, 'read-only');
+    END;`)
+
+	// A client must not get a response it will not get again on retry
+	w := httptest.NewRecorder()
+	SensorDataHandler(w, newTestIdempotentRequest("key", "", `{"data": []}`))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "read-only") {
+		t.Errorf("got status %d (%s), want %d", w.Code, w.Body.String(), http.StatusInternalServerError)
+	}
+}
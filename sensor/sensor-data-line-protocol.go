@@ -0,0 +1,247 @@
+package sensor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tags of a line that are mapped onto sensor data
+const (
+	lineTagController = "controller" // UUID of the controller
+	lineTagSensor     = "sensor"     // Sensor type, if neither the measurement nor the field key is one
+)
+
+// lineFieldValue is the field key that holds the value of the sensor type named by the measurement.
+const lineFieldValue = "value"
+
+// linePrecisions maps the values of the query parameter `precision` to the unit of timestamps.
+var linePrecisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// linePoint is a single line in InfluxDB line protocol:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+type linePoint struct {
+	measurement string
+	tags        map[string]string
+	fields      []*lineField
+	timestamp   string // Empty if the line has none
+}
+
+// lineField is a single field of a line. Only numbers can be stored as sensor data.
+type lineField struct {
+	key     string
+	value   float64
+	numeric bool
+}
+
+// parseLine parses a single line. Comments and empty lines must be skipped before.
+func parseLine(line string) (*linePoint, error) {
+	// Quotes have no special meaning in measurements and tags, only in string fields
+	series, rest, found := cutLineProtocol(line, ' ', false)
+	if !found {
+		return nil, errors.New("fields are missing")
+	}
+
+	fields, timestamp, _ := cutLineProtocol(strings.TrimLeft(rest, " "), ' ', true)
+
+	parts := splitLineProtocol(series, ',', false)
+	point := &linePoint{
+		measurement: unescapeLineProtocol(parts[0]),
+		tags:        make(map[string]string),
+		timestamp:   strings.TrimSpace(timestamp),
+	}
+
+	if point.measurement == "" {
+		return nil, errors.New("measurement is missing")
+	}
+
+	for _, tag := range parts[1:] {
+		key, value, found := cutLineProtocol(tag, '=', false)
+		if !found || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid tag %s", tag)
+		}
+
+		point.tags[unescapeLineProtocol(key)] = unescapeLineProtocol(value)
+	}
+
+	if fields == "" {
+		return nil, errors.New("fields are missing")
+	}
+
+	for _, field := range splitLineProtocol(fields, ',', true) {
+		key, value, found := cutLineProtocol(field, '=', true)
+		if !found || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid field %s", field)
+		}
+
+		parsed, err := parseLineFieldValue(unescapeLineProtocol(key), value)
+		if err != nil {
+			return nil, err
+		}
+
+		point.fields = append(point.fields, parsed)
+	}
+
+	return point, nil
+}
+
+// parseLineFieldValue parses the value of a field, which is a float, an integer (`i`), an unsigned integer (`u`),
+// a quoted string or a boolean.
+func parseLineFieldValue(key string, value string) (*lineField, error) {
+	field := &lineField{key: key}
+
+	switch {
+	case strings.HasPrefix(value, `"`):
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+			return nil, fmt.Errorf("string of field %s is not terminated", key)
+		}
+		return field, nil
+	case value == "t" || value == "T" || value == "f" || value == "F":
+		return field, nil
+	case strings.EqualFold(value, "true") || strings.EqualFold(value, "false"):
+		return field, nil
+	}
+
+	var err error
+	switch {
+	case strings.HasSuffix(value, "i"):
+		var i int64
+		i, err = strconv.ParseInt(strings.TrimSuffix(value, "i"), 10, 64)
+		field.value = float64(i)
+	case strings.HasSuffix(value, "u"):
+		var u uint64
+		u, err = strconv.ParseUint(strings.TrimSuffix(value, "u"), 10, 64)
+		field.value = float64(u)
+	default:
+		field.value, err = strconv.ParseFloat(value, 64)
+	}
+
+	if err != nil || math.IsNaN(field.value) || math.IsInf(field.value, 0) {
+		return nil, fmt.Errorf("invalid value %s of field %s", value, key)
+	}
+
+	field.numeric = true
+	return field, nil
+}
+
+// parseLineTimestamp converts the timestamp of a line in the given unit to the format of sensor data.
+func parseLineTimestamp(timestamp string, unit time.Duration) (string, error) {
+	if timestamp == "" {
+		return "", nil // The time of receipt is used
+	}
+
+	n, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return "", fmt.Errorf("invalid timestamp %s", timestamp)
+	}
+
+	return time.Unix(0, n*int64(unit)).UTC().Format(timestampLayout), nil
+}
+
+// mapLinePoint maps every field of a line onto sensor data. The controller is taken from the tag `controller`
+// (or the given default). The sensor type is taken from the tag `sensor`, otherwise from the measurement if the
+// field key is `value`, otherwise from the field key. Fields that cannot be mapped are returned as errors.
+func mapLinePoint(point *linePoint, timestamp string, defaultController string, sensorTypes map[string]bool) ([]*SensorData, []error) {
+	controller, ok := point.tags[lineTagController]
+	if !ok {
+		controller = defaultController
+	}
+
+	if controller == "" {
+		return nil, []error{fmt.Errorf("tag %s is missing", lineTagController)}
+	}
+
+	var data []*SensorData
+	var errs []error
+	for _, field := range point.fields {
+		sensor, ok := point.tags[lineTagSensor]
+		switch {
+		case ok:
+		case field.key == lineFieldValue:
+			sensor = point.measurement
+		default:
+			sensor = field.key
+		}
+
+		if !sensorTypes[sensor] {
+			errs = append(errs, fmt.Errorf("field %s: unknown sensor type %s", field.key, sensor))
+			continue
+		}
+
+		if !field.numeric {
+			errs = append(errs, fmt.Errorf("field %s: value is not a number", field.key))
+			continue
+		}
+
+		data = append(data, &SensorData{
+			Controller: controller,
+			Sensor:     sensor,
+			Value:      field.value,
+			Timestamp:  timestamp,
+		})
+	}
+
+	return data, errs
+}
+
+// cutLineProtocol slices s around the first separator that is neither escaped nor (if quotes is set) quoted.
+func cutLineProtocol(s string, sep byte, quotes bool) (string, string, bool) {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++ // Skip the escaped character
+		case quotes && s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			return s[:i], s[i+1:], true
+		}
+	}
+
+	return s, "", false
+}
+
+// splitLineProtocol slices s into all substrings separated by separators that are neither escaped nor
+// (if quotes is set) quoted.
+func splitLineProtocol(s string, sep byte, quotes bool) []string {
+	var parts []string
+	for {
+		before, after, found := cutLineProtocol(s, sep, quotes)
+		parts = append(parts, before)
+		if !found {
+			return parts
+		}
+		s = after
+	}
+}
+
+// unescapeLineProtocol removes the backslashes of escaped characters in measurements, tags and field keys.
+func unescapeLineProtocol(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`, ="\`, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,201 @@
+package sensor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want *linePoint // nil if invalid
+	}{
+		{"float", "temperature value=20.5", &linePoint{
+			measurement: "temperature",
+			tags:        map[string]string{},
+			fields:      []*lineField{{key: "value", value: 20.5, numeric: true}},
+		}},
+		{"tags, fields and timestamp", "environment,controller=c1,site=a humidity=48.2,soil-moisture=31i 1685613600000000000", &linePoint{
+			measurement: "environment",
+			tags:        map[string]string{"controller": "c1", "site": "a"},
+			fields: []*lineField{
+				{key: "humidity", value: 48.2, numeric: true},
+				{key: "soil-moisture", value: 31, numeric: true},
+			},
+			timestamp: "1685613600000000000",
+		}},
+		{"integer", "temperature value=-3i", &linePoint{
+			measurement: "temperature",
+			tags:        map[string]string{},
+			fields:      []*lineField{{key: "value", value: -3, numeric: true}},
+		}},
+		{"unsigned integer", "temperature value=18446744073709551615u", &linePoint{
+			measurement: "temperature",
+			tags:        map[string]string{},
+			fields:      []*lineField{{key: "value", value: 18446744073709551615, numeric: true}},
+		}},
+		{"exponent", "temperature value=2.05e1", &linePoint{
+			measurement: "temperature",
+			tags:        map[string]string{},
+			fields:      []*lineField{{key: "value", value: 20.5, numeric: true}},
+		}},
+		{"escaped characters", `my\ sensors,controller=c\,1,site\=x=a\ b soil\ moisture=1,a\,b\=c=2`, &linePoint{
+			measurement: "my sensors",
+			tags:        map[string]string{"controller": "c,1", "site=x": "a b"},
+			fields: []*lineField{
+				{key: "soil moisture", value: 1, numeric: true},
+				{key: "a,b=c", value: 2, numeric: true},
+			},
+		}},
+		{"quoted commas, spaces and equal signs", `status,controller=c1 message="a, b=c d",value=1 1685613600`, &linePoint{
+			measurement: "status",
+			tags:        map[string]string{"controller": "c1"},
+			fields: []*lineField{
+				{key: "message"},
+				{key: "value", value: 1, numeric: true},
+			},
+			timestamp: "1685613600",
+		}},
+		{"escaped quote", `status message="say \"hi\", bye",value=1`, &linePoint{
+			measurement: "status",
+			tags:        map[string]string{},
+			fields: []*lineField{
+				{key: "message"},
+				{key: "value", value: 1, numeric: true},
+			},
+		}},
+		{"quotes in tags", `status,note="a value=1`, &linePoint{
+			measurement: "status",
+			tags:        map[string]string{"note": `"a`},
+			fields:      []*lineField{{key: "value", value: 1, numeric: true}},
+		}},
+		{"booleans", "status ok=t,failed=FALSE", &linePoint{
+			measurement: "status",
+			tags:        map[string]string{},
+			fields:      []*lineField{{key: "ok"}, {key: "failed"}},
+		}},
+		{"quoted space in tags", `status,note="a b" value=1`, nil},
+		{"fields missing", "temperature", nil},
+		{"fields empty", "temperature ", nil},
+		{"measurement missing", ",controller=c1 value=1", nil},
+		{"tag without value", "temperature,controller value=1", nil},
+		{"tag with empty value", "temperature,controller= value=1", nil},
+		{"field without value", "temperature value", nil},
+		{"field with empty key", "temperature =1", nil},
+		{"string not terminated", `status message="a b`, nil},
+		{"integer overflow", "temperature value=9223372036854775808i", nil},
+		{"negative unsigned integer", "temperature value=-1u", nil},
+		{"unsigned integer overflow", "temperature value=18446744073709551616u", nil},
+		{"float overflow", "temperature value=1e400", nil},
+		{"NaN", "temperature value=NaN", nil},
+		{"infinity", "temperature value=+Inf", nil},
+		{"text", "temperature value=warm", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			point, err := parseLine(test.line)
+			if test.want == nil {
+				if err == nil {
+					t.Errorf("got %+v, want error", point)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(point, test.want) {
+				t.Errorf("got %+v, want %+v", point, test.want)
+			}
+		})
+	}
+}
+
+func TestParseLineTimestamp(t *testing.T) {
+	tests := []struct {
+		timestamp string
+		unit      time.Duration
+		want      string // Empty if invalid
+	}{
+		{"1685613600123456789", time.Nanosecond, "2023-06-01T10:00:00.123Z"},
+		{"1685613600123456", time.Microsecond, "2023-06-01T10:00:00.123Z"},
+		{"1685613600123", time.Millisecond, "2023-06-01T10:00:00.123Z"},
+		{"1685613600", time.Second, "2023-06-01T10:00:00.000Z"},
+		{"28093560", time.Minute, "2023-06-01T10:00:00.000Z"},
+		{"468226", time.Hour, "2023-06-01T10:00:00.000Z"},
+		{"-1", time.Second, "1969-12-31T23:59:59.000Z"},
+		{"9223372036855", time.Second, ""},
+		{"-9223372036855", time.Second, ""},
+		{"9223372036854775808", time.Nanosecond, ""},
+		{"1685613600.5", time.Second, ""},
+		{"2023-06-01T10:00:00Z", time.Nanosecond, ""},
+	}
+
+	for _, test := range tests {
+		timestamp, err := parseLineTimestamp(test.timestamp, test.unit)
+		switch {
+		case test.want == "" && err == nil:
+			t.Errorf("%s (%s): got %s, want error", test.timestamp, test.unit, timestamp)
+		case test.want != "" && err != nil:
+			t.Errorf("%s (%s): %s", test.timestamp, test.unit, err.Error())
+		case timestamp != test.want:
+			t.Errorf("%s (%s): got %s, want %s", test.timestamp, test.unit, timestamp, test.want)
+		}
+	}
+
+	if timestamp, err := parseLineTimestamp("", time.Second); err != nil || timestamp != "" {
+		t.Errorf("missing timestamp: got %q (%v), want the time of receipt", timestamp, err)
+	}
+}
+
+func TestMapLinePoint(t *testing.T) {
+	sensorTypes := map[string]bool{"humidity": true, "temperature": true}
+	const timestamp = "2023-06-01T10:00:00.000Z"
+
+	tests := []struct {
+		name       string
+		line       string
+		controller string // Authenticated controller
+		want       []*SensorData
+		errs       int
+	}{
+		{"measurement", "temperature,controller=c1 value=20.5", "",
+			[]*SensorData{{Controller: "c1", Sensor: "temperature", Value: 20.5, Timestamp: timestamp}}, 0},
+		{"field keys", "environment,controller=c1 humidity=48,temperature=20i", "",
+			[]*SensorData{
+				{Controller: "c1", Sensor: "humidity", Value: 48, Timestamp: timestamp},
+				{Controller: "c1", Sensor: "temperature", Value: 20, Timestamp: timestamp},
+			}, 0},
+		{"sensor tag", "reading,controller=c1,sensor=humidity raw=48", "",
+			[]*SensorData{{Controller: "c1", Sensor: "humidity", Value: 48, Timestamp: timestamp}}, 0},
+		{"authenticated controller", "temperature value=20.5", "c2",
+			[]*SensorData{{Controller: "c2", Sensor: "temperature", Value: 20.5, Timestamp: timestamp}}, 0},
+		{"controller tag overrides the authenticated one", "temperature,controller=c1 value=20.5", "c2",
+			[]*SensorData{{Controller: "c1", Sensor: "temperature", Value: 20.5, Timestamp: timestamp}}, 0},
+		{"controller missing", "temperature value=20.5", "", nil, 1},
+		{"unknown sensor types and strings", `environment,controller=c1 humidity=48,pressure=1013,temperature="warm"`, "",
+			[]*SensorData{{Controller: "c1", Sensor: "humidity", Value: 48, Timestamp: timestamp}}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			point, err := parseLine(test.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, errs := mapLinePoint(point, timestamp, test.controller, sensorTypes)
+			if !reflect.DeepEqual(data, test.want) {
+				t.Errorf("got %+v, want %+v", data, test.want)
+			}
+
+			if len(errs) != test.errs {
+				t.Errorf("got errors %v, want %d", errs, test.errs)
+			}
+		})
+	}
+}
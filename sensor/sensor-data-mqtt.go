@@ -0,0 +1,188 @@
+package sensor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/plantineers/plantbuddy-server/config"
+)
+
+// Placeholders of the MQTT topic scheme
+const (
+	mqttControllerLevel = "{controller}"
+	mqttSensorLevel     = "{sensor}"
+)
+
+// mqttReading is the JSON payload of an MQTT message. Plain numbers are accepted as well.
+type mqttReading struct {
+	Value     *float64 `json:"value"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// mqttDisconnectQuiesce is how long messages being handled may take when the subscriber is stopped (in milliseconds).
+const mqttDisconnectQuiesce = 1000
+
+// StartMqttSubscriber connects to the configured MQTT broker and stores all readings published on the topic scheme
+// like sensor data posted via HTTP. It keeps reconnecting in the background if the broker is not reachable.
+// The returned function disconnects from the broker after the messages being handled have been stored.
+func StartMqttSubscriber() (func(), error) {
+	conf := config.PlantBuddyConfig.Mqtt
+
+	filter, err := mqttTopicFilter(conf.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	// Storing may wait for the write buffer to be flushed, so messages are handled concurrently. A message is only
+	// acknowledged once it has been handled.
+	slots := make(chan struct{}, ingestConcurrency())
+
+	options := mqtt.NewClientOptions().
+		AddBroker(conf.Broker).
+		SetClientID(conf.ClientId).
+		SetUsername(conf.Username).
+		SetPassword(conf.Password).
+		SetCleanSession(false). // Let the broker keep readings published while the server is down
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOrderMatters(false). // Handle each message in its own goroutine
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("Lost connection to MQTT broker %s: %s", conf.Broker, err.Error())
+		}).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			// Subscriptions are lost on reconnect if the broker has not kept the session
+			token := client.Subscribe(filter, conf.Qos, func(_ mqtt.Client, message mqtt.Message) {
+				slots <- struct{}{}
+				defer func() { <-slots }()
+
+				handleMqttMessage(conf.Topic, message.Topic(), message.Payload())
+			})
+
+			if token.Wait() && token.Error() != nil {
+				log.Printf("Error subscribing to MQTT topic %s: %s", filter, token.Error().Error())
+				return
+			}
+
+			log.Printf("Subscribed to MQTT topic %s at %s", filter, conf.Broker)
+		})
+
+	// With SetConnectRetry, the token only fails if the options are invalid
+	client := mqtt.NewClient(options)
+	token := client.Connect()
+	if token.WaitTimeout(time.Second) && token.Error() != nil {
+		return nil, token.Error()
+	}
+
+	return func() {
+		client.Disconnect(mqttDisconnectQuiesce)
+
+		// Taking all slots waits for the messages being handled, later ones are never handled
+		for i := 0; i < cap(slots); i++ {
+			slots <- struct{}{}
+		}
+
+		log.Printf("Disconnected from MQTT broker %s", conf.Broker)
+	}, nil
+}
+
+// handleMqttMessage stores a single reading received via MQTT.
+// Invalid readings are logged and dropped, as there is no one to answer.
+func handleMqttMessage(scheme string, topic string, payload []byte) {
+	data, err := parseMqttMessage(scheme, topic, payload)
+	if err != nil {
+		log.Printf("Error parsing MQTT message on topic %s: %s", topic, err.Error())
+		return
+	}
+
+	result, err := saveSensorData([]*SensorData{data}, bulkModeAtomic, "")
+	if err != nil {
+		log.Printf("Error saving sensor data from MQTT topic %s: %s", topic, err.Error())
+		return
+	}
+
+	if result.Failed > 0 {
+		log.Printf("Error saving sensor data from MQTT topic %s: %s", topic, result.Results[0].Error)
+	}
+
+	if result.Quarantined > 0 {
+		log.Printf("Quarantined sensor data from MQTT topic %s: %s", topic, result.Results[0].Error)
+	}
+}
+
+// parseMqttMessage extracts controller and sensor from the topic according to the scheme, and value and timestamp
+// from the payload, which is either a plain number or a JSON object.
+func parseMqttMessage(scheme string, topic string, payload []byte) (*SensorData, error) {
+	schemeLevels := strings.Split(scheme, "/")
+	topicLevels := strings.Split(topic, "/")
+	if len(schemeLevels) != len(topicLevels) {
+		return nil, fmt.Errorf("topic does not match %s", scheme)
+	}
+
+	data := &SensorData{}
+	for i, level := range schemeLevels {
+		switch level {
+		case mqttControllerLevel:
+			data.Controller = topicLevels[i]
+		case mqttSensorLevel:
+			data.Sensor = topicLevels[i]
+		default:
+			if level != topicLevels[i] {
+				return nil, fmt.Errorf("topic does not match %s", scheme)
+			}
+		}
+	}
+
+	trimmed := strings.TrimSpace(string(payload))
+	value, err := strconv.ParseFloat(trimmed, 64)
+	if err == nil {
+		data.Value = value
+		return data, nil
+	}
+
+	var reading mqttReading
+	err = json.Unmarshal(payload, &reading)
+	if err != nil {
+		return nil, errors.New("payload must be a number or a JSON object with value and timestamp")
+	}
+
+	if reading.Value == nil {
+		return nil, errors.New("value must be set")
+	}
+
+	data.Value = *reading.Value
+	data.Timestamp = reading.Timestamp
+	return data, nil
+}
+
+// mqttTopicFilter turns the topic scheme into a filter to subscribe to by replacing the placeholders by wildcards.
+func mqttTopicFilter(scheme string) (string, error) {
+	levels := strings.Split(scheme, "/")
+
+	var hasController, hasSensor bool
+	for i, level := range levels {
+		switch level {
+		case mqttControllerLevel:
+			hasController = true
+			levels[i] = "+"
+		case mqttSensorLevel:
+			hasSensor = true
+			levels[i] = "+"
+		default:
+			if strings.ContainsAny(level, "+#{}") {
+				return "", fmt.Errorf("invalid level %s of MQTT topic scheme %s", level, scheme)
+			}
+		}
+	}
+
+	if !hasController || !hasSensor {
+		return "", fmt.Errorf("MQTT topic scheme %s must contain %s and %s", scheme, mqttControllerLevel, mqttSensorLevel)
+	}
+
+	return strings.Join(levels, "/"), nil
+}
@@ -0,0 +1,142 @@
+package sensor
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+)
+
+// envTestMqttBroker is the environment variable holding the URL of the MQTT broker for the integration test,
+// like "tcp://localhost:1883" for the broker of docker-compose.yml. The test is skipped if it is not set.
+const envTestMqttBroker = "PLANTBUDDY_TEST_MQTT_BROKER"
+
+func TestParseMqttMessage(t *testing.T) {
+	const scheme = "plantbuddy/{controller}/{sensor}"
+
+	tests := []struct {
+		name    string
+		topic   string
+		payload string
+		want    *SensorData // nil if invalid
+	}{
+		{"plain number", "plantbuddy/c1/humidity", "42.5", &SensorData{Controller: "c1", Sensor: "humidity", Value: 42.5}},
+		{"plain number with whitespace", "plantbuddy/c1/humidity", " 42\n", &SensorData{Controller: "c1", Sensor: "humidity", Value: 42}},
+		{"negative number", "plantbuddy/c1/temperature", "-3", &SensorData{Controller: "c1", Sensor: "temperature", Value: -3}},
+		{"JSON", "plantbuddy/c1/humidity", `{"value": 40}`, &SensorData{Controller: "c1", Sensor: "humidity", Value: 40}},
+		{"JSON with timestamp", "plantbuddy/c1/humidity", `{"value": 0, "timestamp": "2023-05-01T12:00:00Z"}`,
+			&SensorData{Controller: "c1", Sensor: "humidity", Value: 0, Timestamp: "2023-05-01T12:00:00Z"}},
+		{"JSON without value", "plantbuddy/c1/humidity", `{"timestamp": "2023-05-01T12:00:00Z"}`, nil},
+		{"JSON with string value", "plantbuddy/c1/humidity", `{"value": "40"}`, nil},
+		{"text", "plantbuddy/c1/humidity", "wet", nil},
+		{"empty", "plantbuddy/c1/humidity", "", nil},
+		{"other prefix", "otherbuddy/c1/humidity", "40", nil},
+		{"too few levels", "plantbuddy/c1", "40", nil},
+		{"too many levels", "plantbuddy/c1/humidity/raw", "40", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := parseMqttMessage(scheme, test.topic, []byte(test.payload))
+			if test.want == nil {
+				if err == nil {
+					t.Errorf("got %+v, want error", data)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *data != *test.want {
+				t.Errorf("got %+v, want %+v", data, test.want)
+			}
+		})
+	}
+}
+
+func TestMqttTopicFilter(t *testing.T) {
+	tests := []struct {
+		scheme string
+		filter string // Empty if invalid
+	}{
+		{"plantbuddy/{controller}/{sensor}", "plantbuddy/+/+"},
+		{"{sensor}/{controller}", "+/+"},
+		{"site/a/{controller}/sensors/{sensor}", "site/a/+/sensors/+"},
+		{"plantbuddy/{controller}", ""},
+		{"plantbuddy/{sensor}", ""},
+		{"plantbuddy/+/{controller}/{sensor}", ""},
+		{"plantbuddy/{controller}/{sensor}/#", ""},
+		{"plantbuddy/{controller}-{sensor}", ""},
+	}
+
+	for _, test := range tests {
+		filter, err := mqttTopicFilter(test.scheme)
+		switch {
+		case test.filter == "" && err == nil:
+			t.Errorf("%s: got filter %s, want error", test.scheme, filter)
+		case test.filter != "" && err != nil:
+			t.Errorf("%s: %s", test.scheme, err.Error())
+		case filter != test.filter:
+			t.Errorf("%s: got filter %s, want %s", test.scheme, filter, test.filter)
+		}
+	}
+}
+
+func TestMqttSubscriber(t *testing.T) {
+	broker, ok := os.LookupEnv(envTestMqttBroker)
+	if !ok {
+		t.Skipf("%s is not set", envTestMqttBroker)
+	}
+
+	setupTestDatabase(t)
+	id := time.Now().UnixNano()
+	config.PlantBuddyConfig.Mqtt = config.Mqtt{
+		Enabled:  true,
+		Broker:   broker,
+		ClientId: fmt.Sprintf("plantbuddy-test-%d", id),
+		Topic:    fmt.Sprintf("plantbuddy-test-%d/{controller}/{sensor}", id),
+		Qos:      1,
+	}
+
+	stop, err := StartMqttSubscriber()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker).SetClientID(fmt.Sprintf("plantbuddy-test-publisher-%d", id)))
+	token := publisher.Connect()
+	if token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	defer publisher.Disconnect(0)
+
+	// The subscription is made in the background, so publish until the reading arrives. It is only stored once,
+	// as all messages carry the same timestamp.
+	topic := fmt.Sprintf("plantbuddy-test-%d/%s/humidity", id, testController)
+	payload := fmt.Sprintf(`{"value": 40, "timestamp": "%s"}`, time.Now().UTC().Format(time.RFC3339))
+	deadline := time.Now().Add(10 * time.Second)
+	for dbtest.CountRows(t, "SENSOR_DATA") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("reading has not been stored")
+		}
+
+		token = publisher.Publish(topic, 1, false, payload)
+		if token.Wait() && token.Error() != nil {
+			t.Fatal(token.Error())
+		}
+
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	stop()
+	if count := dbtest.CountRows(t, "SENSOR_DATA"); count != 1 {
+		t.Errorf("got %d stored readings, want 1", count)
+	}
+}
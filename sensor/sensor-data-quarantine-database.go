@@ -0,0 +1,20 @@
+package sensor
+
+// SensorDataQuarantineRepository provides access to sensor data that failed the referential validation.
+type SensorDataQuarantineRepository interface {
+	// GetAll returns a page of the quarantined sensor data in the order it has been received and the number of all
+	// quarantined data sets.
+	GetAll(filter *quarantineFilter) ([]*QuarantinedSensorData, int, error)
+
+	// GetById returns the quarantined sensor data with the given ID.
+	GetById(id int64) (*QuarantinedSensorData, error)
+
+	// DeleteById discards the quarantined sensor data with the given ID.
+	// It returns sql.ErrNoRows if it does not exist.
+	DeleteById(id int64) error
+
+	// Release moves the quarantined sensor data with the given ID to the sensor data in a single transaction.
+	// It returns sql.ErrNoRows if it does not exist and ErrDuplicateSensorData if it has been ignored due to
+	// onConflict, in which case it stays quarantined.
+	Release(id int64, onConflict string) error
+}
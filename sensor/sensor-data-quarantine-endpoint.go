@@ -0,0 +1,256 @@
+package sensor
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/plantineers/plantbuddy-server/auth"
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+const auditEntitySensorDataQuarantine = "sensor-data-quarantine"
+
+const (
+	defaultQuarantineLimit = 100
+	maxQuarantineLimit     = 1000
+)
+
+// SensorDataQuarantineHandler handles all requests to `/v1/sensor-data/quarantine`, where admins review sensor data
+// that failed the referential validation. Each data set can either be discarded or released into the sensor data.
+func SensorDataQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	segments := utils.PathSegments(r.URL.Path, "/v1/sensor-data/quarantine")
+	if len(segments) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			handleSensorDataQuarantineGet(w, r)
+		default:
+			utils.HttpMethodNotAllowedResponse(w, "Allowed methods: GET")
+		}
+		return
+	}
+
+	id, err := strconv.ParseInt(segments[0], 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid ID %s of quarantined sensor data", segments[0])
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	switch {
+	case len(segments) == 1 && r.Method == http.MethodDelete:
+		handleSensorDataQuarantineDelete(w, r, id)
+	case len(segments) == 1:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: DELETE")
+	case len(segments) == 2 && segments[1] == "release" && r.Method == http.MethodPost:
+		handleSensorDataQuarantineRelease(w, r, id)
+	case len(segments) == 2 && segments[1] == "release":
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: POST")
+	default:
+		utils.HttpNotFoundResponse(w, fmt.Sprintf("Unknown resource %s", r.URL.Path))
+	}
+}
+
+// handleSensorDataQuarantineGet handles GET requests to the quarantine endpoint.
+// It returns a page of the quarantined sensor data along with the number of all quarantined data sets.
+func handleSensorDataQuarantineGet(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterQuarantinedSensorData(r)
+	if err != nil {
+		msg := fmt.Sprintf("Error parsing quarantine filter: %s", err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	set, err := getQuarantinedSensorData(filter)
+	if err != nil {
+		msg := fmt.Sprintf("Error getting quarantined sensor data: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	b, err := json.Marshal(set)
+	if err != nil {
+		msg := fmt.Sprintf("Error converting quarantined sensor data to JSON: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	log.Printf("Loaded %d of %d quarantined sensor data sets", len(set.Data), set.Total)
+	utils.HttpOkResponse(w, b)
+}
+
+// filterQuarantinedSensorData parses the query parameters of a request and returns a quarantineFilter.
+func filterQuarantinedSensorData(r *http.Request) (*quarantineFilter, error) {
+	query := r.URL.Query()
+	filter := &quarantineFilter{Limit: defaultQuarantineLimit}
+
+	var err error
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxQuarantineLimit {
+			return nil, fmt.Errorf("limit must be an integer between 1 and %d", maxQuarantineLimit)
+		}
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		filter.Offset, err = strconv.Atoi(offset)
+		if err != nil || filter.Offset < 0 {
+			return nil, errors.New("offset must be a non-negative integer")
+		}
+	}
+
+	return filter, nil
+}
+
+// handleSensorDataQuarantineDelete handles DELETE requests to a quarantined data set, which discards it.
+func handleSensorDataQuarantineDelete(w http.ResponseWriter, r *http.Request, id int64) {
+	previous, err := discardQuarantinedSensorData(id)
+	switch err {
+	case nil:
+		auth.RecordAudit(r, auditEntitySensorDataQuarantine, id, previous, nil)
+
+		log.Printf("Discarded quarantined sensor data %d", id)
+		utils.HttpOkResponse(w, nil)
+	case sql.ErrNoRows:
+		msg := fmt.Sprintf("Quarantined sensor data with ID %d not found", id)
+		utils.HttpNotFoundResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error discarding quarantined sensor data %d: %s", id, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// handleSensorDataQuarantineRelease handles POST requests to release a quarantined data set into the sensor data.
+// The controller and the sensor type must exist by now; whether the controller is active and the value is within
+// the bounds is up to the admin.
+func handleSensorDataQuarantineRelease(w http.ResponseWriter, r *http.Request, id int64) {
+	previous, err := releaseQuarantinedSensorData(id)
+
+	var unresolved *unresolvedReferenceError
+	switch {
+	case err == nil:
+		auth.RecordAudit(r, auditEntitySensorDataQuarantine, id, previous, &previous.SensorData)
+
+		b, err := json.Marshal(&previous.SensorData)
+		if err != nil {
+			msg := fmt.Sprintf("Error converting sensor data to JSON: %s", err.Error())
+			utils.HttpInternalServerErrorResponse(w, msg)
+			return
+		}
+
+		log.Printf("Released quarantined sensor data %d", id)
+		utils.HttpOkResponse(w, b)
+	case err == sql.ErrNoRows:
+		msg := fmt.Sprintf("Quarantined sensor data with ID %d not found", id)
+		utils.HttpNotFoundResponse(w, msg)
+	case err == ErrDuplicateSensorData:
+		msg := fmt.Sprintf("Quarantined sensor data %d cannot be released: %s", id, err.Error())
+		utils.HttpConflictResponse(w, msg)
+	case errors.As(err, &unresolved):
+		msg := fmt.Sprintf("Quarantined sensor data %d cannot be released: %s", id, err.Error())
+		utils.HttpConflictResponse(w, msg)
+	default:
+		msg := fmt.Sprintf("Error releasing quarantined sensor data %d: %s", id, err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+	}
+}
+
+// unresolvedReferenceError is returned when a quarantined data set refers to a controller or sensor type that
+// does not exist.
+type unresolvedReferenceError struct {
+	err error
+}
+
+func (e *unresolvedReferenceError) Error() string {
+	return e.err.Error()
+}
+
+// getQuarantinedSensorData returns a page of the quarantined sensor data.
+func getQuarantinedSensorData(filter *quarantineFilter) (*quarantinedSensorDataSet, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := NewSensorDataQuarantineRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	data, total, err := repository.GetAll(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &quarantinedSensorDataSet{
+		Data:   data,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}, nil
+}
+
+// discardQuarantinedSensorData deletes the quarantined data set with the given ID and returns it.
+func discardQuarantinedSensorData(id int64) (*QuarantinedSensorData, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := NewSensorDataQuarantineRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := repository.GetById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return previous, repository.DeleteById(id)
+}
+
+// releaseQuarantinedSensorData moves the quarantined data set with the given ID to the sensor data and returns it.
+func releaseQuarantinedSensorData(id int64) (*QuarantinedSensorData, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := NewSensorDataQuarantineRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := repository.GetById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	references, err := loadSensorDataReferences(session, []*SensorData{&previous.SensorData})
+	if err != nil {
+		return nil, err
+	}
+
+	err = references.validateExistence(&previous.SensorData)
+	if err != nil {
+		return nil, &unresolvedReferenceError{err: err}
+	}
+
+	return previous, repository.Release(id, config.PlantBuddyConfig.SensorData.OnConflict)
+}
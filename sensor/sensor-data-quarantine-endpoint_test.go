@@ -0,0 +1,233 @@
+package sensor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+)
+
+// unknownTestController is a controller that does not exist in the test database.
+const unknownTestController = "33333333-3333-3333-3333-333333333333"
+
+// setupTestQuarantine quarantines invalid readings and returns the IDs of the quarantined data sets in the order
+// of the given data.
+func setupTestQuarantine(t *testing.T, data []*SensorData) []int64 {
+	t.Helper()
+
+	config.PlantBuddyConfig.SensorData.InvalidReadings = invalidReadingsQuarantine
+
+	_, err := saveSensorData(data, bulkModeBestEffort, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	for page := 0; ; page++ {
+		set := getTestQuarantine(t, fmt.Sprintf("?limit=1&offset=%d", page), http.StatusOK)
+		if len(set.Data) == 0 {
+			return ids
+		}
+
+		ids = append(ids, set.Data[0].Id)
+	}
+}
+
+// getTestQuarantine requests a page of the quarantined sensor data with the given query.
+func getTestQuarantine(t *testing.T, query string, status int) *quarantinedSensorDataSet {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	SensorDataQuarantineHandler(w, httptest.NewRequest(http.MethodGet, "/v1/sensor-data/quarantine"+query, nil))
+	if w.Code != status {
+		t.Fatalf("%s: got status %d (%s), want %d", query, w.Code, w.Body.String(), status)
+	}
+
+	var set quarantinedSensorDataSet
+	if status == http.StatusOK {
+		err := json.Unmarshal(w.Body.Bytes(), &set)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &set
+}
+
+func TestQuarantineSensorData(t *testing.T) {
+	setupTestDatabase(t)
+	config.PlantBuddyConfig.SensorData.InvalidReadings = invalidReadingsQuarantine
+	measured := time.Now().Add(-time.Minute)
+
+	data := []*SensorData{
+		testSensorData("humidity", 40, measured),
+		{Controller: testInactiveController, Sensor: "humidity", Value: 40},
+		{Controller: unknownTestController, Sensor: "humidity", Value: 40},
+		testSensorData("pressure", 1013, measured),
+		testSensorData("temperature", 200, measured),
+		testSensorData("", 20, measured),
+	}
+
+	result, err := saveSensorData(data, bulkModeAtomic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Quarantined data sets don't fail an atomic batch, invalid ones do
+	statuses := []string{sensorDataSkipped, sensorDataSkipped, sensorDataSkipped, sensorDataSkipped, sensorDataSkipped, sensorDataFailed}
+	for i, status := range statuses {
+		if result.Results[i].Status != status {
+			t.Errorf("atomic: data set %d: got status %s, want %s", i, result.Results[i].Status, status)
+		}
+	}
+
+	if count := dbtest.CountRows(t, "SENSOR_DATA_QUARANTINE"); count != 0 {
+		t.Errorf("atomic: got %d quarantined data sets, want 0", count)
+	}
+
+	result, err = saveSensorData(data, bulkModeBestEffort, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses = []string{sensorDataSaved, sensorDataQuarantined, sensorDataQuarantined, sensorDataQuarantined, sensorDataQuarantined, sensorDataFailed}
+	for i, status := range statuses {
+		if result.Results[i].Status != status {
+			t.Errorf("best-effort: data set %d: got status %s, want %s", i, result.Results[i].Status, status)
+		}
+	}
+
+	if result.Saved != 1 || result.Quarantined != 4 || result.Failed != 1 {
+		t.Errorf("best-effort: got %d saved, %d quarantined and %d failed, want 1, 4 and 1", result.Saved, result.Quarantined, result.Failed)
+	}
+
+	if count := dbtest.CountRows(t, "SENSOR_DATA"); count != 1 {
+		t.Errorf("got %d stored data sets, want 1", count)
+	}
+
+	set := getTestQuarantine(t, "", http.StatusOK)
+	if len(set.Data) != 4 || set.Total != 4 {
+		t.Fatalf("got %d of %d quarantined data sets, want 4 of 4", len(set.Data), set.Total)
+	}
+
+	for i, d := range set.Data {
+		if d.SensorData.Controller != data[i+1].Controller || d.SensorData.Sensor != data[i+1].Sensor || d.Reason == "" {
+			t.Errorf("quarantined data set %d: got %+v, want %+v with a reason", i, d, data[i+1])
+		}
+	}
+
+	config.PlantBuddyConfig.SensorData.InvalidReadings = invalidReadingsReject
+	result, err = saveSensorData(data[1:2], bulkModeBestEffort, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Results[0].Status != sensorDataFailed || dbtest.CountRows(t, "SENSOR_DATA_QUARANTINE") != 4 {
+		t.Errorf("got status %s with invalid readings rejected, want %s", result.Results[0].Status, sensorDataFailed)
+	}
+}
+
+func TestSensorDataQuarantineGetPage(t *testing.T) {
+	setupTestDatabase(t)
+
+	measured := time.Now().Add(-time.Minute)
+	data := make([]*SensorData, 5)
+	for i := range data {
+		data[i] = testSensorData("humidity", 101+float64(i), measured)
+	}
+
+	ids := setupTestQuarantine(t, data)
+	if len(ids) != len(data) {
+		t.Fatalf("got %d quarantined data sets, want %d", len(ids), len(data))
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		ids    []int64
+		limit  int
+	}{
+		{"", http.StatusOK, ids, defaultQuarantineLimit},
+		{"?limit=2", http.StatusOK, ids[:2], 2},
+		{"?limit=2&offset=2", http.StatusOK, ids[2:4], 2},
+		{"?limit=2&offset=4", http.StatusOK, ids[4:], 2},
+		{"?offset=5", http.StatusOK, nil, defaultQuarantineLimit},
+		{fmt.Sprintf("?limit=%d", maxQuarantineLimit), http.StatusOK, ids, maxQuarantineLimit},
+		{"?limit=0", http.StatusBadRequest, nil, 0},
+		{fmt.Sprintf("?limit=%d", maxQuarantineLimit+1), http.StatusBadRequest, nil, 0},
+		{"?limit=all", http.StatusBadRequest, nil, 0},
+		{"?offset=-1", http.StatusBadRequest, nil, 0},
+	}
+
+	for _, test := range tests {
+		set := getTestQuarantine(t, test.query, test.status)
+		if test.status != http.StatusOK {
+			continue
+		}
+
+		if set.Total != len(ids) || set.Limit != test.limit {
+			t.Errorf("%s: got total %d and limit %d, want %d and %d", test.query, set.Total, set.Limit, len(ids), test.limit)
+		}
+
+		if len(set.Data) != len(test.ids) {
+			t.Errorf("%s: got %d data sets, want %d", test.query, len(set.Data), len(test.ids))
+			continue
+		}
+
+		for i, d := range set.Data {
+			if d.Id != test.ids[i] {
+				t.Errorf("%s: data set %d: got ID %d, want %d", test.query, i, d.Id, test.ids[i])
+			}
+		}
+	}
+}
+
+func TestSensorDataQuarantineReleaseAndDelete(t *testing.T) {
+	setupTestDatabase(t)
+	measured := time.Now().Add(-time.Minute)
+
+	ids := setupTestQuarantine(t, []*SensorData{
+		{Controller: testInactiveController, Sensor: "humidity", Value: 40, Timestamp: measured.UTC().Format(time.RFC3339)},
+		{Controller: unknownTestController, Sensor: "humidity", Value: 40},
+		testSensorData("humidity", 101, measured),
+	})
+
+	// Each step depends on the data sets left by the previous ones
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"release inactive controller", http.MethodPost, fmt.Sprintf("/%d/release", ids[0]), http.StatusOK},
+		{"release again", http.MethodPost, fmt.Sprintf("/%d/release", ids[0]), http.StatusNotFound},
+		{"release unknown controller", http.MethodPost, fmt.Sprintf("/%d/release", ids[1]), http.StatusConflict},
+		{"release out of bounds", http.MethodPost, fmt.Sprintf("/%d/release", ids[2]), http.StatusOK},
+		{"discard", http.MethodDelete, fmt.Sprintf("/%d", ids[1]), http.StatusOK},
+		{"discard again", http.MethodDelete, fmt.Sprintf("/%d", ids[1]), http.StatusNotFound},
+		{"invalid ID", http.MethodDelete, "/first", http.StatusBadRequest},
+		{"release with GET", http.MethodGet, fmt.Sprintf("/%d/release", ids[1]), http.StatusMethodNotAllowed},
+		{"unknown resource", http.MethodPost, fmt.Sprintf("/%d/restore", ids[1]), http.StatusNotFound},
+	}
+
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		SensorDataQuarantineHandler(w, httptest.NewRequest(step.method, "/v1/sensor-data/quarantine"+step.path, nil))
+		if w.Code != step.status {
+			t.Errorf("%s: got status %d (%s), want %d", step.name, w.Code, w.Body.String(), step.status)
+		}
+	}
+
+	if count := dbtest.CountRows(t, "SENSOR_DATA"); count != 2 {
+		t.Errorf("got %d stored data sets, want 2", count)
+	}
+
+	if count := dbtest.CountRows(t, "SENSOR_DATA_QUARANTINE"); count != 0 {
+		t.Errorf("got %d quarantined data sets, want 0", count)
+	}
+}
@@ -0,0 +1,142 @@
+package sensor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// SensorDataQuarantineSqliteRepository implements the SensorDataQuarantineRepository interface.
+// It uses a SQLite database as data source. Timestamps are stored as unix milliseconds.
+type SensorDataQuarantineSqliteRepository struct {
+	db *sql.DB
+}
+
+// NewSensorDataQuarantineRepository creates a new repository for quarantined sensor data.
+// It will use the configured driver and data source from `buddy.json`
+func NewSensorDataQuarantineRepository(session *db.Session) (SensorDataQuarantineRepository, error) {
+	if !session.IsOpen() {
+		return nil, errors.New("session is not open")
+	}
+
+	return &SensorDataQuarantineSqliteRepository{db: session.DB}, nil
+}
+
+func (r *SensorDataQuarantineSqliteRepository) GetAll(filter *quarantineFilter) ([]*QuarantinedSensorData, int, error) {
+	var total int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM SENSOR_DATA_QUARANTINE;`).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`
+    SELECT SDQ.ID, SDQ.CONTROLLER, SDQ.SENSOR, SDQ.VALUE, SDQ.TIMESTAMP, SDQ.REASON, SDQ.RECEIVED
+        FROM SENSOR_DATA_QUARANTINE SDQ
+        ORDER BY SDQ.ID
+        LIMIT ? OFFSET ?;`, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	data := make([]*QuarantinedSensorData, 0)
+	for rows.Next() {
+		d, err := scanQuarantinedSensorData(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		data = append(data, d)
+	}
+
+	return data, total, rows.Err()
+}
+
+func (r *SensorDataQuarantineSqliteRepository) GetById(id int64) (*QuarantinedSensorData, error) {
+	row := r.db.QueryRow(`
+    SELECT SDQ.ID, SDQ.CONTROLLER, SDQ.SENSOR, SDQ.VALUE, SDQ.TIMESTAMP, SDQ.REASON, SDQ.RECEIVED
+        FROM SENSOR_DATA_QUARANTINE SDQ
+        WHERE SDQ.ID = ?;`, id)
+
+	return scanQuarantinedSensorData(row)
+}
+
+func (r *SensorDataQuarantineSqliteRepository) DeleteById(id int64) error {
+	result, err := r.db.Exec(`DELETE FROM SENSOR_DATA_QUARANTINE WHERE ID = ?;`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *SensorDataQuarantineSqliteRepository) Release(id int64, onConflict string) error {
+	insert, ok := upsertSensorData[onConflict]
+	if !ok {
+		return fmt.Errorf("invalid conflict handling %s (allowed: %s, %s)", onConflict, conflictIgnore, conflictOverwrite)
+	}
+
+	tx, err := r.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var controller, sensor string
+	var value float64
+	var timestamp int64
+	err = tx.QueryRow(`
+    SELECT SDQ.CONTROLLER, SDQ.SENSOR, SDQ.VALUE, SDQ.TIMESTAMP
+        FROM SENSOR_DATA_QUARANTINE SDQ
+        WHERE SDQ.ID = ?;`, id).Scan(&controller, &sensor, &value, &timestamp)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	err = execSensorDataUpsert(stmt, controller, sensor, value, timestamp)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM SENSOR_DATA_QUARANTINE WHERE ID = ?;`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scanQuarantinedSensorData scans a single row of SENSOR_DATA_QUARANTINE.
+func scanQuarantinedSensorData(row interface{ Scan(dest ...any) error }) (*QuarantinedSensorData, error) {
+	var d QuarantinedSensorData
+	var timestamp int64
+	var received int64
+
+	err := row.Scan(&d.Id, &d.Controller, &d.Sensor, &d.Value, &timestamp, &d.Reason, &received)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Timestamp = time.UnixMilli(timestamp).UTC().Format(timestampLayout)
+	d.Received = time.UnixMilli(received).UTC().Format(timestampLayout)
+	return &d, nil
+}
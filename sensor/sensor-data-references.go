@@ -0,0 +1,118 @@
+package sensor
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/plantineers/plantbuddy-server/controller"
+	"github.com/plantineers/plantbuddy-server/db"
+)
+
+// Ways of handling data sets that fail the referential validation (see `sensorData.invalidReadings`)
+const (
+	invalidReadingsReject     = "reject"     // Fail them like any other invalid data set
+	invalidReadingsQuarantine = "quarantine" // Store them in SENSOR_DATA_QUARANTINE for review by admins
+)
+
+// sensorDataReferences holds the controllers and sensor types referenced by a batch of sensor data,
+// so each of them is loaded only once per batch.
+type sensorDataReferences struct {
+	controllers map[string]bool // Whether a controller is active, missing if it does not exist
+	sensorTypes map[string]*SensorType
+}
+
+// loadSensorDataReferences loads the controllers referenced by the given sensor data and all sensor types.
+func loadSensorDataReferences(session *db.Session, data []*SensorData) (*sensorDataReferences, error) {
+	controllerRepository, err := controller.NewControllerRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	sensorTypeRepository, err := NewSensorTypeRepository(session)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := sensorTypeRepository.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	references := &sensorDataReferences{
+		controllers: make(map[string]bool),
+		sensorTypes: make(map[string]*SensorType, len(types)),
+	}
+
+	for _, t := range types {
+		references.sensorTypes[t.Name] = t
+	}
+
+	loaded := make(map[string]bool)
+	for _, d := range data {
+		if d == nil || d.Controller == "" || loaded[d.Controller] {
+			continue
+		}
+		loaded[d.Controller] = true
+
+		active, err := controllerRepository.IsActive(d.Controller)
+		switch err {
+		case nil:
+			references.controllers[d.Controller] = active
+		case sql.ErrNoRows:
+		default:
+			return nil, err
+		}
+	}
+
+	return references, nil
+}
+
+// getSensorDataReferences loads the references of the given sensor data in a session of its own.
+func getSensorDataReferences(data []*SensorData) (*sensorDataReferences, error) {
+	var session = db.NewSession()
+	defer session.Close()
+
+	err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	return loadSensorDataReferences(session, data)
+}
+
+// validate checks that the controller of the sensor data exists and is active, that its sensor type exists and
+// that its value is within the physically plausible bounds of the sensor type.
+func (r *sensorDataReferences) validate(data *SensorData) error {
+	err := r.validateExistence(data)
+	if err != nil {
+		return err
+	}
+
+	if !r.controllers[data.Controller] {
+		return fmt.Errorf("controller %s is not active", data.Controller)
+	}
+
+	sensorType := r.sensorTypes[data.Sensor]
+	if sensorType.Min != nil && data.Value < *sensorType.Min {
+		return fmt.Errorf("value %g is below the minimum %g of sensor type %s", data.Value, *sensorType.Min, data.Sensor)
+	}
+
+	if sensorType.Max != nil && data.Value > *sensorType.Max {
+		return fmt.Errorf("value %g is above the maximum %g of sensor type %s", data.Value, *sensorType.Max, data.Sensor)
+	}
+
+	return nil
+}
+
+// validateExistence checks that the controller and the sensor type of the sensor data exist.
+func (r *sensorDataReferences) validateExistence(data *SensorData) error {
+	if _, ok := r.controllers[data.Controller]; !ok {
+		return fmt.Errorf("controller %s does not exist", data.Controller)
+	}
+
+	if _, ok := r.sensorTypes[data.Sensor]; !ok {
+		return fmt.Errorf("sensor type %s does not exist", data.Sensor)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package sensor
+
+import "testing"
+
+func TestValidateSensorDataReferences(t *testing.T) {
+	setupTestDatabase(t)
+
+	tests := []struct {
+		name     string
+		data     *SensorData
+		valid    bool
+		existing bool // Whether the controller and the sensor type exist
+	}{
+		{"valid", &SensorData{Controller: testController, Sensor: "humidity", Value: 40}, true, true},
+		{"minimum", &SensorData{Controller: testController, Sensor: "temperature", Value: -40}, true, true},
+		{"maximum", &SensorData{Controller: testController, Sensor: "temperature", Value: 85}, true, true},
+		{"below minimum", &SensorData{Controller: testController, Sensor: "temperature", Value: -40.1}, false, true},
+		{"above maximum", &SensorData{Controller: testController, Sensor: "humidity", Value: 100.1}, false, true},
+		{"inactive controller", &SensorData{Controller: testInactiveController, Sensor: "humidity", Value: 40}, false, true},
+		{"unknown controller", &SensorData{Controller: "33333333-3333-3333-3333-333333333333", Sensor: "humidity", Value: 40}, false, false},
+		{"unknown sensor type", &SensorData{Controller: testController, Sensor: "pressure", Value: 1013}, false, false},
+	}
+
+	data := make([]*SensorData, len(tests))
+	for i, test := range tests {
+		data[i] = test.data
+	}
+
+	references, err := getSensorDataReferences(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		err = references.validate(test.data)
+		if test.valid != (err == nil) {
+			t.Errorf("%s: got error %v, want valid %t", test.name, err, test.valid)
+		}
+
+		err = references.validateExistence(test.data)
+		if test.existing != (err == nil) {
+			t.Errorf("%s: got error %v, want existing %t", test.name, err, test.existing)
+		}
+	}
+}
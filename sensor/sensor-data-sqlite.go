@@ -5,12 +5,28 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/plantineers/plantbuddy-server/db"
 )
 
+// insertSensorData inserts a single sensor data set.
+const insertSensorData = "INSERT INTO SENSOR_DATA (CONTROLLER, SENSOR, VALUE, TIMESTAMP) VALUES (?, ?, ?, ?)"
+
+// upsertSensorData maps the ways of handling conflicts to the statement inserting a single sensor data set.
+var upsertSensorData = map[string]string{
+	conflictIgnore:    insertSensorData + " ON CONFLICT (CONTROLLER, SENSOR, TIMESTAMP) DO NOTHING",
+	conflictOverwrite: insertSensorData + " ON CONFLICT (CONTROLLER, SENSOR, TIMESTAMP) DO UPDATE SET VALUE = excluded.VALUE",
+}
+
+// insertQuarantinedSensorData inserts a single quarantined sensor data set.
+const insertQuarantinedSensorData = `
+    INSERT INTO SENSOR_DATA_QUARANTINE (CONTROLLER, SENSOR, VALUE, TIMESTAMP, REASON, RECEIVED)
+        VALUES (?, ?, ?, ?, ?, ?)`
+
 // SensorDataSqliteRepository implements the SensorDataRepository interface.
-// It uses a SQLite database as data source.
+// It uses a SQLite database as data source. Timestamps are stored as unix milliseconds.
 type SensorDataSqliteRepository struct {
 	db *sql.DB
 }
@@ -50,8 +66,15 @@ func (r *SensorDataSqliteRepository) GetAll(filter *SensorDataFilter) ([]*Sensor
     LEFT JOIN CONTROLLER C on SD.CONTROLLER = C.UUID
     WHERE C.PLANT_GROUP = ?
         AND SD.SENSOR = ?
-        AND SD.TIMESTAMP BETWEEN DATETIME(?) AND DATETIME(?);`,
-		plantGroupId, filter.Sensor, filter.From, filter.To)
+        AND SD.TIMESTAMP BETWEEN ? AND ?
+        AND (? = 0 OR C.PLANT_GROUP IN (
+            SELECT PGA.PLANT_GROUP
+            FROM PLANT_GROUP_ACCESS PGA
+            WHERE PGA.USER = ?
+        ))
+    ORDER BY SD.TIMESTAMP;`,
+		plantGroupId, filter.Sensor, filter.From.UnixMilli(), filter.To.UnixMilli(),
+		filter.UserId, filter.UserId)
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +84,7 @@ func (r *SensorDataSqliteRepository) GetAll(filter *SensorDataFilter) ([]*Sensor
 		var controller string
 		var sensor string
 		var value float64
-		var timestamp string
+		var timestamp int64
 
 		err = rows.Scan(&controller, &sensor, &value, &timestamp)
 		if err != nil {
@@ -72,39 +95,122 @@ func (r *SensorDataSqliteRepository) GetAll(filter *SensorDataFilter) ([]*Sensor
 			Controller: controller,
 			Sensor:     sensor,
 			Value:      value,
-			Timestamp:  timestamp,
+			Timestamp:  time.UnixMilli(timestamp).UTC().Format(timestampLayout),
 		})
 	}
 
 	return data, nil
 }
 
-func (r *SensorDataSqliteRepository) Save(data *SensorData) error {
-	tx, _ := r.db.BeginTx(context.Background(), nil)
+func (r *SensorDataSqliteRepository) SaveAll(batches []*SensorDataBatch, onConflict string) ([]*SensorDataBatchResult, error) {
+	insert, ok := upsertSensorData[onConflict]
+	if !ok {
+		return nil, fmt.Errorf("invalid conflict handling %s (allowed: %s, %s)", onConflict, conflictIgnore, conflictOverwrite)
+	}
 
-	_, err := r.db.Exec("INSERT INTO SENSOR_DATA (CONTROLLER, SENSOR, VALUE, TIMESTAMP) VALUES (?, ?, ?, ?)",
-		data.Controller, data.Sensor, data.Value, data.Timestamp)
+	tx, err := r.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(insert)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	results := make([]*SensorDataBatchResult, len(batches))
+	for i, batch := range batches {
+		results[i], err = saveBatch(tx, stmt, batch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, tx.Commit()
+}
+
+// saveBatch stores a single batch within a savepoint of the given transaction, so a failing batch can be rolled back
+// without affecting the other batches. Errors that keep the batch from being stored are part of its result. Only
+// errors of the savepoint itself are returned, as the transaction cannot go on then.
+func saveBatch(tx *sql.Tx, stmt *sql.Stmt, batch *SensorDataBatch) (*SensorDataBatchResult, error) {
+	_, err := tx.Exec("SAVEPOINT batch")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SensorDataBatchResult{Errs: make([]error, len(batch.Data))}
+	failed := false
+	for i, d := range batch.Data {
+		// A failing INSERT only undoes itself, so the transaction can go on in best-effort mode
+		var timestamp time.Time
+		timestamp, result.Errs[i] = time.Parse(time.RFC3339, d.Timestamp)
+		if result.Errs[i] == nil {
+			result.Errs[i] = execSensorDataUpsert(stmt, d.Controller, d.Sensor, d.Value, timestamp.UnixMilli())
+		}
+
+		if result.Errs[i] != nil && result.Errs[i] != ErrDuplicateSensorData {
+			failed = true
+			if batch.Atomic {
+				break
+			}
+		}
+	}
+
+	if !batch.Atomic || !failed {
+		for _, q := range batch.Quarantined {
+			result.Err = insertQuarantined(tx, q)
+			if result.Err != nil {
+				break
+			}
+		}
+	}
+
+	if result.Err != nil || (batch.Atomic && failed) {
+		_, err = tx.Exec("ROLLBACK TO batch")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec("RELEASE batch")
+	return result, err
+}
+
+// execSensorDataUpsert executes a statement of upsertSensorData and returns ErrDuplicateSensorData if nothing
+// has been inserted or updated.
+func execSensorDataUpsert(stmt *sql.Stmt, args ...any) error {
+	result, err := stmt.Exec(args...)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
-	err = tx.Commit()
+	n, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if n == 0 {
+		return ErrDuplicateSensorData
+	}
+
 	return nil
 }
 
-func (r *SensorDataSqliteRepository) SaveAll(data []*SensorData) []error {
-	var errors []error
-	for _, d := range data {
-		err := r.Save(d)
-		if err != nil {
-			errors = append(errors, err)
-		}
+// insertQuarantined inserts a single quarantined sensor data set within the given transaction.
+func insertQuarantined(tx *sql.Tx, data *QuarantinedSensorData) error {
+	timestamp, err := time.Parse(time.RFC3339, data.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	received, err := time.Parse(time.RFC3339, data.Received)
+	if err != nil {
+		return err
 	}
 
-	return errors
+	_, err = tx.Exec(insertQuarantinedSensorData,
+		data.Controller, data.Sensor, data.Value, timestamp.UnixMilli(), data.Reason, received.UnixMilli())
+	return err
 }
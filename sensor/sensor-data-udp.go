@@ -0,0 +1,253 @@
+package sensor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/auth"
+	"github.com/plantineers/plantbuddy-server/config"
+)
+
+// udpVersion is the version of the packet format, which is the first byte of every packet.
+//
+// A packet contains (all numbers big-endian):
+//
+//	version    1 byte   always udpVersion
+//	controller 16 bytes UUID of the controller
+//	counter    4 bytes  must increase with every packet of a controller, so packets cannot be replayed
+//	timestamp  4 bytes  unix seconds the values have been measured, within the clock skew and maximum age of sensor data
+//	count      1 byte   number of readings
+//	readings            for each reading: length of the sensor type (1 byte), sensor type, value (float32)
+//	mac        16 bytes HMAC-SHA256 of all bytes before keyed with the message key of the controller, truncated
+//	                    (see auth.AuthControllerMessage)
+//
+// Authenticated packets are acknowledged with the version, the counter and one of the udpStatus values.
+const udpVersion = 1
+
+// Lengths of the fixed parts of a packet
+const (
+	udpHeaderLength = 1 + 16 + 4 + 4 + 1
+	udpMacLength    = 16
+)
+
+// Status of a packet in the acknowledgement
+const (
+	udpStatusSaved    byte = 0
+	udpStatusRejected byte = 1 // Invalid readings or replayed packet
+	udpStatusError    byte = 2 // Error on the server, the packet may be sent again with a new counter
+)
+
+// udpPacket is a parsed packet.
+type udpPacket struct {
+	controller string
+	counter    uint32
+	data       []*SensorData
+	message    []byte // Everything covered by the MAC
+	mac        []byte
+}
+
+// StartUdpListener listens on the configured UDP port and stores all readings of authenticated packets
+// like sensor data posted via HTTP. The returned function stops listening after the packets being handled
+// have been stored and acknowledged.
+func StartUdpListener() (func(), error) {
+	if config.PlantBuddyConfig.Udp.Secret == "" {
+		return nil, errors.New("the secret to derive the message keys of controllers from must be set via PLANTBUDDY_UDP_SECRET")
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: config.PlantBuddyConfig.Udp.Port})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Listening for sensor data on UDP port %d", config.PlantBuddyConfig.Udp.Port)
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	slots := make(chan struct{}, ingestConcurrency())
+	var handling sync.WaitGroup
+
+	go func() {
+		defer close(stopped)
+
+		buffer := make([]byte, 1500) // Packets must fit into a single datagram on Ethernet
+		for {
+			n, addr, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				log.Printf("Error reading UDP packet: %s", err.Error())
+				continue
+			}
+
+			// Packets are authenticated in the order they have been received, so their counters keep increasing
+			packet, err := authUdpPacket(addr, buffer[:n])
+			switch err {
+			case nil:
+			case auth.ErrReplayedControllerMessage:
+				ackUdpPacket(conn, addr, packet.counter, udpStatusRejected)
+				continue
+			default: // Packets that cannot be attributed to a controller are never answered
+				continue
+			}
+
+			// Storing may wait for the write buffer to be flushed, so the next packets are read meanwhile
+			slots <- struct{}{}
+			handling.Add(1)
+			go func() {
+				defer func() {
+					<-slots
+					handling.Done()
+				}()
+
+				ackUdpPacket(conn, addr, packet.counter, storeUdpPacket(packet))
+			}()
+		}
+	}()
+
+	return func() {
+		close(stop)
+		conn.SetReadDeadline(time.Now())
+		<-stopped
+
+		handling.Wait()
+		conn.Close()
+		log.Printf("Stopped listening for sensor data on UDP port %d", config.PlantBuddyConfig.Udp.Port)
+	}, nil
+}
+
+// ackUdpPacket acknowledges an authenticated packet with the given status.
+func ackUdpPacket(conn *net.UDPConn, addr *net.UDPAddr, counter uint32, status byte) {
+	ack := []byte{udpVersion, 0, 0, 0, 0, status}
+	binary.BigEndian.PutUint32(ack[1:5], counter)
+	conn.WriteToUDP(ack, addr)
+}
+
+// authUdpPacket parses a single packet and authenticates it by its MAC and counter. Replayed packets are returned
+// along with auth.ErrReplayedControllerMessage, as they are answered nevertheless. All other errors mean the packet
+// cannot be attributed to a controller.
+func authUdpPacket(addr *net.UDPAddr, b []byte) (*udpPacket, error) {
+	// The packet is kept after the read buffer has been reused
+	packet, err := parseUdpPacket(append([]byte(nil), b...))
+	if err != nil {
+		log.Printf("Error parsing UDP packet from %s: %s", addr, err.Error())
+		return nil, err
+	}
+
+	err = auth.AuthControllerMessage(packet.controller, packet.counter, packet.message, packet.mac)
+	switch err {
+	case nil:
+		return packet, nil
+	case auth.ErrInvalidControllerKey:
+		log.Printf("Invalid MAC of UDP packet from %s for controller %s", addr, packet.controller)
+		return nil, err
+	case auth.ErrReplayedControllerMessage:
+		log.Printf("Replayed UDP packet %d of controller %s", packet.counter, packet.controller)
+		return packet, err
+	default:
+		log.Printf("Error authenticating UDP packet from %s: %s", addr, err.Error())
+		return nil, err
+	}
+}
+
+// storeUdpPacket stores the readings of an authenticated packet and returns the status to acknowledge it with.
+func storeUdpPacket(packet *udpPacket) byte {
+	result, err := saveSensorData(packet.data, config.PlantBuddyConfig.SensorData.BulkMode, "")
+	if err != nil {
+		log.Printf("Error saving sensor data of UDP packet from controller %s: %s", packet.controller, err.Error())
+		return udpStatusError
+	}
+
+	for _, r := range result.Results {
+		if r.Status == sensorDataQuarantined {
+			log.Printf("Quarantined reading %d of UDP packet from controller %s: %s", r.Index, packet.controller, r.Error)
+		}
+	}
+
+	if result.Failed > 0 {
+		for _, r := range result.Results {
+			if r.Status == sensorDataFailed {
+				log.Printf("Error saving reading %d of UDP packet from controller %s: %s", r.Index, packet.controller, r.Error)
+			}
+		}
+
+		return udpStatusRejected
+	}
+
+	return udpStatusSaved
+}
+
+// parseUdpPacket parses a packet in the format described at udpVersion.
+func parseUdpPacket(b []byte) (*udpPacket, error) {
+	if len(b) < udpHeaderLength+udpMacLength {
+		return nil, errors.New("packet is too short")
+	}
+
+	if b[0] != udpVersion {
+		return nil, fmt.Errorf("unknown version %d", b[0])
+	}
+
+	macStart := len(b) - udpMacLength
+	packet := &udpPacket{
+		controller: formatUuid(b[1:17]),
+		counter:    binary.BigEndian.Uint32(b[17:21]),
+		message:    b[:macStart],
+		mac:        b[macStart:],
+	}
+
+	// Signed by the controller, so a captured packet cannot be stored as current reading later
+	seconds := binary.BigEndian.Uint32(b[21:25])
+	if seconds == 0 {
+		return nil, errors.New("timestamp must be set")
+	}
+	timestamp := time.Unix(int64(seconds), 0)
+
+	count := int(b[25])
+	offset := udpHeaderLength
+	for i := 0; i < count; i++ {
+		if offset >= macStart {
+			return nil, fmt.Errorf("reading %d is missing", i)
+		}
+
+		length := int(b[offset])
+		offset++
+		if offset+length+4 > macStart {
+			return nil, fmt.Errorf("reading %d is too short", i)
+		}
+
+		sensor := string(b[offset : offset+length])
+		value := float64(math.Float32frombits(binary.BigEndian.Uint32(b[offset+length : offset+length+4])))
+		offset += length + 4
+
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, fmt.Errorf("value of reading %d must be a finite number", i)
+		}
+
+		packet.data = append(packet.data, &SensorData{
+			Controller: packet.controller,
+			Sensor:     sensor,
+			Value:      value,
+			Timestamp:  timestamp.UTC().Format(timestampLayout),
+		})
+	}
+
+	if offset != macStart {
+		return nil, fmt.Errorf("packet has %d unexpected bytes", macStart-offset)
+	}
+
+	return packet, nil
+}
+
+// formatUuid formats 16 bytes as UUID in its canonical form.
+func formatUuid(b []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,207 @@
+package sensor
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/auth"
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// testUdpReading is a reading of a test packet.
+type testUdpReading struct {
+	sensor string
+	value  float32
+}
+
+// testControllerBytes is the UUID of testController as sent in packets.
+var testControllerBytes = bytes.Repeat([]byte{0x11}, 16)
+
+// buildTestUdpMessage returns everything of a packet covered by the MAC.
+func buildTestUdpMessage(counter uint32, timestamp uint32, readings ...testUdpReading) []byte {
+	b := []byte{udpVersion}
+	b = append(b, testControllerBytes...)
+	b = binary.BigEndian.AppendUint32(b, counter)
+	b = binary.BigEndian.AppendUint32(b, timestamp)
+	b = append(b, byte(len(readings)))
+	for _, r := range readings {
+		b = append(b, byte(len(r.sensor)))
+		b = append(b, r.sensor...)
+		b = binary.BigEndian.AppendUint32(b, math.Float32bits(r.value))
+	}
+
+	return b
+}
+
+// signTestUdpMessage appends the truncated MAC keyed with the given message key.
+func signTestUdpMessage(message []byte, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return append(message, mac.Sum(nil)[:udpMacLength]...)
+}
+
+func TestParseUdpPacket(t *testing.T) {
+	now := uint32(time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC).Unix())
+
+	// Appends a MAC to a copy of the message, so the packets of the table do not share their bytes
+	withMac := func(message ...[]byte) []byte {
+		return append(bytes.Join(message, nil), make([]byte, udpMacLength)...)
+	}
+
+	valid := buildTestUdpMessage(7, now, testUdpReading{"temperature", 20.5}, testUdpReading{"humidity", 48})
+
+	tests := []struct {
+		name   string
+		packet []byte
+		valid  bool
+	}{
+		{"valid", withMac(valid), true},
+		{"without readings", withMac(buildTestUdpMessage(7, now)), true},
+		{"empty", nil, false},
+		{"too short", valid[:udpHeaderLength+udpMacLength-1], false},
+		{"unknown version", withMac([]byte{2}, valid[1:]), false},
+		{"without timestamp", withMac(buildTestUdpMessage(7, 0, testUdpReading{"temperature", 20.5})), false},
+		{"reading missing", withMac(valid[:len(valid)-len("humidity")-5]), false},
+		{"reading too short", withMac(valid[:len(valid)-2]), false},
+		{"unexpected bytes", withMac(valid, []byte{0}), false},
+		{"NaN", withMac(buildTestUdpMessage(7, now, testUdpReading{"temperature", float32(math.NaN())})), false},
+		{"infinity", withMac(buildTestUdpMessage(7, now, testUdpReading{"temperature", float32(math.Inf(1))})), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packet, err := parseUdpPacket(test.packet)
+			if !test.valid {
+				if err == nil {
+					t.Error("invalid packet has been parsed")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if packet.controller != testController || packet.counter != 7 {
+				t.Errorf("got controller %s and counter %d, want %s and 7", packet.controller, packet.counter, testController)
+			}
+
+			if !bytes.Equal(packet.message, test.packet[:len(test.packet)-udpMacLength]) {
+				t.Error("message does not cover everything before the MAC")
+			}
+		})
+	}
+
+	packet, err := parseUdpPacket(withMac(valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*SensorData{
+		{Controller: testController, Sensor: "temperature", Value: 20.5, Timestamp: "2023-05-01T12:00:00.000Z"},
+		{Controller: testController, Sensor: "humidity", Value: 48, Timestamp: "2023-05-01T12:00:00.000Z"},
+	}
+
+	for i, d := range packet.data {
+		if *d != *want[i] {
+			t.Errorf("reading %d: got %+v, want %+v", i, d, want[i])
+		}
+	}
+}
+
+// setupTestControllerKey stores an API key for the test controller and returns its message key.
+func setupTestControllerKey(t *testing.T, key string) []byte {
+	t.Helper()
+
+	keyHash := utils.HashToken(key)
+	dbtest.Exec(t, `
+    INSERT OR REPLACE INTO CONTROLLER_KEY (CONTROLLER, KEY, CREATED)
+    VALUES (?, ?, 0);`, testController, keyHash)
+
+	messageKey, err := auth.ControllerMessageKey(keyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return messageKey
+}
+
+// handleTestUdpPacket authenticates and stores a packet like the listener and returns the status it is acknowledged
+// with, if it is answered at all.
+func handleTestUdpPacket(addr *net.UDPAddr, b []byte) (byte, bool) {
+	packet, err := authUdpPacket(addr, b)
+	switch err {
+	case nil:
+		return storeUdpPacket(packet), true
+	case auth.ErrReplayedControllerMessage:
+		return udpStatusRejected, true
+	default:
+		return 0, false
+	}
+}
+
+func TestHandleUdpPacket(t *testing.T) {
+	setupTestDatabase(t)
+	config.PlantBuddyConfig.Udp.Secret = "secret"
+
+	messageKey := setupTestControllerKey(t, "key")
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 40000}
+	now := uint32(time.Now().Unix())
+
+	// Each step depends on the counters accepted by the previous ones
+	steps := []struct {
+		name   string
+		packet func() []byte
+		status byte
+		ack    bool // Whether the packet is authenticated and answered
+	}{
+		{"valid", func() []byte {
+			return signTestUdpMessage(buildTestUdpMessage(1, now, testUdpReading{"temperature", 20.5}), messageKey)
+		}, udpStatusSaved, true},
+		{"replayed", func() []byte {
+			return signTestUdpMessage(buildTestUdpMessage(1, now, testUdpReading{"temperature", 20.5}), messageKey)
+		}, udpStatusRejected, true},
+		{"lower counter", func() []byte {
+			return signTestUdpMessage(buildTestUdpMessage(0, now-1, testUdpReading{"temperature", 20.5}), messageKey)
+		}, udpStatusRejected, true},
+		{"next counter", func() []byte {
+			return signTestUdpMessage(buildTestUdpMessage(2, now-1, testUdpReading{"humidity", 48}), messageKey)
+		}, udpStatusSaved, true},
+		{"value out of bounds", func() []byte {
+			return signTestUdpMessage(buildTestUdpMessage(3, now-2, testUdpReading{"humidity", 200}), messageKey)
+		}, udpStatusRejected, true},
+		{"too old", func() []byte {
+			return signTestUdpMessage(buildTestUdpMessage(4, now-8*24*60*60, testUdpReading{"humidity", 48}), messageKey)
+		}, udpStatusRejected, true},
+		{"keyed with the hash of the API key", func() []byte {
+			return signTestUdpMessage(buildTestUdpMessage(5, now, testUdpReading{"humidity", 48}), []byte(utils.HashToken("key")))
+		}, 0, false},
+		{"truncated MAC", func() []byte {
+			packet := signTestUdpMessage(buildTestUdpMessage(5, now, testUdpReading{"humidity", 48}), messageKey)
+			return packet[:len(packet)-1]
+		}, 0, false},
+		{"key reissued", func() []byte {
+			messageKey = setupTestControllerKey(t, "new key")
+			return signTestUdpMessage(buildTestUdpMessage(1, now-3, testUdpReading{"humidity", 48}), messageKey)
+		}, udpStatusSaved, true},
+	}
+
+	for _, step := range steps {
+		status, ack := handleTestUdpPacket(addr, step.packet())
+		if ack != step.ack || status != step.status {
+			t.Errorf("%s: got status %d (answered %t), want %d (answered %t)", step.name, status, ack, step.status, step.ack)
+		}
+	}
+
+	if count := dbtest.CountRows(t, "SENSOR_DATA"); count != 3 {
+		t.Errorf("got %d stored readings, want 3", count)
+	}
+}
@@ -0,0 +1,179 @@
+package sensor
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/plantineers/plantbuddy-server/auth"
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// ErrBodyTooLarge is returned if the body of a request exceeds `sensorData.maxBodySize`.
+var ErrBodyTooLarge = errors.New("body is too large")
+
+// SensorDataWriteHandler handles requests to the write endpoint, which accepts sensor data in InfluxDB line protocol
+// like `/write` of InfluxDB 1.x, so off-the-shelf firmware and agents like Telegraf can send data.
+func SensorDataWriteHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		handleSensorDataWritePost(w, r)
+	default:
+		utils.HttpMethodNotAllowedResponse(w, "Allowed methods: POST")
+	}
+}
+
+// handleSensorDataWritePost handles POST requests to the write endpoint.
+// Lines that cannot be mapped onto sensor data are reported instead of failing the whole batch.
+func handleSensorDataWritePost(w http.ResponseWriter, r *http.Request) {
+	unit, ok := linePrecisions[r.URL.Query().Get("precision")]
+	if !ok {
+		msg := fmt.Sprintf("Invalid precision %s (allowed: ns, us, ms, s, m, h)", r.URL.Query().Get("precision"))
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	mode, err := requestBulkMode(r)
+	if err != nil {
+		msg := fmt.Sprintf("Error parsing sensor data mode: %s", err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	body, err := readLineProtocolBody(w, r, config.PlantBuddyConfig.SensorData.MaxBodySize)
+	if err == ErrBodyTooLarge {
+		msg := fmt.Sprintf("Error reading line protocol: %s (max. %d bytes)", err.Error(), config.PlantBuddyConfig.SensorData.MaxBodySize)
+		utils.HttpRequestEntityTooLargeResponse(w, msg)
+		return
+	} else if err != nil {
+		msg := fmt.Sprintf("Error reading line protocol: %s", err.Error())
+		utils.HttpBadRequestResponse(w, msg)
+		return
+	}
+
+	types, err := getSensorTypes()
+	if err != nil {
+		msg := fmt.Sprintf("Error getting sensor types: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	sensorTypes := make(map[string]bool, len(types))
+	for _, t := range types {
+		sensorTypes[t.Name] = true
+	}
+
+	controller, _ := auth.ControllerFromContext(r.Context())
+
+	var data []*SensorData
+	var lines []int
+	unmapped := make([]*unmappedLine, 0)
+
+	for i, line := range strings.Split(string(body), "\n") {
+		number := i + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		point, err := parseLine(line)
+		if err != nil {
+			unmapped = append(unmapped, &unmappedLine{Line: number, Error: err.Error()})
+			continue
+		}
+
+		timestamp, err := parseLineTimestamp(point.timestamp, unit)
+		if err != nil {
+			unmapped = append(unmapped, &unmappedLine{Line: number, Error: err.Error()})
+			continue
+		}
+
+		mapped, errs := mapLinePoint(point, timestamp, controller, sensorTypes)
+		for _, err := range errs {
+			unmapped = append(unmapped, &unmappedLine{Line: number, Error: err.Error()})
+		}
+
+		for _, d := range mapped {
+			data = append(data, d)
+			lines = append(lines, number)
+		}
+	}
+
+	// Controllers may only submit data on their own behalf, data sets of other controllers fail
+	saved, err := saveSensorData(data, mode, controller)
+	if err == ErrWriteBufferFull {
+		msg := fmt.Sprintf("Error saving sensor data: %s", err.Error())
+		utils.HttpServiceUnavailableResponse(w, msg, config.PlantBuddyConfig.SensorData.WriteBuffer.FlushInterval.Duration)
+		return
+	} else if err != nil {
+		msg := fmt.Sprintf("Error saving sensor data: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	for i, result := range saved.Results {
+		result.Line = lines[i]
+	}
+
+	result := &lineProtocolResult{sensorDataPostResult: *saved, Unmapped: unmapped}
+	b, err := json.Marshal(result)
+	if err != nil {
+		msg := fmt.Sprintf("Error converting line protocol result to JSON: %s", err.Error())
+		utils.HttpInternalServerErrorResponse(w, msg)
+		return
+	}
+
+	status := result.status()
+	if status == http.StatusOK && len(unmapped) > 0 {
+		status = http.StatusMultiStatus
+		if result.Saved == 0 && result.Duplicates == 0 && result.Quarantined == 0 {
+			status = http.StatusBadRequest
+		}
+	}
+
+	msg := fmt.Sprintf("Saved %d of %d sensor data sets from line protocol (%s), %d quarantined, %d unmapped",
+		result.Saved, len(data), mode, result.Quarantined, len(unmapped))
+	utils.HttpContentResponse(w, status, mediaTypeJson, b, msg)
+}
+
+// readLineProtocolBody reads the body of a request, which may be compressed with gzip (the default of Telegraf).
+// ErrBodyTooLarge is returned if the body has more than max bytes, either as sent or once decompressed.
+func readLineProtocolBody(w http.ResponseWriter, r *http.Request, max int64) ([]byte, error) {
+	var body io.Reader = http.MaxBytesReader(w, r.Body, max)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, bodyTooLarge(err)
+		}
+		defer reader.Close()
+
+		body = reader
+	}
+
+	// Read one byte more than allowed to tell a body of exactly max bytes from a larger one
+	b, err := io.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		return nil, bodyTooLarge(err)
+	}
+
+	if int64(len(b)) > max {
+		return nil, ErrBodyTooLarge
+	}
+
+	return b, nil
+}
+
+// bodyTooLarge returns ErrBodyTooLarge if err is caused by exceeding the limit of http.MaxBytesReader, otherwise err.
+func bodyTooLarge(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ErrBodyTooLarge
+	}
+
+	return err
+}
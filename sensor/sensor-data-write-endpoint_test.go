@@ -0,0 +1,191 @@
+package sensor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plantineers/plantbuddy-server/auth"
+	"github.com/plantineers/plantbuddy-server/config"
+	"github.com/plantineers/plantbuddy-server/db/dbtest"
+	"github.com/plantineers/plantbuddy-server/utils"
+)
+
+// gzipTestBody compresses a request body.
+func gzipTestBody(t *testing.T, body string) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	writer := gzip.NewWriter(&b)
+	_, err := writer.Write([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func TestReadLineProtocolBody(t *testing.T) {
+	const max = 1024
+	within := strings.Repeat("a", max)
+	beyond := strings.Repeat("a", max+1)
+
+	// Grows once compressed, so it is within the limit once decompressed but not as sent
+	incompressible := make([]byte, max-8)
+	for i, x := 0, uint32(1); i < len(incompressible); i++ {
+		x = x*1103515245 + 12345
+		incompressible[i] = byte(x >> 16)
+	}
+
+	compressed := gzipTestBody(t, string(incompressible))
+	if len(compressed) <= max {
+		t.Fatalf("compressed body has %d bytes, want more than %d", len(compressed), max)
+	}
+
+	// Compresses well, so it is within the limit as sent but not once decompressed
+	bomb := gzipTestBody(t, strings.Repeat("a", 100*max))
+	if len(bomb) > max {
+		t.Fatalf("compressed body has %d bytes, want at most %d", len(bomb), max)
+	}
+
+	tests := []struct {
+		name     string
+		body     []byte
+		gzip     bool
+		tooLarge bool
+	}{
+		{"within the limit", []byte(within), false, false},
+		{"beyond the limit", []byte(beyond), false, true},
+		{"compressed within the limit", gzipTestBody(t, within), true, false},
+		{"compressed beyond the limit", gzipTestBody(t, beyond), true, true},
+		{"compressed beyond the limit once decompressed", bomb, true, true},
+		{"compressed beyond the limit as sent", compressed, true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/write", bytes.NewReader(test.body))
+			if test.gzip {
+				r.Header.Set("Content-Encoding", "gzip")
+			}
+
+			b, err := readLineProtocolBody(httptest.NewRecorder(), r, max)
+			if test.tooLarge {
+				if err != ErrBodyTooLarge {
+					t.Errorf("got %d bytes and error %v, want %v", len(b), err, ErrBodyTooLarge)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(b) != within {
+				t.Errorf("got %q, want %q", b, within)
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/write", strings.NewReader(within))
+	r.Header.Set("Content-Encoding", "gzip")
+	_, err := readLineProtocolBody(httptest.NewRecorder(), r, max)
+	if err == nil || err == ErrBodyTooLarge {
+		t.Errorf("got error %v for an invalid gzip body, want a gzip error", err)
+	}
+}
+
+// testLine returns a line with the temperature of a controller measured the given number of seconds ago.
+// Without a controller, the tag is omitted.
+func testLine(controller string, secondsAgo int64) string {
+	tags := ""
+	if controller != "" {
+		tags = ",controller=" + controller
+	}
+
+	return fmt.Sprintf("temperature%s value=20.5 %d", tags, time.Now().Unix()-secondsAgo)
+}
+
+func TestSensorDataWriteHandler(t *testing.T) {
+	setupTestDatabase(t)
+	config.PlantBuddyConfig.SensorData.MaxBodySize = 256
+	dbtest.Exec(t, `
+    INSERT INTO CONTROLLER_KEY (CONTROLLER, KEY, CREATED)
+    VALUES (?, ?, 0);`, testController, utils.HashToken("key"))
+
+	// Requests are sent by the test controller
+	handler := auth.ControllerAuthMiddleware(SensorDataWriteHandler, auth.RoutePermissions{
+		http.MethodPost: auth.SensorDataWrite,
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		saved  int // Readings stored by the request
+	}{
+		{"saved", http.MethodPost, "/v1/write?precision=s", testLine(testController, 1), http.StatusOK, 1},
+		{
+			name:   "too large",
+			method: http.MethodPost,
+			target: "/v1/write?precision=s",
+			body:   testLine(testController, 2) + strings.Repeat(" ", 256),
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "nothing mapped",
+			method: http.MethodPost,
+			target: "/v1/write",
+			body:   "temperature,controller=" + testController + " unknown=1",
+			status: http.StatusBadRequest,
+		},
+		{"controller omitted", http.MethodPost, "/v1/write?precision=s", testLine("", 3), http.StatusOK, 1},
+		{
+			name:   "other controller (atomic)",
+			method: http.MethodPost,
+			target: "/v1/write?precision=s&mode=atomic",
+			body:   testLine("", 4) + "\n" + testLine(testInactiveController, 4),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "other controller (best-effort)",
+			method: http.MethodPost,
+			target: "/v1/write?precision=s&mode=best-effort",
+			body:   testLine("", 5) + "\n" + testLine(testInactiveController, 5),
+			status: http.StatusMultiStatus,
+			saved:  1,
+		},
+		{"method not allowed", http.MethodGet, "/v1/write", "", http.StatusMethodNotAllowed, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := dbtest.CountRows(t, "SENSOR_DATA")
+
+			r := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			r.Header.Set("Authorization", "ApiKey key")
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Errorf("got status %d (%s), want %d", w.Code, w.Body.String(), test.status)
+			}
+
+			if saved := dbtest.CountRows(t, "SENSOR_DATA") - before; saved != test.saved {
+				t.Errorf("got %d stored readings, want %d", saved, test.saved)
+			}
+		})
+	}
+}
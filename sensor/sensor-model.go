@@ -1,18 +1,24 @@
 package sensor
 
+import "time"
+
+// timestampLayout is the RFC 3339 format of sensor data timestamps, using the millisecond precision they are stored in.
+const timestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
 type SensorData struct {
 	Controller string  `json:"controller"`
 	Sensor     string  `json:"sensor"`
 	Value      float64 `json:"value"`
-	Timestamp  string  `json:"timestamp"`
+	Timestamp  string  `json:"timestamp"` // RFC 3339 in UTC (see timestampLayout)
 }
 
 type SensorDataFilter struct {
-	Sensor     string // Sensor Type
-	Plant      int64  // Plant ID
-	PlantGroup int64  // Plant Group ID
-	From       string // ISO 8601
-	To         string // ISO 8601
+	Sensor     string    // Sensor Type
+	Plant      int64     // Plant ID
+	PlantGroup int64     // Plant Group ID
+	From       time.Time // Inclusive
+	To         time.Time // Inclusive
+	UserId     int64     // Only data of plant groups the user has access to (0 = unrestricted)
 }
 
 type SensorRange struct {
@@ -28,8 +34,10 @@ type SensorRangeChange struct {
 }
 
 type SensorType struct {
-	Name string `json:"name"`
-	Unit string `json:"unit"`
+	Name string   `json:"name"`
+	Unit string   `json:"unit"`
+	Min  *float64 `json:"min,omitempty"` // Lowest physically plausible value (nil = unbounded)
+	Max  *float64 `json:"max,omitempty"` // Highest physically plausible value (nil = unbounded)
 }
 
 type sensorTypes struct {
@@ -40,6 +48,86 @@ type sensorDataSet struct {
 	SensorData []*SensorData `json:"data"`
 }
 
+// QuarantinedSensorData is a data set that failed the referential validation and awaits review by an admin.
+type QuarantinedSensorData struct {
+	Id int64 `json:"id"`
+	SensorData
+	Reason   string `json:"reason"`
+	Received string `json:"received"` // RFC 3339 in UTC (see timestampLayout)
+}
+
+// quarantinedSensorDataSet is a page of the quarantined sensor data along with the number of all quarantined data sets.
+type quarantinedSensorDataSet struct {
+	Data   []*QuarantinedSensorData `json:"data"`
+	Total  int                      `json:"total"`
+	Limit  int                      `json:"limit"`
+	Offset int                      `json:"offset"`
+}
+
+type quarantineFilter struct {
+	Limit  int
+	Offset int
+}
+
+// IdempotencyKey holds the response to a request with an `Idempotency-Key` header, which is replayed to retries.
+type IdempotencyKey struct {
+	Principal   string // Who sent the request, keys are unique per principal
+	Key         string
+	RequestHash string // SHA-256 of the request, so a key cannot be reused for another request
+	Status      int    // 0 while the request is being processed
+	ContentType string
+	Body        []byte
+	Reserved    time.Time // When the request has last been reserved for processing
+	Created     time.Time
+}
+
+// SensorDataBatch is the sensor data of a single request, which may be stored along with the batches of other
+// requests in a single transaction.
+type SensorDataBatch struct {
+	Data        []*SensorData
+	Quarantined []*QuarantinedSensorData
+	Atomic      bool // Nothing of the batch is stored if any data set fails
+}
+
+// SensorDataBatchResult is the result of storing a single batch.
+type SensorDataBatchResult struct {
+	// Errs holds the error of each data set: nil if it has been stored, ErrDuplicateSensorData if it has been ignored.
+	Errs []error
+
+	// Err is the error that kept the whole batch from being stored, if any.
+	Err error
+}
+
 type sensorDataPost struct {
 	Data []*SensorData `json:"data"`
 }
+
+// sensorDataPostResult is the result of posting a batch of sensor data.
+type sensorDataPostResult struct {
+	Mode        string              `json:"mode"`
+	Saved       int                 `json:"saved"`
+	Failed      int                 `json:"failed"`
+	Quarantined int                 `json:"quarantined"`
+	Duplicates  int                 `json:"duplicates"`
+	Results     []*sensorDataResult `json:"results"`
+}
+
+// sensorDataResult is the result of a single data set of a batch, identified by its index.
+type sensorDataResult struct {
+	Index  int    `json:"index"`
+	Line   int    `json:"line,omitempty"` // Only for line protocol
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// lineProtocolResult is the result of writing a batch of sensor data in InfluxDB line protocol.
+type lineProtocolResult struct {
+	sensorDataPostResult
+	Unmapped []*unmappedLine `json:"unmapped"`
+}
+
+// unmappedLine is a line (or a single field of it) that could not be mapped onto sensor data.
+type unmappedLine struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
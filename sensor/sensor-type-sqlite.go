@@ -26,7 +26,7 @@ func NewSensorTypeRepository(session *db.Session) (SensorTypeRepository, error)
 }
 
 func (r *SensorTypeSqliteRepository) GetAll() ([]*SensorType, error) {
-	var rows, err = r.db.Query(`SELECT NAME, UNIT FROM SENSOR_TYPE;`)
+	var rows, err = r.db.Query(`SELECT NAME, UNIT, MIN, MAX FROM SENSOR_TYPE;`)
 
 	if err != nil {
 		log.Fatal(err)
@@ -36,13 +36,24 @@ func (r *SensorTypeSqliteRepository) GetAll() ([]*SensorType, error) {
 	for rows.Next() {
 		var name string
 		var unit string
+		var min sql.NullFloat64
+		var max sql.NullFloat64
 
-		err = rows.Scan(&name, &unit)
+		err = rows.Scan(&name, &unit, &min, &max)
 		if err != nil {
 			rows.Close()
 			return nil, err
 		}
-		types = append(types, &SensorType{Name: name, Unit: unit})
+
+		sensorType := &SensorType{Name: name, Unit: unit}
+		if min.Valid {
+			sensorType.Min = &min.Float64
+		}
+		if max.Valid {
+			sensorType.Max = &max.Float64
+		}
+
+		types = append(types, sensorType)
 	}
 
 	return types, nil
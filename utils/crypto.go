@@ -2,11 +2,72 @@
 package utils
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword hashes a password with a fixed salt.
-func HashPassword(password string) string {
+// tokenLength is the number of random bytes a token consists of.
+const tokenLength = 32
+
+// passwordCost is the bcrypt cost used for new password hashes.
+const passwordCost = bcrypt.DefaultCost
+
+// HashPassword hashes a password using bcrypt with a random salt.
+// The hash is encoded in the modular crypt format (e.g. `$2a$10$...`), which records
+// the algorithm, its cost and the salt along with the hash itself.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// CheckPassword checks if the password matches the given hash.
+// Besides bcrypt hashes, it accepts legacy SHA-256 hashes with a fixed salt. The second return value
+// is true if the password matches, but the hash is outdated and should be replaced by a new one.
+func CheckPassword(password string, hash string) (bool, bool) {
+	if !strings.HasPrefix(hash, "$2") {
+		legacyHash := legacyHashPassword(password)
+		matches := subtle.ConstantTimeCompare([]byte(legacyHash), []byte(hash)) == 1
+		return matches, matches
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err == nil && cost < passwordCost
+}
+
+// legacyHashPassword hashes a password with a fixed salt.
+// It is only used to verify hashes created before passwords were hashed with bcrypt.
+func legacyHashPassword(password string) string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(password+"plantbuddy_salt")))
 }
+
+// GenerateToken generates a new random, URL-safe token.
+func GenerateToken() (string, error) {
+	b := make([]byte, tokenLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken hashes a token so it can be stored in the database.
+// As tokens are long and random, they do not need a salt.
+func HashToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cheapHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		hash     string
+		matches  bool
+		outdated bool
+	}{
+		{"bcrypt", "secret", hash, true, false},
+		{"bcrypt with wrong password", "Secret", hash, false, false},
+		{"bcrypt with lower cost", "secret", string(cheapHash), true, true},
+		{"bcrypt with lower cost and wrong password", "Secret", string(cheapHash), false, false},
+		{"legacy", "secret", legacyHashPassword("secret"), true, true},
+		{"legacy with wrong password", "Secret", legacyHashPassword("secret"), false, false},
+		{"legacy without salt", "secret", fmt.Sprintf("%x", sha256.Sum256([]byte("secret"))), false, false},
+		{"empty hash", "", "", false, false},
+		{"invalid bcrypt hash", "secret", "$2a$10$invalid", false, false},
+	}
+
+	for _, test := range tests {
+		matches, outdated := CheckPassword(test.password, test.hash)
+		if matches != test.matches || outdated != test.outdated {
+			t.Errorf("%s: got matches %t and outdated %t, want %t and %t", test.name, matches, outdated, test.matches, test.outdated)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	a, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(a, "$2") || a == b {
+		t.Errorf("got %s and %s, want distinct bcrypt hashes", a, b)
+	}
+
+	if cost, err := bcrypt.Cost([]byte(a)); err != nil || cost != passwordCost {
+		t.Errorf("got cost %d (%v), want %d", cost, err, passwordCost)
+	}
+}
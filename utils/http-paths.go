@@ -44,3 +44,16 @@ func PathParameterFilterStr(path string, prefix string) (string, error) {
 
 	return "", errors.New("no parameter found")
 }
+
+// PathSegments splits the path after the prefix into its segments.
+// A trailing slash is ignored.
+//
+// Example: the path `/v1/user/1/sessions` with the prefix `/v1/user/` results in `["1", "sessions"]`.
+func PathSegments(path string, prefix string) []string {
+	suffix := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	if suffix == "" {
+		return nil
+	}
+
+	return strings.Split(suffix, "/")
+}
@@ -3,7 +3,10 @@ package utils
 
 import (
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 const (
@@ -30,6 +33,15 @@ func HttpCreatedResponse(w http.ResponseWriter, b []byte, location string, msg s
 	w.Write(b)
 }
 
+// HttpContentResponse writes a response with the given status code and byte array as the body.
+// The Content-Type header is set to the given content type. It logs the given message.
+func HttpContentResponse(w http.ResponseWriter, status int, contentType string, b []byte, msg string) {
+	log.Print(msg)
+	w.Header().Add(headerContentType, contentType)
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
 // HttpBadRequestResponse writes a 400 Bad Request response with the given message as the body.
 // The Content-Type header is set to plain/text. It logs the given message.
 func HttpBadRequestResponse(w http.ResponseWriter, msg string) {
@@ -39,6 +51,17 @@ func HttpBadRequestResponse(w http.ResponseWriter, msg string) {
 	w.Write([]byte(msg))
 }
 
+// HttpUnauthorizedResponse writes a 401 Unauthorized response with the given message as the body.
+// The WWW-Authenticate header is set to the given challenge.
+// The Content-Type header is set to plain/text. It logs the given message.
+func HttpUnauthorizedResponse(w http.ResponseWriter, msg string, challenge string) {
+	log.Print(msg)
+	w.Header().Add(headerContentType, mimeText)
+	w.Header().Add("WWW-Authenticate", challenge)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(msg))
+}
+
 // HttpForbiddenResponse writes a 403 Forbidden response with the given message as the body.
 // The Content-Type header is set to plain/text. It logs the given message.
 func HttpForbiddenResponse(w http.ResponseWriter, msg string) {
@@ -66,6 +89,15 @@ func HttpMethodNotAllowedResponse(w http.ResponseWriter, msg string) {
 	w.Write([]byte(msg))
 }
 
+// HttpNotAcceptableResponse writes a 406 Not Acceptable response with the given message as the body.
+// The Content-Type header is set to plain/text. It logs the given message.
+func HttpNotAcceptableResponse(w http.ResponseWriter, msg string) {
+	log.Print(msg)
+	w.Header().Add(headerContentType, mimeText)
+	w.WriteHeader(http.StatusNotAcceptable)
+	w.Write([]byte(msg))
+}
+
 // HttpConflictResponse writes a 409 Conflict response with the given message as the body.
 // The Content-Type header is set to plain/text. It logs the given message.
 func HttpConflictResponse(w http.ResponseWriter, msg string) {
@@ -75,6 +107,45 @@ func HttpConflictResponse(w http.ResponseWriter, msg string) {
 	w.Write([]byte(msg))
 }
 
+// HttpRequestEntityTooLargeResponse writes a 413 Request Entity Too Large response with the given message as the body.
+// The Content-Type header is set to plain/text. It logs the given message.
+func HttpRequestEntityTooLargeResponse(w http.ResponseWriter, msg string) {
+	log.Print(msg)
+	w.Header().Add(headerContentType, mimeText)
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	w.Write([]byte(msg))
+}
+
+// HttpUnsupportedMediaTypeResponse writes a 415 Unsupported Media Type response with the given message as the body.
+// The Content-Type header is set to plain/text. It logs the given message.
+func HttpUnsupportedMediaTypeResponse(w http.ResponseWriter, msg string) {
+	log.Print(msg)
+	w.Header().Add(headerContentType, mimeText)
+	w.WriteHeader(http.StatusUnsupportedMediaType)
+	w.Write([]byte(msg))
+}
+
+// HttpUnprocessableEntityResponse writes a 422 Unprocessable Entity response with the given message as the body.
+// The Content-Type header is set to plain/text. It logs the given message.
+func HttpUnprocessableEntityResponse(w http.ResponseWriter, msg string) {
+	log.Print(msg)
+	w.Header().Add(headerContentType, mimeText)
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write([]byte(msg))
+}
+
+// HttpTooManyRequestsResponse writes a 429 Too Many Requests response with the given message as the body.
+// The Retry-After header is set to the given duration in seconds (rounded up).
+// The Content-Type header is set to plain/text. It logs the given message.
+func HttpTooManyRequestsResponse(w http.ResponseWriter, msg string, retryAfter time.Duration) {
+	log.Print(msg)
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	w.Header().Add(headerContentType, mimeText)
+	w.Header().Add("Retry-After", strconv.FormatInt(seconds, 10))
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte(msg))
+}
+
 // HttpInternalServerErrorResponse writes a 500 Internal Server Error response with the given message as the body.
 // The Content-Type header is set to plain/text. It logs the given message.
 func HttpInternalServerErrorResponse(w http.ResponseWriter, msg string) {
@@ -83,3 +154,15 @@ func HttpInternalServerErrorResponse(w http.ResponseWriter, msg string) {
 	w.WriteHeader(http.StatusInternalServerError)
 	w.Write([]byte(msg))
 }
+
+// HttpServiceUnavailableResponse writes a 503 Service Unavailable response with the given message as the body.
+// The Retry-After header is set to the given duration in seconds (rounded up).
+// The Content-Type header is set to plain/text. It logs the given message.
+func HttpServiceUnavailableResponse(w http.ResponseWriter, msg string, retryAfter time.Duration) {
+	log.Print(msg)
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	w.Header().Add(headerContentType, mimeText)
+	w.Header().Add("Retry-After", strconv.FormatInt(seconds, 10))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(msg))
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// totpSecretLength is the number of random bytes of a TOTP secret (160 bits as recommended by RFC 4226).
+	totpSecretLength = 20
+
+	// totpPeriod is the time each TOTP code is valid for.
+	totpPeriod = 30 * time.Second
+
+	// totpDigits is the number of digits of a TOTP code.
+	totpDigits = 6
+
+	// totpSkew is the number of periods before and after the current one whose codes are accepted as well,
+	// so clocks of authenticator apps may be slightly off.
+	totpSkew = 1
+)
+
+// totpEncoding encodes secrets the way authenticator apps expect them.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTotpSecret generates a new random, base32 encoded TOTP secret.
+func GenerateTotpSecret() (string, error) {
+	b := make([]byte, totpSecretLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TotpUri returns the provisioning URI of a TOTP secret. Authenticator apps scan it as QR code.
+func TotpUri(issuer string, account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, query.Encode())
+}
+
+// CheckTotp checks a TOTP code against the secret at the given time (RFC 6238).
+// Codes of periods up to lastStep have already been used and are rejected, so a code cannot be replayed.
+// It returns the period of the matching code, which has to be stored as lastStep.
+func CheckTotp(secret string, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// totpCode computes the code of a period (RFC 4226, section 5.3).
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateRecoveryCode generates a random recovery code like `abcd-efgh-ijkl`, which is easy to type.
+func GenerateRecoveryCode() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(totpEncoding.EncodeToString(b))[:12]
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12], nil
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 secret of the test vectors in RFC 6238, appendix B ("12345678901234567890").
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfc6238Vectors are the SHA-1 test vectors of RFC 6238, appendix B, truncated to six digits.
+var rfc6238Vectors = []struct {
+	time int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTotpCodeRfc6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, vector := range rfc6238Vectors {
+		code := totpCode(key, vector.time/int64(totpPeriod.Seconds()))
+		if code != vector.code {
+			t.Errorf("time %d: got code %s, want %s", vector.time, code, vector.code)
+		}
+	}
+}
+
+func TestCheckTotpRfc6238(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		now := time.Unix(vector.time, 0)
+		step, ok := CheckTotp(rfc6238Secret, vector.code, now, 0)
+		if !ok {
+			t.Errorf("time %d: code %s rejected", vector.time, vector.code)
+			continue
+		}
+
+		if want := vector.time / int64(totpPeriod.Seconds()); step != want {
+			t.Errorf("time %d: got step %d, want %d", vector.time, step, want)
+		}
+	}
+}
+
+func TestCheckTotp(t *testing.T) {
+	// The code 005924 belongs to step 41152263
+	now := time.Unix(1234567890, 0)
+	const step = 1234567890 / 30
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      time.Time
+		lastStep int64
+		valid    bool
+	}{
+		{"current period", rfc6238Secret, "005924", now, 0, true},
+		{"lower case secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "005924", now, 0, true},
+		{"previous period", rfc6238Secret, "005924", now.Add(totpPeriod), 0, true},
+		{"next period", rfc6238Secret, "005924", now.Add(-totpPeriod), 0, true},
+		{"outside skew", rfc6238Secret, "005924", now.Add(2 * totpPeriod), 0, false},
+		{"replayed", rfc6238Secret, "005924", now, step, false},
+		{"later period used", rfc6238Secret, "005924", now, step + 1, false},
+		{"wrong code", rfc6238Secret, "005925", now, 0, false},
+		{"too short", rfc6238Secret, "05924", now, 0, false},
+		{"invalid secret", "not base32!", "005924", now, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, valid := CheckTotp(test.secret, test.code, test.now, test.lastStep)
+			if valid != test.valid {
+				t.Errorf("got valid %t, want %t", valid, test.valid)
+			}
+		})
+	}
+}